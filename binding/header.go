@@ -32,3 +32,9 @@ var _ setter = headerSource(nil)
 func (hs headerSource) TrySet(value reflect.Value, field reflect.StructField, tagValue string, opt setOptions) (bool, error) {
 	return setByForm(value, field, hs, textproto.CanonicalMIMEHeaderKey(tagValue), opt)
 }
+
+// MapHeader sets the fields of the struct ptr points to from the headers h,
+// by the names of their header tags, without validating the struct.
+func MapHeader(ptr interface{}, h map[string][]string) error {
+	return mapHeader(ptr, h)
+}
@@ -0,0 +1,226 @@
+package error
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Media types of RFC 7807 problem details documents.
+const (
+	MIMEProblemJSON = "application/problem+json"
+	MIMEProblemXML  = "application/problem+xml"
+)
+
+// Codes set by AsProblem for the built-in error types.
+const (
+	CodeBind       = "bind_error"
+	CodeValidation = "validation_error"
+	CodeRender     = "render_error"
+	CodeInternal   = "internal_error"
+)
+
+// Problem is the standard error of mskit services. It is rendered as an
+// RFC 7807 problem details document, with the extension members code,
+// details and trace_id.
+type Problem struct {
+	XMLName xml.Name `json:"-" yaml:"-" xml:"urn:ietf:rfc:7807 problem"`
+
+	// Type is a URI reference identifying the problem type.
+	Type string `json:"type,omitempty" xml:"type,omitempty" yaml:"type,omitempty"`
+	// Title is a short summary of the problem type, by default the status text.
+	Title string `json:"title,omitempty" xml:"title,omitempty" yaml:"title,omitempty"`
+	// Status is the HTTP status code.
+	Status int `json:"status" xml:"status" yaml:"status"`
+	// Detail is the message explaining this occurrence of the problem.
+	Detail string `json:"detail,omitempty" xml:"detail,omitempty" yaml:"detail,omitempty"`
+	// Instance is a URI reference identifying this occurrence, usually the request path.
+	Instance string `json:"instance,omitempty" xml:"instance,omitempty" yaml:"instance,omitempty"`
+	// Code is an application specific error code.
+	Code string `json:"code,omitempty" xml:"code,omitempty" yaml:"code,omitempty"`
+	// Details lists field level errors, e.g. failed validations.
+	Details []ProblemDetail `json:"details,omitempty" xml:"details,omitempty" yaml:"details,omitempty"`
+	// TraceID is the ID of the trace the request was served in.
+	TraceID string `json:"trace_id,omitempty" xml:"trace_id,omitempty" yaml:"trace_id,omitempty"`
+
+	err error
+}
+
+// ProblemDetail is a single entry of Problem.Details.
+type ProblemDetail struct {
+	Field   string `json:"field,omitempty" xml:"field,omitempty" yaml:"field,omitempty"`
+	Message string `json:"message" xml:"message" yaml:"message"`
+}
+
+var _ error = &Problem{}
+
+// NewProblem returns a Problem with the given status, code and detail
+// message. The title defaults to the status text.
+func NewProblem(status int, code, detail string) *Problem {
+	return &Problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+// Error implements the error interface.
+func (p *Problem) Error() string {
+	msg := p.Detail
+	if msg == "" {
+		msg = p.Title
+	}
+	if p.Code != "" {
+		return p.Code + ": " + msg
+	}
+	return msg
+}
+
+// StatusCode returns the HTTP status of the problem, so a Problem can be
+// used wherever a rest.StatusCoder is checked.
+func (p *Problem) StatusCode() int {
+	return p.Status
+}
+
+// Unwrap returns the error the problem was created from, if any.
+func (p *Problem) Unwrap() error {
+	return p.err
+}
+
+// WithCause records err as the underlying cause of the problem. The cause is
+// reachable through errors.Is/As but is not rendered.
+func (p *Problem) WithCause(err error) *Problem {
+	p.err = err
+	return p
+}
+
+// WithType sets the problem type URI.
+func (p *Problem) WithType(typ string) *Problem {
+	p.Type = typ
+	return p
+}
+
+// WithInstance sets the problem instance URI.
+func (p *Problem) WithInstance(instance string) *Problem {
+	p.Instance = instance
+	return p
+}
+
+// WithTraceID sets the trace ID of the problem.
+func (p *Problem) WithTraceID(traceID string) *Problem {
+	p.TraceID = traceID
+	return p
+}
+
+// WithDetails appends field level details to the problem.
+func (p *Problem) WithDetails(details ...ProblemDetail) *Problem {
+	p.Details = append(p.Details, details...)
+	return p
+}
+
+// AsProblem converts err into a Problem. The result is always a new value,
+// so it can be completed (trace ID, instance) without touching err.
+//
+//   - a *Problem in err's chain is copied;
+//   - validator.ValidationErrors become a 400 with one detail per field;
+//   - an *Error of type ErrorTypeBind becomes a 400, ErrorTypeRender a 500,
+//     and its Meta is turned into details;
+//   - the status of any error implementing StatusCode() int is kept;
+//   - everything else is a 500.
+func AsProblem(err error) *Problem {
+	if err == nil {
+		return nil
+	}
+
+	var p *Problem
+	if errors.As(err, &p) {
+		cp := *p
+		cp.Details = append([]ProblemDetail(nil), p.Details...)
+		if cp.Status == 0 {
+			cp.Status = http.StatusInternalServerError
+		}
+		if cp.Title == "" {
+			cp.Title = http.StatusText(cp.Status)
+		}
+		return &cp
+	}
+
+	status, code := http.StatusInternalServerError, CodeInternal
+	var sc interface{ StatusCode() int }
+	if errors.As(err, &sc) && sc.StatusCode() > 0 {
+		status, code = sc.StatusCode(), ""
+	}
+
+	var details []ProblemDetail
+	var me *Error
+	if errors.As(err, &me) {
+		switch {
+		case me.IsType(ErrorTypeBind):
+			status, code = http.StatusBadRequest, CodeBind
+		case me.IsType(ErrorTypeRender):
+			status, code = http.StatusInternalServerError, CodeRender
+		}
+		details = metaDetails(me.Meta)
+	}
+
+	var ves validator.ValidationErrors
+	if errors.As(err, &ves) {
+		status, code = http.StatusBadRequest, CodeValidation
+		for _, fe := range ves {
+			details = append(details, ProblemDetail{
+				Field:   fe.Namespace(),
+				Message: fmt.Sprintf("failed on the '%s' rule", fe.Tag()),
+			})
+		}
+	}
+
+	return NewProblem(status, code, err.Error()).WithDetails(details...).WithCause(err)
+}
+
+// metaDetails turns the Meta of an Error into problem details.
+func metaDetails(meta interface{}) []ProblemDetail {
+	switch m := meta.(type) {
+	case nil:
+		return nil
+	case []ProblemDetail:
+		return m
+	case ProblemDetail:
+		return []ProblemDetail{m}
+	case string:
+		return []ProblemDetail{{Message: m}}
+	}
+	value := reflect.ValueOf(meta)
+	if value.Kind() != reflect.Map {
+		return []ProblemDetail{{Message: fmt.Sprint(meta)}}
+	}
+	details := make([]ProblemDetail, 0, value.Len())
+	for _, key := range value.MapKeys() {
+		details = append(details, ProblemDetail{
+			Field:   fmt.Sprint(key.Interface()),
+			Message: fmt.Sprint(value.MapIndex(key).Interface()),
+		})
+	}
+	sort.Slice(details, func(i, j int) bool { return details[i].Field < details[j].Field })
+	return details
+}
+
+// Problem converts the collected errors into a single Problem. The last
+// error decides the status and code; the messages of the earlier ones are
+// added as details. It returns nil if there are no errors.
+func (a ErrorMsgs) Problem() *Problem {
+	last := a.Last()
+	if last == nil {
+		return nil
+	}
+	p := AsProblem(last)
+	for _, msg := range a[:len(a)-1] {
+		p.Details = append(p.Details, ProblemDetail{Message: msg.Error()})
+	}
+	return p
+}
@@ -0,0 +1,96 @@
+package error
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProblemJSON(t *testing.T) {
+	p := NewProblem(http.StatusConflict, "user_exists", "user 42 already exists").
+		WithInstance("/users").
+		WithTraceID("abc").
+		WithDetails(ProblemDetail{Field: "name", Message: "taken"})
+
+	b, err := json.Marshal(p)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"title": "Conflict",
+		"status": 409,
+		"detail": "user 42 already exists",
+		"instance": "/users",
+		"code": "user_exists",
+		"details": [{"field": "name", "message": "taken"}],
+		"trace_id": "abc"
+	}`, string(b))
+	assert.Equal(t, "user_exists: user 42 already exists", p.Error())
+	assert.Equal(t, http.StatusConflict, p.StatusCode())
+}
+
+func TestProblemXML(t *testing.T) {
+	b, err := xml.Marshal(NewProblem(http.StatusNotFound, "", "gone"))
+	require.NoError(t, err)
+	assert.Equal(t, `<problem xmlns="urn:ietf:rfc:7807"><title>Not Found</title><status>404</status><detail>gone</detail></problem>`, string(b))
+}
+
+type coded struct{}
+
+func (coded) Error() string   { return "slow down" }
+func (coded) StatusCode() int { return http.StatusTooManyRequests }
+
+func TestAsProblem(t *testing.T) {
+	shared := NewProblem(http.StatusNotFound, "not_found", "missing")
+	p := AsProblem(fmt.Errorf("lookup: %w", shared))
+	p.TraceID = "abc"
+	assert.Equal(t, "not_found", p.Code)
+	assert.Empty(t, shared.TraceID, "AsProblem must not modify the original problem")
+
+	p = AsProblem(errors.New("boom"))
+	assert.Equal(t, http.StatusInternalServerError, p.Status)
+	assert.Equal(t, CodeInternal, p.Code)
+	assert.Equal(t, "boom", p.Detail)
+
+	p = AsProblem(coded{})
+	assert.Equal(t, http.StatusTooManyRequests, p.Status)
+
+	bind := (&Error{Err: errors.New("bad json"), Type: ErrorTypeBind}).SetMeta(map[string]string{"b": "2", "a": "1"})
+	p = AsProblem(bind)
+	assert.Equal(t, http.StatusBadRequest, p.Status)
+	assert.Equal(t, CodeBind, p.Code)
+	assert.Equal(t, []ProblemDetail{{Field: "a", Message: "1"}, {Field: "b", Message: "2"}}, p.Details)
+	assert.ErrorIs(t, p, bind.Err)
+}
+
+func TestAsProblemValidation(t *testing.T) {
+	var s struct {
+		Name string `validate:"required"`
+	}
+	err := validator.New().Struct(s)
+	require.Error(t, err)
+
+	p := AsProblem(err)
+	assert.Equal(t, http.StatusBadRequest, p.Status)
+	assert.Equal(t, CodeValidation, p.Code)
+	require.Len(t, p.Details, 1)
+	assert.Contains(t, p.Details[0].Field, "Name")
+	assert.Equal(t, "failed on the 'required' rule", p.Details[0].Message)
+}
+
+func TestErrorMsgsProblem(t *testing.T) {
+	assert.Nil(t, ErrorMsgs{}.Problem())
+
+	errs := ErrorMsgs{
+		{Err: errors.New("first"), Type: ErrorTypePrivate},
+		{Err: NewProblem(http.StatusUnauthorized, "auth", "token expired"), Type: ErrorTypePublic},
+	}
+	p := errs.Problem()
+	assert.Equal(t, http.StatusUnauthorized, p.Status)
+	assert.Equal(t, []ProblemDetail{{Message: "first"}}, p.Details)
+}
@@ -0,0 +1,160 @@
+package grace
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Environment of a process started by systemd socket activation, see
+// sd_listen_fds(3). The sockets are passed as file descriptors 3 to 3+N-1.
+const (
+	EnvSystemdListenFDs   = "LISTEN_FDS"
+	EnvSystemdListenPID   = "LISTEN_PID"
+	EnvSystemdListenNames = "LISTEN_FDNAMES"
+)
+
+// NetworkSystemd is the network of the listeners passed by systemd socket
+// activation, selected by the FileDescriptorName= of their socket unit:
+//
+//	l, err := grace.Listen(grace.NetworkSystemd, "http")
+//
+// An empty name selects the first listener not taken yet.
+const NetworkSystemd = "systemd"
+
+type activatedListener struct {
+	net.Listener
+	name string
+}
+
+var (
+	activationOnce sync.Once
+	// activated are the listeners passed by systemd not taken by Listen yet,
+	// guarded by listenersMu.
+	activated     []activatedListener
+	activationErr error
+)
+
+// loadActivated reads the listeners passed by systemd, if they are meant for
+// this process. The variables are removed from the environment, so processes
+// started later do not mistake the descriptors for theirs.
+func loadActivated() {
+	pid, _ := strconv.Atoi(os.Getenv(EnvSystemdListenPID))
+	n, _ := strconv.Atoi(os.Getenv(EnvSystemdListenFDs))
+	names := strings.Split(os.Getenv(EnvSystemdListenNames), ":")
+	os.Unsetenv(EnvSystemdListenPID)
+	os.Unsetenv(EnvSystemdListenFDs)
+	os.Unsetenv(EnvSystemdListenNames)
+	if pid != os.Getpid() {
+		return
+	}
+
+	for i := 0; i < n; i++ {
+		fd := listenFDsStart + i
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			// datagram sockets are not supported
+			if activationErr == nil {
+				activationErr = fmt.Errorf("systemd listener %d %q: %v", fd, name, err)
+			}
+			continue
+		}
+		activated = append(activated, activatedListener{Listener: l, name: name})
+	}
+}
+
+// takeActivated returns the listener passed by systemd for network and
+// address and forgets it, or nil if there is none. With NetworkSystemd the
+// listener is selected by name, otherwise by its address.
+func takeActivated(network, address string) net.Listener {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	for i, al := range activated {
+		var ok bool
+		if network == NetworkSystemd {
+			ok = address == "" || address == al.name
+		} else {
+			ok = sameAddr(network, address, al.Addr())
+		}
+		if ok {
+			activated = append(activated[:i], activated[i+1:]...)
+			return al.Listener
+		}
+	}
+	return nil
+}
+
+// sameAddr reports whether the listener address addr is the one Listen would
+// bind for network and address.
+func sameAddr(network, address string, addr net.Addr) bool {
+	switch network {
+	case "unix":
+		return addr.Network() == "unix" && addr.String() == address
+	case "tcp", "tcp4", "tcp6":
+		ta, ok := addr.(*net.TCPAddr)
+		if !ok {
+			return false
+		}
+		want, err := net.ResolveTCPAddr(network, address)
+		if err != nil || want.Port != ta.Port {
+			return false
+		}
+		if want.IP == nil || want.IP.IsUnspecified() {
+			return ta.IP == nil || ta.IP.IsUnspecified()
+		}
+		return want.IP.Equal(ta.IP)
+	}
+	return false
+}
+
+// ListenUnix is Listen("unix", address) setting the permissions of the socket
+// file to mode, e.g. 0660 to only accept connections from the group of the
+// process. A mode of 0 leaves the permissions given by the umask.
+func ListenUnix(address string, mode os.FileMode) (net.Listener, error) {
+	l, err := Listen("unix", address)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 && !strings.HasPrefix(address, "@") {
+		if err := os.Chmod(address, mode); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// listen binds a new listener. A unix socket file left over by a process
+// which did not remove it is removed first.
+func listen(network, address string) (net.Listener, error) {
+	l, err := net.Listen(network, address)
+	if err != nil && network == "unix" && errors.Is(err, syscall.EADDRINUSE) && removeStaleSocket(address) {
+		l, err = net.Listen(network, address)
+	}
+	return l, err
+}
+
+// removeStaleSocket removes the socket file at path if no process accepts
+// connections on it.
+func removeStaleSocket(path string) bool {
+	fi, err := os.Lstat(path)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return false
+	}
+	if c, err := net.Dial("unix", path); err == nil {
+		c.Close()
+		return false
+	}
+	return os.Remove(path) == nil
+}
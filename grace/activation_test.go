@@ -0,0 +1,99 @@
+package grace
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// activate makes ls the listeners passed by systemd, as loadActivated would.
+func activate(t *testing.T, ls ...activatedListener) {
+	activationOnce.Do(func() {})
+	listenersMu.Lock()
+	activated = ls
+	listenersMu.Unlock()
+	t.Cleanup(func() {
+		listenersMu.Lock()
+		for _, al := range activated {
+			al.Close()
+		}
+		activated = nil
+		listenersMu.Unlock()
+	})
+}
+
+func TestListenSystemd(t *testing.T) {
+	tl, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	sock := filepath.Join(t.TempDir(), "svc.sock")
+	ul, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	activate(t,
+		activatedListener{Listener: tl, name: "http"},
+		activatedListener{Listener: ul, name: "rpc"},
+	)
+
+	l, err := Listen(NetworkSystemd, "rpc")
+	require.NoError(t, err)
+	defer l.Close()
+	assert.Equal(t, sock, l.Addr().String())
+
+	_, err = Listen(NetworkSystemd, "rpc")
+	assert.Error(t, err, "a listener is taken once")
+
+	// listeners are matched by address as well
+	l, err = Listen("tcp", tl.Addr().String())
+	require.NoError(t, err)
+	defer l.Close()
+	assert.Equal(t, tl.Addr().String(), l.Addr().String())
+}
+
+func TestSameAddr(t *testing.T) {
+	unspec := &net.TCPAddr{Port: 8080}
+	local := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}
+
+	assert.True(t, sameAddr("tcp", ":8080", unspec))
+	assert.True(t, sameAddr("tcp", "0.0.0.0:8080", unspec))
+	assert.False(t, sameAddr("tcp", ":8080", local))
+	assert.True(t, sameAddr("tcp4", "127.0.0.1:8080", local))
+	assert.False(t, sameAddr("tcp", "127.0.0.1:8081", local))
+	assert.True(t, sameAddr("unix", "/run/a.sock", &net.UnixAddr{Name: "/run/a.sock", Net: "unix"}))
+	assert.False(t, sameAddr("unix", "/run/a.sock", unspec))
+}
+
+func TestListenUnix(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "svc.sock")
+
+	l, err := ListenUnix(sock, 0600)
+	require.NoError(t, err)
+	fi, err := os.Stat(sock)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	_, err = ListenUnix(sock, 0600)
+	assert.Error(t, err, "the socket is in use")
+	require.NoError(t, l.Close())
+	_, err = os.Stat(sock)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestListenUnixStaleSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "svc.sock")
+	ul, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	// as a crashed process would, leave the socket file behind
+	ul.(*net.UnixListener).SetUnlinkOnClose(false)
+	ul.Close()
+
+	l, err := ListenUnix(sock, 0)
+	require.NoError(t, err)
+	defer l.Close()
+
+	c, err := net.Dial("unix", sock)
+	require.NoError(t, err)
+	c.Close()
+}
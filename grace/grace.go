@@ -4,7 +4,6 @@ import (
 	"github.com/libra9z/httprouter"
 	"net/http"
 	"os"
-	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -26,11 +25,9 @@ const (
 )
 
 var (
-	regLock              *sync.Mutex
-	runningServers       map[string]*MicroService
-	runningServersOrder  []string
-	socketPtrOffsetMap   map[string]uint
-	runningServersForked bool
+	regLock             *sync.Mutex
+	runningServers      map[string]*MicroService
+	runningServersOrder []string
 
 	// DefaultReadTimeOut is the HTTP read timeout
 	DefaultReadTimeOut time.Duration
@@ -49,7 +46,6 @@ func init() {
 	regLock = &sync.Mutex{}
 	runningServers = make(map[string]*MicroService)
 	runningServersOrder = []string{}
-	socketPtrOffsetMap = make(map[string]uint)
 
 	hookableSignals = []os.Signal{
 		syscall.SIGHUP,
@@ -59,24 +55,18 @@ func init() {
 }
 
 // NewServer returns a new graceServer.
+//
+// ischild and socketorder are ignored: listeners are handed over through the
+// environment by Restart and picked up by Listen, see IsChild.
 func NewServer(ischild bool, socketorder, addr string) (srv *MicroService) {
 	regLock.Lock()
 	defer regLock.Unlock()
 
-	if len(socketorder) > 0 {
-		for i, addr := range strings.Split(socketorder, ",") {
-			socketPtrOffsetMap[addr] = uint(i)
-		}
-	} else {
-		socketPtrOffsetMap[addr] = uint(len(runningServersOrder))
-	}
-
 	srv = &MicroService{
 		Router:  httprouter.New(),
 		Server:  &http.Server{},
 		wg:      sync.WaitGroup{},
 		sigChan: make(chan os.Signal),
-		isChild: ischild,
 		SignalHooks: map[int]map[os.Signal][]func(){
 			PreSignal: {
 				syscall.SIGHUP:  {},
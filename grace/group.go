@@ -0,0 +1,148 @@
+package grace
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/libra9z/mskit/v4/endpoint"
+	"github.com/libra9z/mskit/v4/rest"
+)
+
+// RouteGroup registers routes under a shared path prefix, wrapping their
+// endpoints with the middlewares of the group. Middlewares of a group run
+// before those of its subgroups, which run before the ones of a route.
+type RouteGroup struct {
+	srv         *MicroService
+	prefix      string
+	middlewares []rest.RestMiddleware
+}
+
+// Group returns a RouteGroup for the routes under prefix.
+//
+//	v1 := srv.Group("/v1", authMiddleware)
+//	v1.GET("/users/:id", getUser)
+//	v1.RegisterRestService("/orders", &orderService{})
+func (srv *MicroService) Group(prefix string, middlewares ...rest.RestMiddleware) *RouteGroup {
+	return &RouteGroup{
+		srv:         srv,
+		prefix:      joinPaths("/", prefix),
+		middlewares: outermostLast(nil, middlewares),
+	}
+}
+
+// Group returns a subgroup for the routes under g's prefix joined with prefix.
+func (g *RouteGroup) Group(prefix string, middlewares ...rest.RestMiddleware) *RouteGroup {
+	return &RouteGroup{
+		srv:         g.srv,
+		prefix:      joinPaths(g.prefix, prefix),
+		middlewares: outermostLast(g.middlewares, middlewares),
+	}
+}
+
+// Use adds middlewares to the group. They only apply to routes registered
+// afterwards.
+func (g *RouteGroup) Use(middlewares ...rest.RestMiddleware) {
+	g.middlewares = outermostLast(g.middlewares, middlewares)
+}
+
+// Prefix returns the path prefix of the group.
+func (g *RouteGroup) Prefix() string {
+	return g.prefix
+}
+
+// Handle registers ep for method and the group path joined with relativePath.
+// The request passed to ep is the *rest.Mcontext of the request, e.g. bound
+// by an endpoint built with rest.Handle; the response is written by
+// rest.EncodeNegotiatedResponse and errors are written as problem details by
+// RestApi.ErrorEncoder. Requests with a method registered on no route of the
+// path are answered with 405 and an Allow header.
+func (g *RouteGroup) Handle(method, relativePath string, ep endpoint.Endpoint, middlewares ...rest.RestMiddleware) {
+	fullPath := joinPaths(g.prefix, relativePath)
+
+	api := &rest.RestApi{}
+	api.SetRouter(g.srv.Router)
+	api.SetPropagateErrors(true)
+
+	for _, m := range g.chain(middlewares) {
+		ep = m.GetMiddleware()(m.Object)(ep)
+	}
+
+	options := g.srv.serverOptions(true, fullPath)
+	options = append(options, rest.ServerErrorEncoder(api.ErrorEncoder))
+
+	g.srv.regRoute(fullPath, rest.NewEngine(
+		ep,
+		api.DecodeRequest,
+		rest.EncodeNegotiatedResponse,
+		options...,
+	), method)
+}
+
+// GET is a shortcut for g.Handle(http.MethodGet, relativePath, ep, middlewares...).
+func (g *RouteGroup) GET(relativePath string, ep endpoint.Endpoint, middlewares ...rest.RestMiddleware) {
+	g.Handle(http.MethodGet, relativePath, ep, middlewares...)
+}
+
+// POST is a shortcut for g.Handle(http.MethodPost, relativePath, ep, middlewares...).
+func (g *RouteGroup) POST(relativePath string, ep endpoint.Endpoint, middlewares ...rest.RestMiddleware) {
+	g.Handle(http.MethodPost, relativePath, ep, middlewares...)
+}
+
+// PUT is a shortcut for g.Handle(http.MethodPut, relativePath, ep, middlewares...).
+func (g *RouteGroup) PUT(relativePath string, ep endpoint.Endpoint, middlewares ...rest.RestMiddleware) {
+	g.Handle(http.MethodPut, relativePath, ep, middlewares...)
+}
+
+// PATCH is a shortcut for g.Handle(http.MethodPatch, relativePath, ep, middlewares...).
+func (g *RouteGroup) PATCH(relativePath string, ep endpoint.Endpoint, middlewares ...rest.RestMiddleware) {
+	g.Handle(http.MethodPatch, relativePath, ep, middlewares...)
+}
+
+// DELETE is a shortcut for g.Handle(http.MethodDelete, relativePath, ep, middlewares...).
+func (g *RouteGroup) DELETE(relativePath string, ep endpoint.Endpoint, middlewares ...rest.RestMiddleware) {
+	g.Handle(http.MethodDelete, relativePath, ep, middlewares...)
+}
+
+// HEAD is a shortcut for g.Handle(http.MethodHead, relativePath, ep, middlewares...).
+func (g *RouteGroup) HEAD(relativePath string, ep endpoint.Endpoint, middlewares ...rest.RestMiddleware) {
+	g.Handle(http.MethodHead, relativePath, ep, middlewares...)
+}
+
+// OPTIONS is a shortcut for g.Handle(http.MethodOptions, relativePath, ep, middlewares...).
+func (g *RouteGroup) OPTIONS(relativePath string, ep endpoint.Endpoint, middlewares ...rest.RestMiddleware) {
+	g.Handle(http.MethodOptions, relativePath, ep, middlewares...)
+}
+
+// RegisterRestService registers svc for the group path joined with
+// relativePath, on the methods listed by rest.ServiceMethods.
+func (g *RouteGroup) RegisterRestService(relativePath string, svc rest.RestService, middlewares ...rest.RestMiddleware) {
+	fullPath := joinPaths(g.prefix, relativePath)
+	handler := g.srv.NewHttpHandler(false, fullPath, svc, g.chain(middlewares)...)
+	g.srv.regRoute(fullPath, handler, rest.ServiceMethods(svc)...)
+}
+
+// chain returns the middlewares of a route of the group, in the order they
+// are applied to its endpoint: the last one is the outermost.
+func (g *RouteGroup) chain(middlewares []rest.RestMiddleware) []rest.RestMiddleware {
+	return outermostLast(g.middlewares, middlewares)
+}
+
+// outermostLast returns the middlewares of inner followed by those of outer,
+// so that, applied in order, outer ends up wrapping inner.
+func outermostLast(outer, inner []rest.RestMiddleware) []rest.RestMiddleware {
+	chain := make([]rest.RestMiddleware, 0, len(outer)+len(inner))
+	chain = append(chain, inner...)
+	return append(chain, outer...)
+}
+
+func joinPaths(absolutePath, relativePath string) string {
+	if relativePath == "" {
+		return absolutePath
+	}
+	finalPath := path.Join(absolutePath, relativePath)
+	if strings.HasSuffix(relativePath, "/") && !strings.HasSuffix(finalPath, "/") {
+		return finalPath + "/"
+	}
+	return finalPath
+}
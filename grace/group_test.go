@@ -0,0 +1,139 @@
+package grace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/libra9z/httprouter"
+	"github.com/libra9z/mskit/v4/endpoint"
+	me "github.com/libra9z/mskit/v4/error"
+	"github.com/libra9z/mskit/v4/rest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestService() *MicroService {
+	return &MicroService{Router: httprouter.New(), Server: &http.Server{}}
+}
+
+func do(srv *MicroService, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+// tag returns a middleware appending name to the chain carried by ctx.
+func tag(name string) rest.RestMiddleware {
+	return rest.RestMiddleware{Middle: func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			chain, _ := ctx.Value(chainKey{}).(string)
+			return next(context.WithValue(ctx, chainKey{}, chain+name), request)
+		}
+	}}
+}
+
+type chainKey struct{}
+
+func TestRouteGroup(t *testing.T) {
+	srv := newTestService()
+	v1 := srv.Group("/v1", tag("a"))
+	users := v1.Group("users", tag("b"))
+	users.GET("/:id", func(ctx context.Context, request interface{}) (interface{}, error) {
+		c := request.(*rest.Mcontext)
+		return rest.H{"id": c.Param("id"), "chain": ctx.Value(chainKey{})}, nil
+	}, tag("c"))
+	users.DELETE("/:id", func(ctx context.Context, request interface{}) (interface{}, error) {
+		return nil, me.NewProblem(http.StatusForbidden, "forbidden", "read only")
+	})
+
+	assert.Equal(t, "/v1/users", users.Prefix())
+
+	w := do(srv, http.MethodGet, "/v1/users/42")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id":"42","chain":"abc"}`, w.Body.String())
+
+	w = do(srv, http.MethodDelete, "/v1/users/42")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, me.MIMEProblemJSON, w.Header().Get("Content-Type"))
+
+	w = do(srv, http.MethodPost, "/v1/users/42")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "DELETE, GET, OPTIONS", w.Header().Get("Allow"))
+}
+
+type getOnlyService struct {
+	rest.RestApi
+}
+
+func (s *getOnlyService) Get(ctx context.Context, r *rest.Mcontext) (interface{}, error) {
+	return rest.H{"ok": true}, nil
+}
+
+func TestRegisterRestServiceMethods(t *testing.T) {
+	srv := newTestService()
+	svc := &getOnlyService{}
+	svc.SetMethods(http.MethodGet)
+	srv.Group("/api").RegisterRestService("/items", svc)
+
+	assert.Equal(t, http.StatusOK, do(srv, http.MethodGet, "/api/items").Code)
+
+	w := do(srv, http.MethodPost, "/api/items")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, OPTIONS", w.Header().Get("Allow"))
+}
+
+func TestRegisterRestServiceUnimplemented(t *testing.T) {
+	srv := newTestService()
+	srv.RegisterRestService("/items", &getOnlyService{})
+
+	assert.Equal(t, http.StatusOK, do(srv, http.MethodGet, "/items").Code)
+	assert.Equal(t, http.StatusOK, do(srv, http.MethodHead, "/items").Code)
+	assert.Equal(t, http.StatusOK, do(srv, http.MethodOptions, "/items").Code)
+
+	for _, method := range []string{http.MethodPost, http.MethodPut} {
+		w := do(srv, method, "/items")
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Equal(t, "GET, HEAD, OPTIONS", w.Header().Get("Allow"), "allowed before the others are tried")
+	}
+}
+
+type readOnlyService struct {
+	getOnlyService
+}
+
+func (s *readOnlyService) Delete(ctx context.Context, r *rest.Mcontext) (interface{}, error) {
+	return nil, rest.ErrMethodNotAllowed
+}
+
+func TestRestEndpointMethodNotAllowed(t *testing.T) {
+	srv := newTestService()
+	srv.RegisterRestService("/items", &readOnlyService{})
+
+	w := do(srv, http.MethodDelete, "/items")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, me.MIMEProblemJSON, w.Header().Get("Content-Type"))
+	allow := strings.Split(w.Header().Get("Allow"), ", ")
+	assert.Equal(t, []string{http.MethodGet, http.MethodHead, http.MethodOptions}, allow)
+}
+
+func TestHandleTypedEndpoint(t *testing.T) {
+	type getItem struct {
+		ID string `uri:"id"`
+	}
+	type item struct {
+		ID    string `json:"id"`
+		Chain string `json:"chain"`
+	}
+
+	srv := newTestService()
+	srv.Handle(http.MethodGet, "/items/:id", rest.Handle(func(ctx context.Context, req *getItem) (*item, error) {
+		chain, _ := ctx.Value(chainKey{}).(string)
+		return &item{ID: req.ID, Chain: chain}, nil
+	}), tag("a"), tag("b"))
+
+	w := do(srv, http.MethodGet, "/items/7")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id":"7","chain":"ba"}`, w.Body.String())
+}
@@ -0,0 +1,251 @@
+package grace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The paths of the health endpoints, under MicroService.HealthPrefix.
+const (
+	HealthPath = "/health"
+	ReadyPath  = "/ready"
+	LivePath   = "/live"
+)
+
+// DefaultHealthCheckTimeout bounds the run of each health check.
+var DefaultHealthCheckTimeout = 5 * time.Second
+
+// ErrNotReady is the error reported by the readiness of a service which is
+// not serving yet or is shutting down.
+var ErrNotReady = errors.New("not ready")
+
+// HealthCheck checks a dependency of the service, e.g. a database, a
+// downstream service or a disk. It returns an error when the dependency is
+// unhealthy; ctx is done when the check times out.
+type HealthCheck func(ctx context.Context) error
+
+// HealthStatus is the status of a service or of one of its checks.
+type HealthStatus string
+
+const (
+	StatusUp   HealthStatus = "up"
+	StatusDown HealthStatus = "down"
+)
+
+// CheckResult is the result of a health check.
+type CheckResult struct {
+	Status   HealthStatus `json:"status"`
+	Error    string       `json:"error,omitempty"`
+	Duration string       `json:"duration"`
+}
+
+// HealthReport is the body of the responses of the health endpoints. Status
+// is StatusDown, and the response a 503, when a check failed or, for the
+// health and readiness endpoints, when the service is not ready.
+type HealthReport struct {
+	Status HealthStatus           `json:"status"`
+	Error  string                 `json:"error,omitempty"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type healthCheck struct {
+	name      string
+	check     HealthCheck
+	readiness bool
+}
+
+// AddReadinessCheck adds the check name, run by the readiness and the health
+// endpoints. Readiness checks cover the dependencies the service needs to
+// serve requests: a failing check takes the service out of rotation without
+// restarting it.
+func (srv *MicroService) AddReadinessCheck(name string, check HealthCheck) {
+	srv.addHealthCheck(healthCheck{name: name, check: check, readiness: true})
+}
+
+// AddLivenessCheck adds the check name, run by the liveness and the health
+// endpoints. A failing liveness check means the process must be restarted,
+// so liveness checks should not depend on other services.
+func (srv *MicroService) AddLivenessCheck(name string, check HealthCheck) {
+	srv.addHealthCheck(healthCheck{name: name, check: check})
+}
+
+func (srv *MicroService) addHealthCheck(c healthCheck) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for i, hc := range srv.checks {
+		if hc.name == c.name {
+			srv.checks[i] = c
+			return
+		}
+	}
+	srv.checks = append(srv.checks, c)
+}
+
+// CheckHealth runs every check of the service and reports the result, down
+// if the service is not ready.
+func (srv *MicroService) CheckHealth(ctx context.Context) HealthReport {
+	return srv.checkHealth(ctx, true, true)
+}
+
+// CheckReadiness runs the readiness checks of the service and reports the
+// result, down if the service is not ready.
+func (srv *MicroService) CheckReadiness(ctx context.Context) HealthReport {
+	return srv.checkHealth(ctx, true, false)
+}
+
+// CheckLiveness runs the liveness checks of the service and reports the
+// result. It does not depend on the service being ready, so it stays up
+// while the service shuts down.
+func (srv *MicroService) CheckLiveness(ctx context.Context) HealthReport {
+	return srv.checkHealth(ctx, false, true)
+}
+
+// checkHealth runs the readiness and/or the liveness checks concurrently.
+func (srv *MicroService) checkHealth(ctx context.Context, readiness, liveness bool) HealthReport {
+	srv.mu.Lock()
+	var checks []healthCheck
+	for _, c := range srv.checks {
+		if c.readiness && readiness || !c.readiness && liveness {
+			checks = append(checks, c)
+		}
+	}
+	srv.mu.Unlock()
+
+	report := HealthReport{Status: StatusUp}
+	if readiness && !srv.Ready() {
+		report.Status = StatusDown
+		report.Error = ErrNotReady.Error()
+	}
+	if len(checks) == 0 {
+		return report
+	}
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c healthCheck) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, c.check)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report.Checks = make(map[string]CheckResult, len(checks))
+	for i, c := range checks {
+		report.Checks[c.name] = results[i]
+		if results[i].Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+func runCheck(ctx context.Context, check HealthCheck) CheckResult {
+	if DefaultHealthCheckTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultHealthCheckTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	err := hook{fn: HookFunc(check)}.run(ctx)
+	result := CheckResult{Status: StatusUp, Duration: time.Since(start).String()}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// HealthURL returns the URL of the health endpoint of the service listening
+// on addr, e.g. for the checks of service discovery.
+func (srv *MicroService) HealthURL(scheme, addr string) string {
+	return scheme + "://" + addr + srv.HealthPrefix + HealthPath
+}
+
+// ServeHealth registers the health, readiness and liveness endpoints of the
+// service under HealthPrefix. Serve calls it; an endpoint the router already
+// serves, e.g. a /health of the application, is left alone.
+func (srv *MicroService) ServeHealth() {
+	srv.healthOnce.Do(func() {
+		if srv.Router == nil {
+			return
+		}
+		srv.serveHealth(HealthPath, srv.CheckHealth)
+		srv.serveHealth(ReadyPath, srv.CheckReadiness)
+		srv.serveHealth(LivePath, srv.CheckLiveness)
+	})
+}
+
+func (srv *MicroService) serveHealth(path string, check func(context.Context) HealthReport) {
+	path = srv.HealthPrefix + path
+	if h, _, _ := srv.Router.Lookup(http.MethodGet, path); h != nil {
+		return
+	}
+	defer func() {
+		// the path conflicts with a wildcard route of the application
+		if r := recover(); r != nil {
+			srv.logger.Warn("health endpoint %s not served: %v", path, r)
+		}
+	}()
+	srv.Router.HandlerFunc(http.MethodGet, path, func(w http.ResponseWriter, r *http.Request) {
+		report := check(r.Context())
+		code := http.StatusOK
+		if report.Status != StatusUp {
+			code = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(report)
+	})
+}
+
+// Pinger is implemented by clients which can check their connection, like
+// *sql.DB.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// PingCheck returns a check pinging p, e.g. a database:
+//
+//	srv.AddReadinessCheck("database", grace.PingCheck(db))
+func PingCheck(p Pinger) HealthCheck {
+	return p.PingContext
+}
+
+// DialCheck returns a check connecting to address, e.g. a downstream rpcx
+// server:
+//
+//	srv.AddReadinessCheck("users", grace.DialCheck("tcp", "users:8972"))
+func DialCheck(network, address string) HealthCheck {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, network, address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// DiskSpaceCheck returns a check failing when the file system of path has
+// less than minFree bytes available.
+func DiskSpaceCheck(path string, minFree uint64) HealthCheck {
+	return func(ctx context.Context) error {
+		free, err := diskFree(path)
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("%s: %d bytes free, %d required", path, free, minFree)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package grace
+
+import (
+	"errors"
+	"runtime"
+)
+
+func diskFree(path string) (uint64, error) {
+	return 0, errors.New("disk space check not supported on " + runtime.GOOS)
+}
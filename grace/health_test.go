@@ -0,0 +1,124 @@
+package grace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func healthReport(t *testing.T, srv *MicroService, path string) (int, HealthReport) {
+	w := do(srv, http.MethodGet, path)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	var report HealthReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	return w.Code, report
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	srv := newTestService()
+	srv.ServeHealth()
+
+	code, report := healthReport(t, srv, "/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, code, "not serving yet")
+	assert.Equal(t, ErrNotReady.Error(), report.Error)
+	code, _ = healthReport(t, srv, "/live")
+	assert.Equal(t, http.StatusOK, code)
+
+	srv.setReady(true)
+	dbErr := errors.New("connection refused")
+	srv.AddReadinessCheck("database", func(ctx context.Context) error { return dbErr })
+	srv.AddLivenessCheck("goroutines", func(ctx context.Context) error { return nil })
+
+	code, report = healthReport(t, srv, "/health")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, StatusDown, report.Checks["database"].Status)
+	assert.Equal(t, "connection refused", report.Checks["database"].Error)
+	assert.Equal(t, StatusUp, report.Checks["goroutines"].Status)
+
+	code, report = healthReport(t, srv, "/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.NotContains(t, report.Checks, "goroutines")
+
+	code, report = healthReport(t, srv, "/live")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusUp, report.Status)
+	assert.NotContains(t, report.Checks, "database")
+
+	// a check added again under the same name replaces the first one
+	dbErr = nil
+	srv.AddReadinessCheck("database", func(ctx context.Context) error { return dbErr })
+	code, report = healthReport(t, srv, "/health")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, report.Checks, 2)
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { DefaultHealthCheckTimeout = timeout }(DefaultHealthCheckTimeout)
+	DefaultHealthCheckTimeout = 10 * time.Millisecond
+
+	srv := newTestService()
+	srv.AddLivenessCheck("stuck", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	srv.AddLivenessCheck("panic", func(ctx context.Context) error { panic("boom") })
+	report := srv.CheckLiveness(context.Background())
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["stuck"].Error)
+	assert.Equal(t, "panic: boom", report.Checks["panic"].Error)
+}
+
+func TestHealthEndpointsOfApplication(t *testing.T) {
+	srv := newTestService()
+	srv.HealthPrefix = "/admin"
+	srv.Router.HandlerFunc(http.MethodGet, "/admin/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("mine"))
+	})
+	srv.ServeHealth()
+
+	assert.Equal(t, "mine", do(srv, http.MethodGet, "/admin/health").Body.String())
+	assert.Equal(t, http.StatusOK, do(srv, http.MethodGet, "/admin/live").Code)
+	assert.Equal(t, "http://10.0.0.1:80/admin/health", srv.HealthURL("http", "10.0.0.1:80"))
+}
+
+func TestReadinessDuringShutdown(t *testing.T) {
+	srv := newTestService()
+	url, served := startService(t, srv, srv.Router)
+
+	r, err := http.Get(url + ReadyPath)
+	require.NoError(t, err)
+	r.Body.Close()
+	assert.Equal(t, http.StatusOK, r.StatusCode)
+
+	srv.AddDeregisterer(DeregisterFunc(func() {
+		assert.Equal(t, http.StatusServiceUnavailable, do(srv, http.MethodGet, ReadyPath).Code)
+		assert.Equal(t, http.StatusServiceUnavailable, do(srv, http.MethodGet, HealthPath).Code)
+		assert.Equal(t, http.StatusOK, do(srv, http.MethodGet, LivePath).Code)
+	}))
+	require.NoError(t, srv.Shutdown(context.Background()))
+	assert.NoError(t, <-served)
+}
+
+func TestDialCheck(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	assert.NoError(t, DialCheck("tcp", addr)(context.Background()))
+	l.Close()
+	assert.Error(t, DialCheck("tcp", addr)(context.Background()))
+}
+
+func TestDiskSpaceCheck(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, DiskSpaceCheck(dir, 1)(context.Background()))
+	assert.Error(t, DiskSpaceCheck(dir, math.MaxUint64)(context.Background()))
+}
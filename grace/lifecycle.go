@@ -0,0 +1,151 @@
+package grace
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Phase is a stage of the life of a MicroService at which hooks run.
+type Phase int
+
+const (
+	// PhaseStart hooks run when Serve is called, before requests are
+	// accepted. An error stops Serve.
+	PhaseStart Phase = iota
+	// PhaseReady hooks run once the service is listening and marked ready,
+	// e.g. to register it with service discovery. Errors are logged.
+	PhaseReady
+	// PhaseShutdown hooks run when Shutdown starts, after the service is
+	// marked as not ready and before requests are drained, e.g. to
+	// deregister it from service discovery.
+	PhaseShutdown
+	// PhaseStopped hooks run after requests are drained, e.g. to flush
+	// tracers and close clients.
+	PhaseStopped
+)
+
+var phaseNames = [...]string{"start", "ready", "shutdown", "stopped"}
+
+func (p Phase) String() string {
+	if p < 0 || int(p) >= len(phaseNames) {
+		return fmt.Sprintf("phase(%d)", int(p))
+	}
+	return phaseNames[p]
+}
+
+// DefaultHookTimeout bounds the run of hooks added without WithHookTimeout.
+var DefaultHookTimeout = 30 * time.Second
+
+// HookFunc is a lifecycle hook. ctx is done when the hook times out.
+type HookFunc func(ctx context.Context) error
+
+type hook struct {
+	name    string
+	timeout time.Duration
+	fn      HookFunc
+}
+
+// HookOption configures a lifecycle hook.
+type HookOption func(*hook)
+
+// WithHookName names the hook in logs and in HookError.
+func WithHookName(name string) HookOption {
+	return func(h *hook) { h.name = name }
+}
+
+// WithHookTimeout bounds the run of the hook. A timeout <= 0 leaves it
+// bounded by the context of the phase only.
+func WithHookTimeout(timeout time.Duration) HookOption {
+	return func(h *hook) { h.timeout = timeout }
+}
+
+// HookError is the error of a failed, timed out or panicking hook.
+type HookError struct {
+	Phase Phase
+	Name  string
+	Err   error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("%s hook %q: %v", e.Phase, e.Name, e.Err)
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// OnStart adds f to the hooks of PhaseStart.
+func (srv *MicroService) OnStart(f HookFunc, options ...HookOption) {
+	srv.addHook(PhaseStart, f, options)
+}
+
+// OnReady adds f to the hooks of PhaseReady.
+func (srv *MicroService) OnReady(f HookFunc, options ...HookOption) {
+	srv.addHook(PhaseReady, f, options)
+}
+
+// OnShutdown adds f to the hooks of PhaseShutdown.
+func (srv *MicroService) OnShutdown(f HookFunc, options ...HookOption) {
+	srv.addHook(PhaseShutdown, f, options)
+}
+
+// OnStopped adds f to the hooks of PhaseStopped.
+func (srv *MicroService) OnStopped(f HookFunc, options ...HookOption) {
+	srv.addHook(PhaseStopped, f, options)
+}
+
+func (srv *MicroService) addHook(phase Phase, f HookFunc, options []HookOption) {
+	h := hook{timeout: DefaultHookTimeout, fn: f}
+	for _, option := range options {
+		option(&h)
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if h.name == "" {
+		h.name = fmt.Sprintf("%s#%d", phase, len(srv.hooks[phase]))
+	}
+	if srv.hooks == nil {
+		srv.hooks = make(map[Phase][]hook)
+	}
+	srv.hooks[phase] = append(srv.hooks[phase], h)
+}
+
+// runHooks runs the hooks of phase in the order they were added and returns
+// their errors. Every hook runs, whether the previous ones failed or not.
+func (srv *MicroService) runHooks(ctx context.Context, phase Phase) []error {
+	srv.mu.Lock()
+	hooks := srv.hooks[phase]
+	srv.mu.Unlock()
+
+	var errs []error
+	for _, h := range hooks {
+		if err := h.run(ctx); err != nil {
+			errs = append(errs, &HookError{Phase: phase, Name: h.name, Err: err})
+		}
+	}
+	return errs
+}
+
+func (h hook) run(ctx context.Context) error {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- h.fn(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
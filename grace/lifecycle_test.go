@@ -0,0 +1,132 @@
+package grace
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libra9z/mskit/v4/rest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type phaseRecorder struct {
+	mu     sync.Mutex
+	phases []string
+}
+
+func (r *phaseRecorder) hook(name string, err error) HookFunc {
+	return func(ctx context.Context) error {
+		r.mu.Lock()
+		r.phases = append(r.phases, name)
+		r.mu.Unlock()
+		return err
+	}
+}
+
+func (r *phaseRecorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.phases...)
+}
+
+type flushTracer struct {
+	flushed bool
+}
+
+func (t *flushTracer) GetServiceName() string           { return "svc" }
+func (t *flushTracer) GetTraceName() string             { return "svc" }
+func (t *flushTracer) GetTracer() (string, interface{}) { return "test", nil }
+func (t *flushTracer) HTTPServerTrace(operatename string) rest.ServerOption {
+	return func(*rest.Engine) {}
+}
+func (t *flushTracer) HTTPClientTrace(operatename string) rest.ClientOption {
+	return func(*rest.Client) {}
+}
+func (t *flushTracer) StartRPCClientSpan(ctx context.Context, service, method string, md map[string]string) (context.Context, func(error)) {
+	return ctx, func(error) {}
+}
+func (t *flushTracer) StartRPCServerSpan(ctx context.Context, service, method string, md map[string]string) (context.Context, func(error)) {
+	return ctx, func(error) {}
+}
+func (t *flushTracer) StartSpan(ctx context.Context, name string, tags map[string]string) (context.Context, func(error)) {
+	return ctx, func(error) {}
+}
+func (t *flushTracer) Shutdown(ctx context.Context) error {
+	t.flushed = true
+	return nil
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	srv := newTestService()
+	rec := &phaseRecorder{}
+	errStop := errors.New("stop failed")
+	tracer := &flushTracer{}
+	srv.SetTracer(tracer)
+	srv.SetTracer(tracer)
+
+	srv.OnStart(rec.hook("start1", nil))
+	srv.OnStart(rec.hook("start2", nil))
+	srv.OnReady(func(ctx context.Context) error {
+		assert.True(t, srv.Ready())
+		return rec.hook("ready", nil)(ctx)
+	})
+	srv.OnShutdown(rec.hook("shutdown", nil))
+	srv.OnStopped(rec.hook("stopped1", errStop), WithHookName("db"))
+	srv.OnStopped(rec.hook("stopped2", nil))
+
+	_, served := startService(t, srv, nil)
+	assert.Equal(t, []string{"start1", "start2", "ready"}, rec.get())
+
+	err := srv.Shutdown(context.Background())
+	var he *HookError
+	require.ErrorAs(t, err, &he)
+	assert.Equal(t, PhaseStopped, he.Phase)
+	assert.Equal(t, "db", he.Name)
+	assert.ErrorIs(t, err, errStop)
+	assert.ErrorIs(t, <-served, errStop)
+
+	assert.Equal(t, []string{"start1", "start2", "ready", "shutdown", "stopped1", "stopped2"}, rec.get())
+	assert.True(t, tracer.flushed)
+}
+
+func TestLifecycleStartError(t *testing.T) {
+	srv := newTestService()
+	errStart := errors.New("no database")
+	readyRan := false
+	srv.OnStart(func(ctx context.Context) error { return errStart }, WithHookName("db"))
+	srv.OnReady(func(ctx context.Context) error { readyRan = true; return nil })
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv.Server.Addr = l.Addr().String()
+	srv.GraceListener = newGraceListener(l, srv)
+
+	err = srv.Serve()
+	assert.ErrorIs(t, err, errStart)
+	assert.EqualError(t, err, `start hook "db": no database`)
+	assert.False(t, readyRan)
+	assert.False(t, srv.Ready())
+}
+
+func TestHookTimeoutAndPanic(t *testing.T) {
+	srv := newTestService()
+	srv.OnShutdown(func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(time.Second)
+		return nil
+	}, WithHookTimeout(10*time.Millisecond))
+	srv.OnShutdown(func(ctx context.Context) error {
+		panic("boom")
+	})
+
+	start := time.Now()
+	errs := srv.runHooks(context.Background(), PhaseShutdown)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	require.Len(t, errs, 2)
+	assert.ErrorIs(t, errs[0], context.DeadlineExceeded)
+	assert.EqualError(t, errs[1], `shutdown hook "shutdown#1": panic: boom`)
+}
@@ -29,16 +29,18 @@ func newGraceListener(l net.Listener, srv *MicroService) (el *graceListener) {
 }
 
 func (gl *graceListener) Accept() (c net.Conn, err error) {
-	tc, err := gl.Listener.(*net.TCPListener).AcceptTCP()
+	conn, err := gl.Listener.Accept()
 	if err != nil {
 		return
 	}
 
-	tc.SetKeepAlive(true)
-	tc.SetKeepAlivePeriod(3 * time.Minute)
+	if tc, ok := conn.(*net.TCPConn); ok {
+		tc.SetKeepAlive(true)
+		tc.SetKeepAlivePeriod(3 * time.Minute)
+	}
 
 	c = &graceConn{
-		Conn:   tc,
+		Conn:   conn,
 		server: gl.server,
 	}
 
@@ -54,9 +56,12 @@ func (gl *graceListener) Close() error {
 	return <-gl.stop
 }
 
+// File returns a dup(2) of the listener descriptor - FD_CLOEXEC flag *not*
+// set - or nil if the listener has none.
 func (gl *graceListener) File() *os.File {
-	// returns a dup(2) - FD_CLOEXEC flag *not* set
-	tl := gl.Listener.(*net.TCPListener)
-	fl, _ := tl.File()
-	return fl
+	if l, ok := gl.Listener.(interface{ File() (*os.File, error) }); ok {
+		fl, _ := l.File()
+		return fl
+	}
+	return nil
 }
@@ -10,10 +10,8 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
 	"strconv"
-	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -21,6 +19,7 @@ import (
 	"github.com/libra9z/httprouter"
 	"github.com/libra9z/mskit/v4/endpoint"
 	"github.com/libra9z/mskit/v4/log"
+	"github.com/libra9z/mskit/v4/openapi"
 	"github.com/libra9z/mskit/v4/rest"
 	"github.com/libra9z/mskit/v4/trace"
 )
@@ -37,10 +36,30 @@ type MicroService struct {
 	tlsInnerListener *graceListener
 	wg               sync.WaitGroup
 	sigChan          chan os.Signal
-	isChild          bool
 	state            uint8
 	Network          string
-	Meta             map[string]interface{}
+	// SocketMode is the mode of the socket file of a unix Network, see
+	// ListenUnix.
+	SocketMode os.FileMode
+	// MaxBodySize limits the size of request bodies, see
+	// rest.ServerMaxBodySize. Services may set their own limit.
+	MaxBodySize int64
+	// HealthPrefix is the prefix of the paths of the health endpoints, see
+	// ServeHealth.
+	HealthPrefix string
+	Meta         map[string]interface{}
+
+	mu           sync.Mutex
+	ready        int32
+	hooks        map[Phase][]hook
+	signalsOnce  sync.Once
+	tracerHooked bool
+	shutdownOnce sync.Once
+	shutdownErr  error
+	stopped      chan struct{}
+	routes       []*openapi.Route
+	checks       []healthCheck
+	healthOnce   sync.Once
 }
 
 /**
@@ -71,7 +90,7 @@ func (srv *MicroService) Serve(params ...string) (err error) {
 	}
 	if len(params) > 3 {
 		srv.Network = params[3]
-	} else {
+	} else if srv.Network == "" {
 		srv.Network = "tcp"
 	}
 
@@ -84,14 +103,36 @@ func (srv *MicroService) Serve(params ...string) (err error) {
 
 		srv.GraceListener = newGraceListener(l, srv)
 	}
+	if errs := srv.runHooks(context.Background(), PhaseStart); len(errs) > 0 {
+		for _, e := range errs[1:] {
+			srv.logger.Error("error=%v", e)
+		}
+		srv.GraceListener.Close()
+		return errs[0]
+	}
+
+	srv.mu.Lock()
 	srv.state = StateRunning
+	srv.mu.Unlock()
+	srv.setReady(true)
 	if srv.Server.Handler == nil {
 		srv.Server.Handler = srv.Router
 	}
+	srv.ServeHealth()
+	// the listener is bound, connections queue while the ready hooks run
+	for _, e := range srv.runHooks(context.Background(), PhaseReady) {
+		srv.logger.Error("error=%v", e)
+	}
+	if err := SignalReady(); err != nil {
+		srv.logger.Error("error=%v", err)
+	}
 	err = srv.Server.Serve(srv.GraceListener)
-	srv.logger.Info("Waiting for connections to finish...: %v", syscall.Getpid())
-	srv.wg.Wait()
-	srv.state = StateTerminate
+	if errors.Is(err, http.ErrServerClosed) {
+		srv.logger.Info("Waiting for connections to finish...: %v", syscall.Getpid())
+		<-srv.stoppedChan()
+		return srv.shutdownErr
+	}
+	srv.setReady(false)
 	return
 }
 
@@ -108,7 +149,7 @@ func (srv *MicroService) ListenAndServe(params ...string) (err error) {
 		srv.Server.Addr = params[0] + ":" + params[1]
 	}
 
-	go srv.handleSignals()
+	srv.NotifySignals()
 
 	l, err := srv.getListener(srv.Server.Addr)
 	if err != nil {
@@ -118,17 +159,6 @@ func (srv *MicroService) ListenAndServe(params ...string) (err error) {
 
 	srv.GraceListener = newGraceListener(l, srv)
 
-	if srv.isChild {
-		process, err := os.FindProcess(os.Getppid())
-		if err != nil {
-			srv.logger.Error("error=%v", err)
-			return err
-		}
-		err = process.Signal(syscall.SIGTERM)
-		if err != nil {
-			return err
-		}
-	}
 	srv.logger.Info("address=%s,pid=%d", srv.Server.Addr, os.Getpid())
 	return srv.Serve(params...)
 }
@@ -164,7 +194,7 @@ func (srv *MicroService) ListenAndServeTLS(certFile, keyFile string, params ...s
 		return
 	}
 
-	go srv.handleSignals()
+	srv.NotifySignals()
 
 	l, err := srv.getListener(srv.Server.Addr)
 	if err != nil {
@@ -175,17 +205,6 @@ func (srv *MicroService) ListenAndServeTLS(certFile, keyFile string, params ...s
 	srv.tlsInnerListener = newGraceListener(l, srv)
 	srv.GraceListener = tls.NewListener(srv.tlsInnerListener, srv.Server.TLSConfig)
 
-	if srv.isChild {
-		process, err := os.FindProcess(os.Getppid())
-		if err != nil {
-			srv.logger.Error("error=%v", err)
-			return err
-		}
-		err = process.Signal(syscall.SIGTERM)
-		if err != nil {
-			return err
-		}
-	}
 	srv.logger.Info("address=%s,pid=%d", srv.Server.Addr, os.Getpid())
 	return srv.Serve(params...)
 }
@@ -222,7 +241,7 @@ func (srv *MicroService) ListenAndServeMutualTLS(certFile, keyFile, trustFile st
 	}
 	pool.AppendCertsFromPEM(data)
 	srv.Server.TLSConfig.ClientCAs = pool
-	go srv.handleSignals()
+	srv.NotifySignals()
 
 	l, err := srv.getListener(srv.Server.Addr)
 	if err != nil {
@@ -233,66 +252,53 @@ func (srv *MicroService) ListenAndServeMutualTLS(certFile, keyFile, trustFile st
 	srv.tlsInnerListener = newGraceListener(l, srv)
 	srv.GraceListener = tls.NewListener(srv.tlsInnerListener, srv.Server.TLSConfig)
 
-	if srv.isChild {
-		process, err := os.FindProcess(os.Getppid())
-		if err != nil {
-			srv.logger.Error("error=%v", err)
-			return err
-		}
-		err = process.Kill()
-		if err != nil {
-			return err
-		}
-	}
 	srv.logger.Info("address=%s,pid=%d", srv.Server.Addr, os.Getpid())
 	return srv.Serve(params...)
 }
 
-// getListener either opens a new socket to listen on, or takes the acceptor socket
-// it got passed when restarted.
+// getListener opens the listener of the service, or takes over the one of
+// the parent process when started by Restart, see Listen.
 func (srv *MicroService) getListener(laddr string) (l net.Listener, err error) {
-	if srv.isChild {
-		var ptrOffset uint
-		if len(socketPtrOffsetMap) > 0 {
-			ptrOffset = socketPtrOffsetMap[laddr]
-			srv.logger.Info("laddr=%s,ptr offset=%d", laddr, socketPtrOffsetMap[laddr])
-		}
-
-		f := os.NewFile(uintptr(3+ptrOffset), "")
-		l, err = net.FileListener(f)
-		if err != nil {
-			err = fmt.Errorf("net.FileListener error: %v", err)
-			return
-		}
+	if srv.Network == "" {
+		srv.Network = "tcp"
+	}
+	if srv.Network == "unix" {
+		l, err = ListenUnix(laddr, srv.SocketMode)
 	} else {
-		l, err = net.Listen(srv.Network, laddr)
-		if err != nil {
-			err = fmt.Errorf("net.Listen error: %v", err)
-			return
-		}
+		l, err = Listen(srv.Network, laddr)
+	}
+	if err != nil {
+		err = fmt.Errorf("grace.Listen error: %v", err)
 	}
 	return
 }
 
+// NotifySignals starts handling SIGHUP, SIGINT and SIGTERM for the service,
+// see handleSignals. It is called by the ListenAndServe functions; calling it
+// again has no effect, so there is a single signal loop per service.
+func (srv *MicroService) NotifySignals() {
+	srv.signalsOnce.Do(func() {
+		if srv.sigChan == nil {
+			srv.sigChan = make(chan os.Signal, 1)
+		}
+		signal.Notify(srv.sigChan, hookableSignals...)
+		go srv.handleSignals()
+	})
+}
+
 // handleSignals listens for os Signals and calls any hooked in function that the
 // user had registered with the signal.
 func (srv *MicroService) handleSignals() {
 	var sig os.Signal
 
-	signal.Notify(
-		srv.sigChan,
-		hookableSignals...,
-	)
-
 	pid := syscall.Getpid()
 	for {
 		sig = <-srv.sigChan
 		srv.signalHooks(PreSignal, sig)
 		switch sig {
 		case syscall.SIGHUP:
-			fmt.Println("Received SIGHUP. forking.", pid)
-			err := srv.fork()
-			if err != nil {
+			fmt.Println("Received SIGHUP. restarting.", pid)
+			if err := srv.restart(); err != nil {
 				srv.logger.Error("error=%v", err)
 			}
 		case syscall.SIGINT:
@@ -317,94 +323,47 @@ func (srv *MicroService) signalHooks(ppFlag int, sig os.Signal) {
 	}
 }
 
-// shutdown closes the listener so that no new connections are accepted. it also
-// starts a goroutine that will serverTimeout (stop all running requests) the server
-// after DefaultTimeout.
+// shutdown calls Shutdown with a DefaultTimeout deadline, or none if
+// DefaultTimeout is negative.
 func (srv *MicroService) shutdown() {
-	if srv.state != StateRunning {
-		return
-	}
-
-	srv.state = StateShuttingDown
+	ctx := context.Background()
 	if DefaultTimeout >= 0 {
-		go srv.serverTimeout(DefaultTimeout)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
 	}
-	err := srv.GraceListener.Close()
-	if err != nil {
-		fmt.Printf("pid=%v,Listener.Close() error: %v\n", syscall.Getpid(), err)
+	if err := srv.Shutdown(ctx); err != nil {
+		srv.logger.Error("pid=%v,shutdown error=%v", syscall.Getpid(), err)
 	} else {
-		fmt.Printf("pid=%v,address=%v,Listener closed.", syscall.Getpid(), srv.GraceListener.Addr())
+		srv.logger.Info("pid=%v,address=%v,server stopped.", syscall.Getpid(), srv.Server.Addr)
 	}
 }
 
-// serverTimeout forces the server to shutdown in a given timeout - whether it
-// finished outstanding requests or not. if Read/WriteTimeout are not set or the
-// max header size is very big a connection could hang
-func (srv *MicroService) serverTimeout(d time.Duration) {
-	defer func() {
-		if r := recover(); r != nil {
-			srv.logger.Error("error=%v", r)
-		}
-	}()
-	if srv.state != StateShuttingDown {
-		return
-	}
-	time.Sleep(d)
-	fmt.Println("[STOP - Hammer Time] Forcefully shutting down parent")
-	for {
-		if srv.state == StateTerminate {
-			break
-		}
-		srv.wg.Done()
+// restart hands the listeners of the process to a new instance, see
+// Restart, and shuts the service down once the new instance is ready. Every
+// service of the process receiving SIGHUP shares the same new instance.
+func (srv *MicroService) restart() error {
+	if err := restartShared(Restart); err != nil {
+		return err
 	}
+	srv.shutdown()
+	return nil
 }
 
-func (srv *MicroService) fork() (err error) {
-	regLock.Lock()
-	defer regLock.Unlock()
-	if runningServersForked {
-		return
-	}
-	runningServersForked = true
-
-	var files = make([]*os.File, len(runningServers))
-	var orderArgs = make([]string, len(runningServers))
-	for _, srvPtr := range runningServers {
-		switch srvPtr.GraceListener.(type) {
-		case *graceListener:
-			files[socketPtrOffsetMap[srvPtr.Server.Addr]] = srvPtr.GraceListener.(*graceListener).File()
-		default:
-			files[socketPtrOffsetMap[srvPtr.Server.Addr]] = srvPtr.tlsInnerListener.File()
-		}
-		orderArgs[socketPtrOffsetMap[srvPtr.Server.Addr]] = srvPtr.Server.Addr
-	}
-
-	fmt.Println(files)
-	path := os.Args[0]
-	var args []string
-	if len(os.Args) > 1 {
-		for _, arg := range os.Args[1:] {
-			if arg == "-graceful" {
-				break
-			}
-			args = append(args, arg)
-		}
+// restartShared calls start unless a previous call succeeded. A failed
+// restart, e.g. of a new instance which was never ready, is tried again on
+// the next call.
+func restartShared(start func() error) error {
+	restartedMu.Lock()
+	defer restartedMu.Unlock()
+	if restarted {
+		return nil
 	}
-	args = append(args, "-graceful")
-	if len(runningServers) > 1 {
-		args = append(args, fmt.Sprintf(`-socketorder=%s`, strings.Join(orderArgs, ",")))
-		fmt.Println(args)
-	}
-	cmd := exec.Command(path, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.ExtraFiles = files
-	err = cmd.Start()
-	if err != nil {
-		fmt.Errorf("Restart: Failed to launch, error: %v\n", err)
+	if err := start(); err != nil {
+		return err
 	}
-
-	return
+	restarted = true
+	return nil
 }
 
 // RegisterSignalHook registers a function to be run PreSignal or PostSignal for a given signal.
@@ -423,7 +382,13 @@ func (srv *MicroService) RegisterSignalHook(ppFlag int, sig os.Signal, f func())
 	return
 }
 
+// NewRestEndpoint returns an endpoint calling the method of svc matching the
+// request method. Requests for methods svc does not implement fail with a
+// *rest.MethodNotAllowedError allowing the other rest.AllowedMethods of svc,
+// whatever svc.PropagateErrors() reports.
 func (srv *MicroService) NewRestEndpoint(svc rest.RestService) endpoint.Endpoint {
+	methods := rest.AllowedMethods(svc)
+
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 
 		if request == nil {
@@ -451,16 +416,38 @@ func (srv *MicroService) NewRestEndpoint(svc rest.RestService) endpoint.Endpoint
 			ret, err = svc.Options(ctx, req)
 		case "TRACE":
 			ret, err = svc.Trace(ctx, req)
-		case "CONNECT":
+		default:
+			err = rest.ErrMethodNotAllowed
 		}
 
 		if err != nil {
+			if errors.Is(err, rest.ErrMethodNotAllowed) {
+				var mna *rest.MethodNotAllowedError
+				if errors.As(err, &mna) {
+					return nil, err
+				}
+				return nil, &rest.MethodNotAllowedError{Allow: allowedMethods(methods, req.Method)}
+			}
+			if ep, ok := svc.(rest.ErrorPropagator); ok && ep.PropagateErrors() {
+				return nil, err
+			}
 			return svc.GetErrorResponse(), nil
 		}
 		return ret, nil
 	}
 }
 
+// allowedMethods returns methods without the unimplemented one.
+func allowedMethods(methods []string, unimplemented string) []string {
+	var allow []string
+	for _, m := range methods {
+		if m != unimplemented {
+			allow = append(allow, m)
+		}
+	}
+	return allow
+}
+
 func (srv *MicroService) NewEndpoint() endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 
@@ -482,8 +469,27 @@ func (srv *MicroService) GetLogger() log.Logger {
 	return srv.logger
 }
 
+// SetTracer sets the tracer of the service. A tracer with a
+// Shutdown(context.Context) error method is shut down, flushing its spans,
+// in PhaseStopped.
 func (srv *MicroService) SetTracer(tracer trace.Tracer) {
+	srv.mu.Lock()
 	srv.tracer = tracer
+	hook := tracer != nil && !srv.tracerHooked
+	srv.tracerHooked = srv.tracerHooked || hook
+	srv.mu.Unlock()
+
+	if hook {
+		srv.OnStopped(func(ctx context.Context) error {
+			srv.mu.Lock()
+			tracer := srv.tracer
+			srv.mu.Unlock()
+			if s, ok := tracer.(interface{ Shutdown(context.Context) error }); ok {
+				return s.Shutdown(ctx)
+			}
+			return nil
+		}, WithHookName("tracer"))
+	}
 }
 
 func (srv *MicroService) GetTracer() trace.Tracer {
@@ -504,24 +510,8 @@ func (srv *MicroService) NewHttpHandler(withTracer bool, path string, r rest.Res
 		svc = middlewares[i].GetMiddleware()(middlewares[i].Object)(svc)
 	}
 
-	var options []rest.ServerOption
-
-	if srv.tracer != nil {
-		if withTracer {
-			options = append(options, []rest.ServerOption{
-				rest.ServerErrorHandler(rest.NewLogErrorHandler(srv.logger)),
-				srv.tracer.HTTPServerTrace(path),
-			}...)
-		} else {
-			options = append(options, []rest.ServerOption{
-				rest.ServerErrorHandler(rest.NewLogErrorHandler(srv.logger)),
-			}...)
-		}
-	} else {
-		options = append(options, []rest.ServerOption{
-			rest.ServerErrorHandler(rest.NewLogErrorHandler(srv.logger)),
-		}...)
-	}
+	options := srv.serverOptions(withTracer, path)
+	options = append(options, rest.ServerErrorEncoder(r.ErrorEncoder))
 
 	var before []rest.RequestFunc
 
@@ -546,105 +536,94 @@ func (srv *MicroService) NewHttpHandler(withTracer bool, path string, r rest.Res
 	return handler
 }
 
-func (srv *MicroService) RegisterServiceWithTracer(path string, rest rest.RestService, tracer trace.Tracer, logger log.Logger, middlewares ...rest.RestMiddleware) {
+// serverOptions returns the error handler, the body size limit and, if
+// withTracer is set and the service has a tracer, the tracing options of the
+// engines serving path.
+func (srv *MicroService) serverOptions(withTracer bool, path string) []rest.ServerOption {
+	options := []rest.ServerOption{
+		rest.ServerErrorHandler(rest.NewLogErrorHandler(srv.logger)),
+	}
+	if srv.MaxBodySize != 0 {
+		options = append(options, rest.ServerMaxBodySize(srv.MaxBodySize))
+	}
+	if srv.tracer != nil && withTracer {
+		options = append(options, srv.tracer.HTTPServerTrace(path))
+	}
+	return options
+}
+
+func (srv *MicroService) RegisterServiceWithTracer(path string, svc rest.RestService, tracer trace.Tracer, logger log.Logger, middlewares ...rest.RestMiddleware) {
 
 	srv.SetLogger(logger)
 	srv.SetTracer(tracer)
 
-	handler := srv.NewHttpHandler(true, path, rest, middlewares...)
-	regRoute(srv.Router, path, handler)
+	handler := srv.NewHttpHandler(true, path, svc, middlewares...)
+	srv.regRoute(path, handler, rest.ServiceMethods(svc)...)
 }
 
-func (srv *MicroService) RegisterRestService(path string, rest rest.RestService, middlewares ...rest.RestMiddleware) {
-
-	handler := srv.NewHttpHandler(false, path, rest, middlewares...)
-	regRoute(srv.Router, path, handler)
+// Handle registers ep for method and path, see RouteGroup.Handle.
+//
+//	srv.Handle(http.MethodPost, "/users", rest.Handle(createUser))
+func (srv *MicroService) Handle(method, path string, ep endpoint.Endpoint, middlewares ...rest.RestMiddleware) {
+	srv.Group("").Handle(method, path, ep, middlewares...)
 }
 
-func (srv *MicroService) Handler(method, path string, ohandler http.Handler, middlewares ...rest.RestMiddleware) {
+// RegisterRestService registers svc for path, on the methods listed by
+// rest.ServiceMethods.
+func (srv *MicroService) RegisterRestService(path string, svc rest.RestService, middlewares ...rest.RestMiddleware) {
 
-	//handler := srv.NewHttpHandler(false, path, rest, middlewares...)
-	handler := ohandler
-	srv.Router.Handler(method, path, handler)
+	handler := srv.NewHttpHandler(false, path, svc, middlewares...)
+	srv.regRoute(path, handler, rest.ServiceMethods(svc)...)
 }
+
+// Handler registers h for method and path. h is served through a rest.Engine,
+// so middlewares wrap it and the service tracer, if any, traces it.
+func (srv *MicroService) Handler(method, path string, h http.Handler, middlewares ...rest.RestMiddleware) {
+	srv.regRoute(path, srv.NewHandler(true, path, h, middlewares...), method)
+}
+
+// HandlerFunc sets the tracer and the logger of the service, then registers
+// handlerFunc for method and path like Handler.
 func (srv *MicroService) HandlerFunc(method, path string, handlerFunc http.HandlerFunc, tracer trace.Tracer, logger log.Logger, middlewares ...rest.RestMiddleware) {
 
 	srv.SetTracer(tracer)
 	srv.SetLogger(logger)
 
-	//handler := srv.NewHandlerFunc(false, path, rest, middlewares...)
-	handler := srv.NewHandlerFunc(true, path, handlerFunc, middlewares...)
-
-	srv.Router.Handler(method, path, handler)
-	//srv.Router.HandlerFunc(method, path, handler)
+	srv.regRoute(path, srv.NewHandler(true, path, handlerFunc, middlewares...), method)
 }
 
-func (srv *MicroService) NewHandlerFunc(withTracer bool, path string, handlerFunc http.HandlerFunc, middlewares ...rest.RestMiddleware) http.HandlerFunc {
+// NewHandler returns a rest.Engine serving requests with h, see
+// rest.NewHandlerEngine. The endpoint calling h is wrapped by middlewares,
+// and traced as path if withTracer is set and the service has a tracer.
+func (srv *MicroService) NewHandler(withTracer bool, path string, h http.Handler, middlewares ...rest.RestMiddleware) *rest.Engine {
 
-	return func(w http.ResponseWriter, req *http.Request) {
+	svc := rest.HandlerEndpoint(h)
 
-		svc := srv.NewEndpoint()
+	for i := 0; i < len(middlewares); i++ {
+		svc = middlewares[i].GetMiddleware()(middlewares[i].Object)(svc)
+	}
 
-		for i := 0; i < len(middlewares); i++ {
-			svc = middlewares[i].GetMiddleware()(middlewares[i].Object)(svc)
-		}
+	return rest.NewEngine(
+		svc,
+		rest.DecodeHandlerRequest,
+		rest.NopResponseEncoder,
+		srv.serverOptions(withTracer, path)...,
+	)
+}
 
-		var options []rest.ServerOption
-
-		if srv.tracer != nil {
-			if withTracer {
-				options = append(options, []rest.ServerOption{
-					rest.ServerErrorHandler(rest.NewLogErrorHandler(srv.logger)),
-					srv.tracer.HTTPServerTrace(path),
-				}...)
-			} else {
-				options = append(options, []rest.ServerOption{
-					rest.ServerErrorHandler(rest.NewLogErrorHandler(srv.logger)),
-				}...)
-			}
-		} else {
-			options = append(options, []rest.ServerOption{
-				rest.ServerErrorHandler(rest.NewLogErrorHandler(srv.logger)),
-			}...)
-		}
+// NewHandlerFunc is NewHandler for an http.HandlerFunc.
+func (srv *MicroService) NewHandlerFunc(withTracer bool, path string, handlerFunc http.HandlerFunc, middlewares ...rest.RestMiddleware) http.HandlerFunc {
+	return srv.NewHandler(withTracer, path, handlerFunc, middlewares...).ServeHTTP
+}
 
-		//h:= func() rest.Middleware{
-		//	return func(next endpoint.Endpoint) endpoint.Endpoint {
-		//		return func(ctx context.Context, request interface{}) (interface{}, error) {
-		//			if request == nil {
-		//				return nil, errors.New("no request available")
-		//			}
-		//
-		//			m := request.(*rest.Mcontext)
-		//			handlerFunc(w, req)
-		//			return next(ctx, m)
-		//		}
-		//	}
-		//}()
-		//svc = h(svc)
-		//
-		//handler := rest.NewEngine(
-		//	svc,
-		//	r.DecodeRequest,
-		//	rest.EncodeResponse,
-		//	options...,
-		//)
-		//
-		//handler.ServeHTTP(w,req)
-		handlerFunc(w, req)
-	}
-}
-
-func regRoute(r *httprouter.Router, path string, handler http.Handler) {
-
-	r.Handler("GET", path, handler)
-	r.Handler("POST", path, handler)
-	r.Handler("PUT", path, handler)
-	r.Handler("PATCH", path, handler)
-	r.Handler("DELETE", path, handler)
-	r.Handler("HEAD", path, handler)
-	r.Handler("OPTIONS", path, handler)
-	r.Handler("TRACE", path, handler)
+// regRoute registers handler for path and each of methods, and records the
+// routes for the OpenAPI document of the service. The router answers other
+// methods with 405 and an Allow header.
+func (srv *MicroService) regRoute(path string, handler http.Handler, methods ...string) {
+	for _, method := range methods {
+		srv.Router.Handler(method, path, handler)
+		srv.addRoute(method, path)
+	}
 }
 
 func (srv *MicroService) ServeFiles(path string, root http.FileSystem) {
@@ -0,0 +1,69 @@
+package grace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/libra9z/mskit/v4/endpoint"
+	"github.com/libra9z/mskit/v4/rest"
+	"github.com/stretchr/testify/assert"
+)
+
+var errNotFound = errors.New("not found")
+
+type failingService struct {
+	rest.RestApi
+}
+
+func (s *failingService) Get(ctx context.Context, r *rest.Mcontext) (interface{}, error) {
+	return nil, errNotFound
+}
+
+func (s *failingService) GetErrorResponse() interface{} {
+	return rest.H{"error": "legacy"}
+}
+
+func TestNewRestEndpointErrors(t *testing.T) {
+	srv := &MicroService{}
+	svc := &failingService{}
+	req := &rest.Mcontext{Method: http.MethodGet}
+
+	// legacy behavior: the error is swallowed.
+	resp, err := srv.NewRestEndpoint(svc)(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, rest.H{"error": "legacy"}, resp)
+
+	svc.SetPropagateErrors(true)
+	resp, err = srv.NewRestEndpoint(svc)(context.Background(), req)
+	assert.ErrorIs(t, err, errNotFound)
+	assert.Nil(t, resp)
+}
+
+func TestHandlerMiddlewares(t *testing.T) {
+	srv := newTestService()
+	calls := 0
+	srv.Handler(http.MethodPost, "/legacy/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "%s %s", r.Context().Value(chainKey{}), body)
+	}), rest.RestMiddleware{Middle: func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			calls++
+			return next(context.WithValue(ctx, chainKey{}, "traced"), request)
+		}
+	}})
+
+	for i := 1; i <= 2; i++ {
+		w := httptest.NewRecorder()
+		srv.Router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/legacy/1", strings.NewReader("payload")))
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "traced payload", w.Body.String())
+		assert.Equal(t, i, calls)
+	}
+}
@@ -0,0 +1,85 @@
+package grace
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/libra9z/mskit/v4/openapi"
+	"github.com/libra9z/mskit/v4/rest"
+)
+
+// addRoute records the route for method and path, once, and returns it.
+func (srv *MicroService) addRoute(method, path string) *openapi.Route {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for _, r := range srv.routes {
+		if r.Method == method && r.Path == path {
+			return r
+		}
+	}
+	r := &openapi.Route{Method: method, Path: path}
+	srv.routes = append(srv.routes, r)
+	return r
+}
+
+// Route returns the route registered for method and path, to document it,
+// or nil if there is none:
+//
+//	srv.Route(http.MethodGet, "/users/:id").Doc("Get a user", "users").Types(getUser{}, User{})
+func (srv *MicroService) Route(method, path string) *openapi.Route {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for _, r := range srv.routes {
+		if r.Method == method && r.Path == path {
+			return r
+		}
+	}
+	return nil
+}
+
+// Routes returns the routes registered with the service, in the order they
+// were registered.
+func (srv *MicroService) Routes() []*openapi.Route {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return append([]*openapi.Route(nil), srv.routes...)
+}
+
+// OpenAPI returns the OpenAPI document of the routes of the service. It can
+// be written to a file, e.g. from a test, with Document.WriteFile.
+func (srv *MicroService) OpenAPI(info openapi.Info) *openapi.Document {
+	return openapi.Build(info, srv.Routes())
+}
+
+// ServeOpenAPI serves the OpenAPI document of the service at path, as YAML
+// if path ends with .yaml or .yml and as JSON otherwise. The document is
+// generated for each request, so it includes the routes registered after
+// ServeOpenAPI; path itself is not documented.
+func (srv *MicroService) ServeOpenAPI(path string, info openapi.Info) {
+	asYAML := strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml")
+	srv.Router.HandlerFunc(http.MethodGet, path, func(w http.ResponseWriter, r *http.Request) {
+		doc := srv.OpenAPI(info)
+		var b []byte
+		var err error
+		if asYAML {
+			w.Header().Set("Content-Type", "application/yaml")
+			b, err = doc.YAML()
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+			b, err = doc.JSON()
+		}
+		if err != nil {
+			rest.ProblemErrorEncoder(r.Context(), err, w)
+			return
+		}
+		w.Write(b)
+	})
+}
+
+// HandleTyped registers rest.Handle(f) for method and relativePath on g, and
+// documents the route with the request and response types of f.
+func HandleTyped[Req any, Resp any](g *RouteGroup, method, relativePath string, f func(context.Context, *Req) (*Resp, error), middlewares ...rest.RestMiddleware) *openapi.Route {
+	g.Handle(method, relativePath, rest.Handle(f), middlewares...)
+	return g.srv.Route(method, joinPaths(g.prefix, relativePath)).Types(new(Req), new(Resp))
+}
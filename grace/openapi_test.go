@@ -0,0 +1,73 @@
+package grace
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/libra9z/mskit/v4/openapi"
+	"github.com/libra9z/mskit/v4/rest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type createItem struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type itemResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	srv := newTestService()
+	g := srv.Group("/api")
+	HandleTyped(g, http.MethodPost, "/items", func(ctx context.Context, req *createItem) (*itemResponse, error) {
+		return &itemResponse{ID: "1", Name: req.Name}, nil
+	}).Doc("Create an item", "items")
+	g.RegisterRestService("/status", &getOnlyService{})
+	srv.ServeOpenAPI("/openapi.json", openapi.Info{Title: "items", Version: "1.0"})
+	srv.ServeOpenAPI("/openapi.yaml", openapi.Info{Title: "items", Version: "1.0"})
+
+	require.NotNil(t, srv.Route(http.MethodGet, "/api/status"))
+	srv.Route(http.MethodGet, "/api/status").Doc("Status")
+	assert.Nil(t, srv.Route(http.MethodGet, "/openapi.json"), "the document is not documented")
+
+	w := do(srv, http.MethodGet, "/openapi.json")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var doc openapi.Document
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+
+	post := doc.Paths["/api/items"]["post"]
+	require.NotNil(t, post)
+	assert.Equal(t, "Create an item", post.Summary)
+	assert.Equal(t, []string{"items"}, post.Tags)
+	require.NotNil(t, post.RequestBody)
+	assert.Equal(t, "#/components/schemas/createItem", post.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Equal(t, []string{"name"}, doc.Components.Schemas["createItem"].Required)
+	assert.Equal(t, "#/components/schemas/itemResponse", post.Responses["200"].Content["application/json"].Schema.Ref)
+	require.NotNil(t, doc.Paths["/api/status"]["get"])
+	assert.Equal(t, "Status", doc.Paths["/api/status"]["get"].Summary)
+
+	w = do(srv, http.MethodGet, "/openapi.yaml")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/yaml", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "/api/items:")
+}
+
+func TestHandleTypedServes(t *testing.T) {
+	srv := newTestService()
+	HandleTyped(srv.Group(""), http.MethodGet, "/items/:id", func(ctx context.Context, req *struct {
+		ID string `uri:"id"`
+	}) (*rest.H, error) {
+		return &rest.H{"id": req.ID}, nil
+	})
+
+	w := do(srv, http.MethodGet, "/items/7")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id":"7"}`, w.Body.String())
+	assert.Len(t, srv.Routes(), 1)
+}
@@ -0,0 +1,304 @@
+package grace
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment of a process started by Restart. The listeners are passed as
+// file descriptors 3 to 3+N-1, named in the same order by
+// MSKIT_LISTEN_NAMES, and MSKIT_READY_FD is the write end of a pipe the
+// process writes to once it serves (see SignalReady).
+const (
+	EnvListenFDs   = "MSKIT_LISTEN_FDS"
+	EnvListenNames = "MSKIT_LISTEN_NAMES"
+	EnvReadyFD     = "MSKIT_READY_FD"
+)
+
+const listenFDsStart = 3
+
+// RestartReadyTimeout is how long Restart waits for the new process to
+// signal it is ready before killing it.
+var RestartReadyTimeout = 60 * time.Second
+
+var (
+	listenersMu sync.Mutex
+	// active are the listeners opened by Listen, handed to the new process
+	// on Restart.
+	active = map[string]*listener{}
+
+	inheritOnce sync.Once
+	inherited   map[string]*os.File
+	readyPipe   *os.File
+	isChild     bool
+
+	restartMu sync.Mutex
+
+	// restartedMu guards restarted, set once the instance started on SIGHUP
+	// is ready, so the services of a process share it.
+	restartedMu sync.Mutex
+	restarted   bool
+)
+
+// listener is a listener opened by Listen. It is forgotten when closed, so
+// it is not handed to the next process any more.
+type listener struct {
+	net.Listener
+	key string
+}
+
+func (l *listener) Close() error {
+	listenersMu.Lock()
+	if active[l.key] == l {
+		delete(active, l.key)
+	}
+	listenersMu.Unlock()
+	return l.Listener.Close()
+}
+
+// File returns a dup of the descriptor of the listener.
+func (l *listener) File() (*os.File, error) {
+	f, ok := l.Listener.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, fmt.Errorf("listener %s cannot be passed on", l.key)
+	}
+	return f.File()
+}
+
+func listenerKey(network, address string) string {
+	return network + "://" + address
+}
+
+// Listen returns a listener for network and address, as net.Listen does. In
+// a process started by Restart, the listener of the parent process for the
+// same network and address is reused, so no connection is refused during
+// the restart. Otherwise the listener passed by systemd socket activation
+// for the address is used, see NetworkSystemd. Listeners opened by Listen
+// are handed to the next process by Restart until they are closed. TCP and
+// unix networks are supported; TLS is layered on top by the caller.
+func Listen(network, address string) (net.Listener, error) {
+	inheritOnce.Do(loadInherited)
+	activationOnce.Do(loadActivated)
+
+	key := listenerKey(network, address)
+	l, err := inheritedListener(key)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		l = takeActivated(network, address)
+	}
+	if l == nil {
+		if network == NetworkSystemd {
+			if activationErr != nil {
+				return nil, activationErr
+			}
+			return nil, fmt.Errorf("no systemd listener named %q", address)
+		}
+		if l, err = listen(network, address); err != nil {
+			return nil, err
+		}
+	}
+
+	ml := &listener{Listener: l, key: key}
+	listenersMu.Lock()
+	active[key] = ml
+	listenersMu.Unlock()
+	return ml, nil
+}
+
+func inheritedListener(key string) (net.Listener, error) {
+	listenersMu.Lock()
+	f := inherited[key]
+	delete(inherited, key)
+	listenersMu.Unlock()
+	if f == nil {
+		return nil, nil
+	}
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("inherited listener %s: %v", key, err)
+	}
+	return l, nil
+}
+
+// loadInherited reads the listeners and the ready pipe passed by Restart.
+// The variables are removed from the environment, so processes started
+// later do not mistake the descriptors for theirs.
+func loadInherited() {
+	n, _ := strconv.Atoi(os.Getenv(EnvListenFDs))
+	names := strings.Split(os.Getenv(EnvListenNames), ",")
+	readyFD, _ := strconv.Atoi(os.Getenv(EnvReadyFD))
+	os.Unsetenv(EnvListenFDs)
+	os.Unsetenv(EnvListenNames)
+	os.Unsetenv(EnvReadyFD)
+
+	inherited = map[string]*os.File{}
+	for i := 0; i < n && i < len(names); i++ {
+		fd := listenFDsStart + i
+		inherited[names[i]] = os.NewFile(uintptr(fd), names[i])
+	}
+	if readyFD >= listenFDsStart {
+		readyPipe = os.NewFile(uintptr(readyFD), "ready")
+	}
+	isChild = n > 0 || readyPipe != nil
+}
+
+// IsChild reports whether the process was started by Restart.
+func IsChild() bool {
+	inheritOnce.Do(loadInherited)
+	return isChild
+}
+
+// SignalReady tells the process that started this one with Restart that it
+// serves, so the parent can drain and exit. Serve calls it once the service
+// is ready; processes serving rpcx only call it themselves. It does nothing
+// if the process was not started by Restart or already signaled.
+func SignalReady() error {
+	inheritOnce.Do(loadInherited)
+	listenersMu.Lock()
+	p := readyPipe
+	readyPipe = nil
+	listenersMu.Unlock()
+	if p == nil {
+		return nil
+	}
+	defer p.Close()
+	_, err := p.Write([]byte{1})
+	return err
+}
+
+// Restart starts a new instance of the running executable, with the same
+// arguments, and hands it the listeners opened by Listen. It returns once
+// the new process signaled it is ready, or with an error if it exited or
+// did not get ready within RestartReadyTimeout; the caller keeps serving in
+// that case. On success the caller is expected to shut down.
+func Restart() error {
+	path, err := os.Executable()
+	if err != nil {
+		path = os.Args[0]
+	}
+	return restart(path, os.Args[1:], nil)
+}
+
+func restart(path string, args []string, env []string) error {
+	restartMu.Lock()
+	defer restartMu.Unlock()
+
+	listenersMu.Lock()
+	var files []*os.File
+	var names []string
+	var unix []*net.UnixListener
+	var err error
+	for key, l := range active {
+		if ul, ok := l.Listener.(*net.UnixListener); ok {
+			// the socket file now belongs to the new process as well
+			ul.SetUnlinkOnClose(false)
+			unix = append(unix, ul)
+		}
+		var f *os.File
+		if f, err = l.File(); err != nil {
+			break
+		}
+		files = append(files, f)
+		names = append(names, key)
+	}
+	listenersMu.Unlock()
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+		if err != nil {
+			for _, ul := range unix {
+				ul.SetUnlinkOnClose(true)
+			}
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(files, w)
+	cmd.Env = append(restartEnv(env),
+		EnvListenFDs+"="+strconv.Itoa(len(files)),
+		EnvListenNames+"="+strings.Join(names, ","),
+		EnvReadyFD+"="+strconv.Itoa(listenFDsStart+len(files)),
+	)
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		err = fmt.Errorf("restart: %v", err)
+		return err
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	ready := make(chan error, 1)
+	go func() {
+		var b [1]byte
+		_, err := r.Read(b[:])
+		if err == io.EOF {
+			err = errors.New("new process closed the ready pipe")
+		}
+		ready <- err
+	}()
+
+	select {
+	case err = <-ready:
+	case <-time.After(RestartReadyTimeout):
+		err = errors.New("new process is not ready")
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		select {
+		case e := <-exited:
+			if e != nil {
+				err = fmt.Errorf("%v: %v", err, e)
+			}
+		case <-time.After(time.Second):
+		}
+		err = fmt.Errorf("restart: %v", err)
+		return err
+	}
+	return nil
+}
+
+// restartEnv returns the environment of the process, or env if set, without
+// the variables of the restart protocol and of systemd socket activation.
+func restartEnv(env []string) []string {
+	if env == nil {
+		env = os.Environ()
+	}
+	out := make([]string, 0, len(env))
+	for _, kv := range env {
+		if strings.HasPrefix(kv, EnvListenFDs+"=") ||
+			strings.HasPrefix(kv, EnvListenNames+"=") ||
+			strings.HasPrefix(kv, EnvReadyFD+"=") ||
+			strings.HasPrefix(kv, EnvSystemdListenFDs+"=") ||
+			strings.HasPrefix(kv, EnvSystemdListenPID+"=") ||
+			strings.HasPrefix(kv, EnvSystemdListenNames+"=") {
+			continue
+		}
+		out = append(out, kv)
+	}
+	return out
+}
@@ -0,0 +1,144 @@
+package grace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const envHelper = "GRACE_TEST_HELPER"
+
+// TestRestartHelper is the process started by restart in the tests below. It
+// serves "child" on the inherited listener given by GRACE_TEST_HELPER until
+// it served one request, or exits at once if GRACE_TEST_HELPER is "exit".
+func TestRestartHelper(t *testing.T) {
+	spec := os.Getenv(envHelper)
+	if spec == "" {
+		t.Skip("helper process")
+	}
+	if !IsChild() {
+		os.Exit(3)
+	}
+	if spec == "exit" {
+		// exit without signaling the parent
+		os.Exit(0)
+	}
+	var network, address string
+	fmt.Sscanf(spec, "%s %s", &network, &address)
+	l, err := Listen(network, address)
+	if err != nil {
+		os.Exit(4)
+	}
+	done := make(chan struct{})
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "child")
+		close(done)
+	}))
+	if err := SignalReady(); err != nil {
+		os.Exit(5)
+	}
+	select {
+	case <-done:
+		time.Sleep(50 * time.Millisecond)
+		os.Exit(0)
+	case <-time.After(10 * time.Second):
+		os.Exit(6)
+	}
+}
+
+func restartHelper(network, address string) error {
+	env := append(os.Environ(), envHelper+"="+network+" "+address)
+	return restart(os.Args[0], []string{"-test.run=^TestRestartHelper$"}, env)
+}
+
+func testRestart(t *testing.T, network, address string, client *http.Client, url string) {
+	srv := newTestService()
+	l, err := Listen(network, address)
+	require.NoError(t, err)
+	srv.Server.Addr = address
+	srv.Server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "parent")
+	})
+	srv.GraceListener = newGraceListener(l, srv)
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve() }()
+	require.Eventually(t, srv.Ready, time.Second, time.Millisecond)
+
+	get := func() string {
+		resp, err := client.Get(url)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	assert.Equal(t, "parent", get())
+	client.CloseIdleConnections()
+
+	require.NoError(t, restartHelper(network, address))
+	require.NoError(t, srv.Shutdown(context.Background()))
+	require.NoError(t, <-served)
+
+	// the parent no longer accepts, the child serves the same socket
+	assert.Equal(t, "child", get())
+}
+
+func TestRestartTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := l.Addr().String()
+	l.Close()
+
+	testRestart(t, "tcp", address, &http.Client{}, "http://"+address)
+}
+
+func TestRestartUnix(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "grace.sock")
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+
+	testRestart(t, "unix", sock, client, "http://unix")
+	_, err := os.Stat(sock)
+	assert.NoError(t, err, "the socket file must survive the parent")
+}
+
+func TestRestartChildNotReady(t *testing.T) {
+	l, err := Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	err = restart(os.Args[0], []string{"-test.run=^TestRestartHelper$"},
+		append(os.Environ(), envHelper+"=exit"))
+	assert.ErrorContains(t, err, "ready pipe")
+}
+
+func TestRestartSharedRetries(t *testing.T) {
+	defer func() { restarted = false }()
+
+	var calls int
+	failing := errors.New("child not ready")
+	start := func() error {
+		calls++
+		if calls == 1 {
+			return failing
+		}
+		return nil
+	}
+
+	assert.Equal(t, failing, restartShared(start))
+	assert.NoError(t, restartShared(start), "retried after a failure")
+	assert.NoError(t, restartShared(start))
+	assert.Equal(t, 2, calls, "shared once it succeeded")
+}
@@ -0,0 +1,157 @@
+package grace
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"syscall"
+)
+
+// Deregisterer removes a service from service discovery. sd.Registar
+// implements it.
+type Deregisterer interface {
+	Deregister()
+}
+
+// DeregisterFunc adapts a function to a Deregisterer.
+type DeregisterFunc func()
+
+// Deregister calls f().
+func (f DeregisterFunc) Deregister() {
+	f()
+}
+
+// ShutdownHook is run by Shutdown once in-flight requests are drained.
+type ShutdownHook = HookFunc
+
+// Ready reports whether the service accepts requests: it is serving and not
+// shutting down.
+func (srv *MicroService) Ready() bool {
+	return atomic.LoadInt32(&srv.ready) == 1
+}
+
+func (srv *MicroService) setReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&srv.ready, v)
+}
+
+// AddDeregisterer adds d to the registrations removed when the service shuts
+// down, before its requests are drained. It is a PhaseShutdown hook.
+func (srv *MicroService) AddDeregisterer(d Deregisterer, options ...HookOption) {
+	srv.OnShutdown(func(context.Context) error {
+		d.Deregister()
+		return nil
+	}, options...)
+}
+
+// AddShutdownHook adds f to the functions run, in the order they were added,
+// when the service shuts down after its requests are drained. It is the same
+// as OnStopped.
+func (srv *MicroService) AddShutdownHook(f ShutdownHook, options ...HookOption) {
+	srv.OnStopped(f, options...)
+}
+
+// Shutdown gracefully stops the service:
+//
+//  1. the service is marked as not ready;
+//  2. the PhaseShutdown hooks run, deregistering it from service discovery;
+//  3. the listener is closed and in-flight requests are drained with
+//     http.Server.Shutdown. When ctx is done first the remaining
+//     connections are closed;
+//  4. the PhaseStopped hooks run. If ctx is already done they get a fresh
+//     context, bounded by their own timeouts only.
+//
+// Shutdown runs once; later calls wait for the first one and return its
+// result, which is the first error met; the others are logged. Serve returns
+// once Shutdown is done.
+// SIGINT and SIGTERM call Shutdown with a DefaultTimeout deadline.
+func (srv *MicroService) Shutdown(ctx context.Context) error {
+	srv.shutdownOnce.Do(func() {
+		srv.shutdownErr = srv.doShutdown(ctx)
+		close(srv.stoppedChan())
+	})
+	return srv.shutdownErr
+}
+
+func (srv *MicroService) doShutdown(ctx context.Context) error {
+	srv.setReady(false)
+	srv.mu.Lock()
+	srv.state = StateShuttingDown
+	srv.mu.Unlock()
+
+	var first error
+	keep := func(err error) {
+		if err == nil {
+			return
+		}
+		if first == nil {
+			first = err
+		} else {
+			srv.logger.Error("pid=%d,shutdown error=%v", syscall.Getpid(), err)
+		}
+	}
+
+	for _, err := range srv.runHooks(ctx, PhaseShutdown) {
+		keep(err)
+	}
+
+	if srv.Server != nil {
+		err := srv.Server.Shutdown(ctx)
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			srv.logger.Warn("pid=%d,drain interrupted, closing remaining connections", syscall.Getpid())
+			keep(srv.Server.Close())
+		}
+		keep(err)
+		if err == nil {
+			// hijacked connections are not tracked by http.Server
+			keep(srv.waitConns(ctx))
+		}
+	}
+
+	stoppedCtx := ctx
+	if ctx.Err() != nil {
+		stoppedCtx = context.Background()
+	}
+	for _, err := range srv.runHooks(stoppedCtx, PhaseStopped) {
+		keep(err)
+	}
+
+	srv.mu.Lock()
+	srv.state = StateTerminate
+	srv.mu.Unlock()
+	return first
+}
+
+// stoppedChan returns the channel closed when Shutdown is done.
+func (srv *MicroService) stoppedChan() chan struct{} {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.stopped == nil {
+		srv.stopped = make(chan struct{})
+	}
+	return srv.stopped
+}
+
+// waitConns waits until the connections accepted by the grace listener are
+// closed, or ctx is done.
+func (srv *MicroService) waitConns(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		srv.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Done returns a channel closed once Shutdown is done.
+func (srv *MicroService) Done() <-chan struct{} {
+	return srv.stoppedChan()
+}
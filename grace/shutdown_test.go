@@ -0,0 +1,111 @@
+package grace
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startService serves h on a loopback port and returns the base URL and the
+// result of Serve.
+func startService(t *testing.T, srv *MicroService, h http.Handler) (string, <-chan error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv.Server.Addr = l.Addr().String()
+	srv.Server.Handler = h
+	srv.GraceListener = newGraceListener(l, srv)
+
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve() }()
+	require.Eventually(t, srv.Ready, time.Second, time.Millisecond)
+	return "http://" + l.Addr().String(), served
+}
+
+func TestShutdownPhases(t *testing.T) {
+	srv := newTestService()
+	started, release := make(chan struct{}), make(chan struct{})
+	url, served := startService(t, srv, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	}))
+
+	var mu sync.Mutex
+	var phases []string
+	record := func(phase string) {
+		mu.Lock()
+		phases = append(phases, phase)
+		mu.Unlock()
+	}
+	srv.AddDeregisterer(DeregisterFunc(func() {
+		assert.False(t, srv.Ready())
+		record("deregister")
+	}))
+	srv.AddShutdownHook(func(ctx context.Context) error { record("hook1"); return nil })
+	srv.AddShutdownHook(func(ctx context.Context) error { record("hook2"); return nil })
+
+	resp := make(chan string, 1)
+	go func() {
+		r, err := http.Get(url)
+		if !assert.NoError(t, err) {
+			resp <- ""
+			return
+		}
+		defer r.Body.Close()
+		body, _ := io.ReadAll(r.Body)
+		resp <- string(body)
+	}()
+	<-started
+
+	shut := make(chan error, 1)
+	go func() { shut <- srv.Shutdown(context.Background()) }()
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(phases) == 1
+	}, time.Second, time.Millisecond)
+	// the in-flight request holds the drain phase
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, []string{"deregister"}, phases)
+	mu.Unlock()
+
+	close(release)
+	assert.Equal(t, "done", <-resp)
+	assert.NoError(t, <-shut)
+	assert.NoError(t, <-served)
+	assert.Equal(t, []string{"deregister", "hook1", "hook2"}, phases)
+
+	// a second call returns the result of the first one
+	assert.NoError(t, srv.Shutdown(context.Background()))
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	srv := newTestService()
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	url, served := startService(t, srv, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	hookRan := false
+	srv.AddShutdownHook(func(ctx context.Context) error { hookRan = true; return nil })
+
+	go http.Get(url)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorIs(t, <-served, context.DeadlineExceeded)
+	assert.True(t, hookRan)
+}
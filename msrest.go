@@ -3,8 +3,10 @@ package mskit
 import (
 	"fmt"
 	"github.com/libra9z/httprouter"
+	"github.com/libra9z/mskit/v4/endpoint"
 	"github.com/libra9z/mskit/v4/grace"
 	"github.com/libra9z/mskit/v4/log"
+	"github.com/libra9z/mskit/v4/openapi"
 	. "github.com/libra9z/mskit/v4/rest"
 	"github.com/libra9z/mskit/v4/trace"
 	"net/http"
@@ -41,11 +43,18 @@ func RegisterServiceWithTracer(path string, rest RestService, tracer trace.Trace
 	MsRest.RegisterServiceWithTracer(path, rest, tracer, logger, middlewares...)
 }
 
-func Handler(method, path string, handler http.Handler) {
-	MsRest.Router.Handler(method, path, handler)
+func Handler(method, path string, handler http.Handler, middlewares ...RestMiddleware) {
+	MsRest.Handler(method, path, handler, middlewares...)
 }
-func HandlerFunc(method, path string, handler http.Handler) {
-	MsRest.Router.Handler(method, path, handler)
+
+// HandleEndpoint registers ep for method and path on MsRest, e.g. a typed
+// endpoint built with Handle, see grace.MicroService.Handle.
+func HandleEndpoint(method, path string, ep endpoint.Endpoint, middlewares ...RestMiddleware) {
+	MsRest.Handle(method, path, ep, middlewares...)
+}
+
+func HandlerFunc(method, path string, handler http.Handler, middlewares ...RestMiddleware) {
+	MsRest.Handler(method, path, handler, middlewares...)
 }
 
 func Serve(params ...string) {
@@ -63,3 +72,26 @@ func ServeFiles(path string, root http.FileSystem) {
 		fmt.Printf("no rest service avaliable.\n")
 	}
 }
+
+// ServeOpenAPI serves the OpenAPI document of MsRest at path, see
+// grace.MicroService.ServeOpenAPI.
+func ServeOpenAPI(path string, info openapi.Info) {
+	MsRest.ServeOpenAPI(path, info)
+}
+
+// AddReadinessCheck adds a readiness check to MsRest, see
+// grace.MicroService.AddReadinessCheck.
+func AddReadinessCheck(name string, check grace.HealthCheck) {
+	MsRest.AddReadinessCheck(name, check)
+}
+
+// AddLivenessCheck adds a liveness check to MsRest, see
+// grace.MicroService.AddLivenessCheck.
+func AddLivenessCheck(name string, check grace.HealthCheck) {
+	MsRest.AddLivenessCheck(name, check)
+}
+
+// Group returns a route group of MsRest for the routes under prefix.
+func Group(prefix string, middlewares ...RestMiddleware) *grace.RouteGroup {
+	return MsRest.Group(prefix, middlewares...)
+}
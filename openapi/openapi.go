@@ -0,0 +1,242 @@
+// Package openapi generates OpenAPI 3 documents from the routes of a
+// service and the Go types of their requests and responses.
+//
+// Request types are described by the tags the binding package reads: uri
+// fields are path parameters, header fields header parameters and form
+// fields query parameters; the other fields make up the JSON request body.
+// The constraints of binding tags (required, min, max, oneof, email, ...)
+// become schema constraints.
+package openapi
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Version is the OpenAPI version of the generated documents.
+const Version = "3.0.3"
+
+// Document is an OpenAPI 3 document.
+type Document struct {
+	OpenAPI    string              `json:"openapi" yaml:"openapi"`
+	Info       Info                `json:"info" yaml:"info"`
+	Servers    []Server            `json:"servers,omitempty" yaml:"servers,omitempty"`
+	Paths      map[string]PathItem `json:"paths" yaml:"paths"`
+	Components *Components         `json:"components,omitempty" yaml:"components,omitempty"`
+}
+
+// Info is the metadata of the API.
+type Info struct {
+	Title       string `json:"title" yaml:"title"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Version     string `json:"version" yaml:"version"`
+}
+
+// Server is a server the API is served by.
+type Server struct {
+	URL         string `json:"url" yaml:"url"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// PathItem maps the lower case HTTP methods of a path to their operations.
+type PathItem map[string]*Operation
+
+// Operation describes a method of a path.
+type Operation struct {
+	OperationID string               `json:"operationId,omitempty" yaml:"operationId,omitempty"`
+	Summary     string               `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Description string               `json:"description,omitempty" yaml:"description,omitempty"`
+	Tags        []string             `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty" yaml:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses" yaml:"responses"`
+	Deprecated  bool                 `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
+}
+
+// Parameter is a path, query or header parameter of an operation.
+type Parameter struct {
+	Name        string  `json:"name" yaml:"name"`
+	In          string  `json:"in" yaml:"in"`
+	Description string  `json:"description,omitempty" yaml:"description,omitempty"`
+	Required    bool    `json:"required,omitempty" yaml:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty" yaml:"schema,omitempty"`
+}
+
+// RequestBody is the body of the requests of an operation.
+type RequestBody struct {
+	Description string                `json:"description,omitempty" yaml:"description,omitempty"`
+	Required    bool                  `json:"required,omitempty" yaml:"required,omitempty"`
+	Content     map[string]*MediaType `json:"content" yaml:"content"`
+}
+
+// Response is a response of an operation.
+type Response struct {
+	Description string                `json:"description" yaml:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty" yaml:"content,omitempty"`
+}
+
+// MediaType is the schema of a request or response body in a media type.
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty" yaml:"schema,omitempty"`
+}
+
+// Components holds the schemas referenced by the document.
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty" yaml:"schemas,omitempty"`
+}
+
+// Schema is a JSON schema, as supported by OpenAPI 3.0.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty" yaml:"type,omitempty"`
+	Format               string             `json:"format,omitempty" yaml:"format,omitempty"`
+	Description          string             `json:"description,omitempty" yaml:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty" yaml:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty" yaml:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty" yaml:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty" yaml:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty" yaml:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty" yaml:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty" yaml:"maximum,omitempty"`
+	ExclusiveMinimum     bool               `json:"exclusiveMinimum,omitempty" yaml:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     bool               `json:"exclusiveMaximum,omitempty" yaml:"exclusiveMaximum,omitempty"`
+	MinLength            *uint64            `json:"minLength,omitempty" yaml:"minLength,omitempty"`
+	MaxLength            *uint64            `json:"maxLength,omitempty" yaml:"maxLength,omitempty"`
+	MinItems             *uint64            `json:"minItems,omitempty" yaml:"minItems,omitempty"`
+	MaxItems             *uint64            `json:"maxItems,omitempty" yaml:"maxItems,omitempty"`
+	Pattern              string             `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty" yaml:"nullable,omitempty"`
+}
+
+// Route is a registered route, documented by the operation generated for it.
+type Route struct {
+	Method      string
+	Path        string // httprouter path, e.g. /users/:id
+	Summary     string
+	Description string
+	Tags        []string
+	Deprecated  bool
+	// Request and Response are the types of the request and response of the
+	// route, if known.
+	Request  reflect.Type
+	Response reflect.Type
+}
+
+// Doc sets the summary and the tags of r.
+func (r *Route) Doc(summary string, tags ...string) *Route {
+	r.Summary = summary
+	r.Tags = tags
+	return r
+}
+
+// Types sets the request and response types of r to the types of request
+// and response, which may be nil or pointers.
+func (r *Route) Types(request, response interface{}) *Route {
+	r.Request = typeOf(request)
+	r.Response = typeOf(response)
+	return r
+}
+
+func typeOf(v interface{}) reflect.Type {
+	if v == nil {
+		return nil
+	}
+	if t, ok := v.(reflect.Type); ok {
+		return t
+	}
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// Build returns the document of routes.
+func Build(info Info, routes []*Route) *Document {
+	g := newGenerator()
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   make(map[string]PathItem),
+	}
+	for _, r := range routes {
+		path, params := convertPath(r.Path)
+		item := doc.Paths[path]
+		if item == nil {
+			item = make(PathItem)
+			doc.Paths[path] = item
+		}
+		item[strings.ToLower(r.Method)] = g.operation(r, path, params)
+	}
+	if len(g.schemas) > 0 {
+		doc.Components = &Components{Schemas: g.schemas}
+	}
+	return doc
+}
+
+// convertPath returns the OpenAPI path of the httprouter path p, with
+// {name} for :name and *name, and the names of its parameters.
+func convertPath(p string) (string, []string) {
+	segments := strings.Split(p, "/")
+	var params []string
+	for i, s := range segments {
+		if len(s) > 1 && (s[0] == ':' || s[0] == '*') {
+			params = append(params, s[1:])
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// operationID returns an ID like getUsersId for GET /users/{id}.
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, s := range strings.FieldsFunc(path, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		id += strings.ToUpper(s[:1]) + s[1:]
+	}
+	return id
+}
+
+// JSON returns the document as indented JSON.
+func (d *Document) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// YAML returns the document as YAML.
+func (d *Document) YAML() ([]byte, error) {
+	// go through JSON, so the field names and order are the ones of the
+	// JSON document
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	var v yaml.MapSlice
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(v)
+}
+
+// WriteFile writes the document to name, as YAML if name ends with .yaml
+// or .yml and as JSON otherwise.
+func (d *Document) WriteFile(name string) error {
+	var b []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		b, err = d.YAML()
+	default:
+		b, err = d.JSON()
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, b, 0644)
+}
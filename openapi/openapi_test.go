@@ -0,0 +1,151 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+type Address struct {
+	City string `json:"city" binding:"required"`
+}
+
+type User struct {
+	ID       int64     `json:"id"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email,omitempty"`
+	Created  time.Time `json:"created"`
+	Address  *Address  `json:"address,omitempty"`
+	Friends  []*User   `json:"friends,omitempty"`
+	password string
+}
+
+type updateUser struct {
+	ID      int64    `uri:"id" binding:"required,min=1"`
+	Version string   `form:"version" binding:"omitempty,oneof=v1 v2"`
+	Token   string   `header:"X-Token" binding:"required"`
+	Name    string   `json:"name" binding:"required,min=2,max=32"`
+	Email   string   `json:"email" binding:"email"`
+	Age     int      `json:"age" binding:"gte=0,lt=150"`
+	Tags    []string `json:"tags" binding:"max=5,dive,min=1"`
+	Ignored string   `json:"-"`
+}
+
+type listUsers struct {
+	Page  int    `form:"page" binding:"min=1"`
+	Order string `binding:"oneof=asc desc"`
+}
+
+func TestConvertPath(t *testing.T) {
+	path, params := convertPath("/users/:id/files/*name")
+	assert.Equal(t, "/users/{id}/files/{name}", path)
+	assert.Equal(t, []string{"id", "name"}, params)
+	assert.Equal(t, "getUsersIdFilesName", operationID(http.MethodGet, path))
+}
+
+func TestBuild(t *testing.T) {
+	routes := []*Route{
+		(&Route{Method: http.MethodPut, Path: "/users/:id"}).Types(&updateUser{}, &User{}).Doc("Update a user", "users"),
+		(&Route{Method: http.MethodGet, Path: "/users"}).Types(listUsers{}, []User{}),
+		{Method: http.MethodDelete, Path: "/users/:id"},
+	}
+	doc := Build(Info{Title: "users", Version: "1.0"}, routes)
+	assert.Equal(t, Version, doc.OpenAPI)
+	require.Contains(t, doc.Paths, "/users/{id}")
+
+	put := doc.Paths["/users/{id}"]["put"]
+	require.NotNil(t, put)
+	assert.Equal(t, "putUsersId", put.OperationID)
+	assert.Equal(t, "Update a user", put.Summary)
+	assert.Equal(t, []string{"users"}, put.Tags)
+
+	require.Len(t, put.Parameters, 3)
+	id := put.Parameters[0]
+	assert.Equal(t, "path", id.In)
+	assert.Equal(t, "id", id.Name)
+	assert.True(t, id.Required)
+	assert.Equal(t, "integer", id.Schema.Type)
+	assert.Equal(t, 1.0, *id.Schema.Minimum)
+	version := put.Parameters[1]
+	assert.Equal(t, "query", version.In)
+	assert.False(t, version.Required)
+	assert.Equal(t, []interface{}{"v1", "v2"}, version.Schema.Enum)
+	token := put.Parameters[2]
+	assert.Equal(t, "header", token.In)
+	assert.Equal(t, "X-Token", token.Name)
+	assert.True(t, token.Required)
+
+	require.NotNil(t, put.RequestBody)
+	body := put.RequestBody.Content["application/json"].Schema
+	assert.Equal(t, []string{"name"}, body.Required)
+	assert.Equal(t, uint64(2), *body.Properties["name"].MinLength)
+	assert.Equal(t, uint64(32), *body.Properties["name"].MaxLength)
+	assert.Equal(t, "email", body.Properties["email"].Format)
+	assert.Equal(t, 0.0, *body.Properties["age"].Minimum)
+	assert.Equal(t, 150.0, *body.Properties["age"].Maximum)
+	assert.True(t, body.Properties["age"].ExclusiveMaximum)
+	assert.Equal(t, uint64(5), *body.Properties["tags"].MaxItems)
+	assert.Nil(t, body.Properties["tags"].Items.MinLength, "rules after dive are ignored")
+	assert.NotContains(t, body.Properties, "Ignored")
+
+	assert.Equal(t, "#/components/schemas/User", put.Responses["200"].Content["application/json"].Schema.Ref)
+	assert.Contains(t, put.Responses["default"].Content, "application/problem+json")
+
+	get := doc.Paths["/users"]["get"]
+	require.NotNil(t, get)
+	assert.Nil(t, get.RequestBody)
+	require.Len(t, get.Parameters, 2)
+	assert.Equal(t, "page", get.Parameters[0].Name)
+	assert.Equal(t, "Order", get.Parameters[1].Name)
+	assert.Equal(t, "query", get.Parameters[1].In)
+	list := get.Responses["200"].Content["application/json"].Schema
+	assert.Equal(t, "array", list.Type)
+	assert.Equal(t, "#/components/schemas/User", list.Items.Ref)
+
+	del := doc.Paths["/users/{id}"]["delete"]
+	require.NotNil(t, del)
+	require.Len(t, del.Parameters, 1)
+	assert.Equal(t, "string", del.Parameters[0].Schema.Type)
+	assert.Nil(t, del.Responses["200"].Content)
+
+	require.NotNil(t, doc.Components)
+	user := doc.Components.Schemas["User"]
+	require.NotNil(t, user)
+	assert.Equal(t, "date-time", user.Properties["created"].Format)
+	assert.Equal(t, "#/components/schemas/Address", user.Properties["address"].Ref)
+	assert.Equal(t, "#/components/schemas/User", user.Properties["friends"].Items.Ref)
+	assert.NotContains(t, user.Properties, "password")
+	assert.Equal(t, []string{"city"}, doc.Components.Schemas["Address"].Required)
+	assert.Contains(t, doc.Components.Schemas, "Problem")
+}
+
+func TestWriteFile(t *testing.T) {
+	doc := Build(Info{Title: "users", Version: "1.0"}, []*Route{
+		(&Route{Method: http.MethodGet, Path: "/users/:id"}).Types(nil, User{}),
+	})
+	dir := t.TempDir()
+
+	name := filepath.Join(dir, "openapi.json")
+	require.NoError(t, doc.WriteFile(name))
+	b, err := os.ReadFile(name)
+	require.NoError(t, err)
+	var v map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &v))
+	assert.Equal(t, Version, v["openapi"])
+
+	name = filepath.Join(dir, "openapi.yaml")
+	require.NoError(t, doc.WriteFile(name))
+	b, err = os.ReadFile(name)
+	require.NoError(t, err)
+	var y yaml.MapSlice
+	require.NoError(t, yaml.Unmarshal(b, &y))
+	assert.Equal(t, "openapi", y[0].Key)
+	assert.Contains(t, string(b), "$ref: '#/components/schemas/User'")
+}
@@ -0,0 +1,384 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	me "github.com/libra9z/mskit/v4/error"
+)
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	problemType = reflect.TypeOf(me.Problem{})
+)
+
+// generator builds the operations of a document and collects the schemas
+// of the named struct types they reference.
+type generator struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+func newGenerator() *generator {
+	return &generator{
+		schemas: make(map[string]*Schema),
+		names:   make(map[reflect.Type]string),
+	}
+}
+
+// hasBody reports whether requests of method carry a body.
+func hasBody(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+	return true
+}
+
+func (g *generator) operation(r *Route, path string, pathParams []string) *Operation {
+	op := &Operation{
+		OperationID: operationID(r.Method, path),
+		Summary:     r.Summary,
+		Description: r.Description,
+		Tags:        r.Tags,
+		Deprecated:  r.Deprecated,
+		Responses:   make(map[string]*Response),
+	}
+
+	var fields []field
+	if r.Request != nil && indirect(r.Request).Kind() == reflect.Struct {
+		fields = structFields(indirect(r.Request))
+	}
+
+	// path parameters come first, in the order of the path
+	for _, name := range pathParams {
+		p := &Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}}
+		for _, f := range fields {
+			if f.tag("uri") == name {
+				p.Schema = g.fieldSchema(f)
+			}
+		}
+		op.Parameters = append(op.Parameters, p)
+	}
+
+	body := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	allBody := true
+	for _, f := range fields {
+		switch {
+		case f.tag("uri") != "":
+			allBody = false
+		case f.tag("header") != "":
+			allBody = false
+			op.Parameters = append(op.Parameters, g.parameter(f, "header", f.tag("header")))
+		case f.tag("form") != "" || !hasBody(r.Method):
+			allBody = false
+			name := f.tag("form")
+			if name == "" {
+				name = f.Name
+			}
+			op.Parameters = append(op.Parameters, g.parameter(f, "query", name))
+		default:
+			name, ok := f.jsonName()
+			if !ok {
+				continue
+			}
+			body.Properties[name] = g.fieldSchema(f)
+			if f.required() {
+				body.Required = append(body.Required, name)
+			}
+		}
+	}
+	if hasBody(r.Method) && r.Request != nil {
+		schema := body
+		if allBody || indirect(r.Request).Kind() != reflect.Struct {
+			schema = g.schema(r.Request)
+		}
+		if allBody || len(body.Properties) > 0 {
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]*MediaType{"application/json": {Schema: schema}},
+			}
+		}
+	}
+
+	if r.Response != nil {
+		op.Responses["200"] = &Response{
+			Description: http.StatusText(http.StatusOK),
+			Content:     map[string]*MediaType{"application/json": {Schema: g.schema(r.Response)}},
+		}
+	} else {
+		op.Responses["200"] = &Response{Description: http.StatusText(http.StatusOK)}
+	}
+	op.Responses["default"] = &Response{
+		Description: "Error",
+		Content:     map[string]*MediaType{me.MIMEProblemJSON: {Schema: g.schema(problemType)}},
+	}
+	return op
+}
+
+func (g *generator) parameter(f field, in, name string) *Parameter {
+	return &Parameter{Name: name, In: in, Required: f.required(), Schema: g.fieldSchema(f)}
+}
+
+// fieldSchema returns the schema of the type of f with the constraints of its
+// binding tag.
+func (g *generator) fieldSchema(f field) *Schema {
+	s := g.schema(f.Type)
+	if rules := f.tag("binding"); rules != "" {
+		if s.Ref != "" {
+			// constraints do not apply to referenced structs
+			return s
+		}
+		applyRules(s, indirect(f.Type), rules)
+	}
+	return s
+}
+
+// schema returns the schema of t, a reference for named struct types.
+func (g *generator) schema(t reflect.Type) *Schema {
+	t = indirect(t)
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return &Schema{Type: "string", Format: "byte"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + g.define(t)}
+	}
+	// interfaces and the like: any value
+	return &Schema{}
+}
+
+// define adds the schema of the named struct type t to the components, once,
+// and returns its name.
+func (g *generator) define(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+	name := schemaName(t)
+	if _, taken := g.schemas[name]; taken {
+		name = schemaName(t) + strconv.Itoa(len(g.names))
+	}
+	g.names[t] = name
+	// registered before its fields, for recursive types
+	g.schemas[name] = &Schema{}
+	*g.schemas[name] = *g.structSchema(t)
+	return name
+}
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// schemaName returns a component name for t, e.g. Page_main.User for the
+// generic Page[main.User].
+func schemaName(t reflect.Type) string {
+	return strings.Trim(unsafeName.ReplaceAllString(t.Name(), "_"), "_")
+}
+
+func (g *generator) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for _, f := range structFields(t) {
+		name, ok := f.jsonName()
+		if !ok {
+			continue
+		}
+		s.Properties[name] = g.fieldSchema(f)
+		if f.required() {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
+
+// field is an exported struct field, possibly promoted from an embedded
+// struct.
+type field struct {
+	reflect.StructField
+}
+
+// structFields returns the exported fields of t, with the fields of
+// embedded structs without a json name in place of the struct.
+func structFields(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		f := field{t.Field(i)}
+		if f.Anonymous && indirect(f.Type).Kind() == reflect.Struct && f.tag("json") == "" {
+			fields = append(fields, structFields(indirect(f.Type))...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// tag returns the name part of the tag key of f.
+func (f field) tag(key string) string {
+	v := f.Tag.Get(key)
+	if key == "binding" {
+		return v
+	}
+	name, _, _ := strings.Cut(v, ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// jsonName returns the name of f in JSON documents, and false if f is not
+// encoded.
+func (f field) jsonName() (string, bool) {
+	if f.Tag.Get("json") == "-" {
+		return "", false
+	}
+	if name := f.tag("json"); name != "" {
+		return name, true
+	}
+	return f.Name, true
+}
+
+func (f field) required() bool {
+	for _, rule := range strings.Split(f.tag("binding"), ",") {
+		if rule == "required" {
+			return true
+		}
+		if rule == "dive" {
+			break
+		}
+	}
+	return false
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+var ruleFormats = map[string]string{
+	"email":    "email",
+	"url":      "uri",
+	"uri":      "uri",
+	"uuid":     "uuid",
+	"uuid4":    "uuid",
+	"ipv4":     "ipv4",
+	"ipv6":     "ipv6",
+	"hostname": "hostname",
+	"datetime": "date-time",
+}
+
+// applyRules sets the constraints of the validator rules of a binding tag
+// on s, the schema of a value of type t. Rules after dive apply to the
+// elements of slices and maps and are ignored.
+func applyRules(s *Schema, t reflect.Type, rules string) {
+	for _, rule := range strings.Split(rules, ",") {
+		if rule == "dive" {
+			return
+		}
+		name, param, _ := strings.Cut(rule, "=")
+		if format, ok := ruleFormats[name]; ok {
+			s.Format = format
+			continue
+		}
+		switch name {
+		case "oneof":
+			for _, v := range strings.Fields(param) {
+				s.Enum = append(s.Enum, enumValue(t, v))
+			}
+		case "min", "gte":
+			setBound(s, t, param, true, false)
+		case "max", "lte":
+			setBound(s, t, param, false, false)
+		case "gt":
+			setBound(s, t, param, true, true)
+		case "lt":
+			setBound(s, t, param, false, true)
+		case "len":
+			setBound(s, t, param, true, false)
+			setBound(s, t, param, false, false)
+		}
+	}
+}
+
+// setBound sets a lower (min) or upper bound on s: a length for strings, a
+// number of items for slices, arrays and maps and a value for numbers.
+func setBound(s *Schema, t reflect.Type, param string, min, exclusive bool) {
+	switch t.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		n, err := strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			return
+		}
+		if exclusive {
+			if min {
+				n++
+			} else if n > 0 {
+				n--
+			}
+		}
+		lower, upper := &s.MinLength, &s.MaxLength
+		if t.Kind() != reflect.String {
+			lower, upper = &s.MinItems, &s.MaxItems
+		}
+		if min {
+			*lower = &n
+		} else {
+			*upper = &n
+		}
+	default:
+		v, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return
+		}
+		if min {
+			s.Minimum, s.ExclusiveMinimum = &v, exclusive
+		} else {
+			s.Maximum, s.ExclusiveMaximum = &v, exclusive
+		}
+	}
+}
+
+// enumValue returns v as a value of the kind of t.
+func enumValue(t reflect.Type, v string) interface{} {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return v
+}
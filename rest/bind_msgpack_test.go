@@ -0,0 +1,26 @@
+//go:build !nomsgpack
+// +build !nomsgpack
+
+package rest
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/libra9z/mskit/v4/binding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ugorji/go/codec"
+)
+
+func TestShouldBindWithMsgPack(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, codec.NewEncoder(&buf, new(codec.MsgpackHandle)).Encode(bindUser{Name: "ann", Age: 7}))
+	mc := decodeBind(t, newBindRequest(binding.MIMEMSGPACK, buf.Bytes()))
+
+	for i := 0; i < 2; i++ {
+		var u bindUser
+		require.NoError(t, mc.ShouldBindWith(&u, binding.MsgPack))
+		assert.Equal(t, bindUser{Name: "ann", Age: 7}, u)
+	}
+}
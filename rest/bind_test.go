@@ -0,0 +1,148 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/libra9z/httprouter"
+	"github.com/libra9z/mskit/v4/binding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type bindUser struct {
+	Name string `json:"name" xml:"name" form:"name" yaml:"name" msgpack:"name" uri:"name" header:"X-Name"`
+	Age  int    `json:"age" xml:"age" form:"age" yaml:"age" msgpack:"age" header:"X-Age"`
+}
+
+// decodeBind decodes r as RestApi.DecodeRequest does for the route
+// /users/:name.
+func decodeBind(t *testing.T, r *http.Request) *Mcontext {
+	router := httprouter.New()
+	router.Handler(r.Method, "/users/:name", http.NotFoundHandler())
+	svc := &RestApi{}
+	svc.SetRouter(router)
+	request, err := svc.DecodeRequest(context.Background(), r, httptest.NewRecorder())
+	require.NoError(t, err)
+	return request.(*Mcontext)
+}
+
+func newBindRequest(contentType string, body []byte) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/users/ann?name=ann&age=7", bytes.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	r.Header.Set("X-Name", "ann")
+	r.Header.Set("X-Age", "7")
+	return r
+}
+
+func multipartBody(t *testing.T) (string, []byte) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	require.NoError(t, w.WriteField("name", "ann"))
+	require.NoError(t, w.WriteField("age", "7"))
+	require.NoError(t, w.Close())
+	return w.FormDataContentType(), buf.Bytes()
+}
+
+func TestShouldBindWithBufferedBody(t *testing.T) {
+	multipartType, multipartData := multipartBody(t)
+	tests := []struct {
+		name        string
+		binding     binding.Binding
+		contentType string
+		body        string
+	}{
+		{"json", binding.JSON, MIMEJSON, `{"name":"ann","age":7}`},
+		{"xml", binding.XML, MIMEXML, `<user><name>ann</name><age>7</age></user>`},
+		{"yaml", binding.YAML, MIMEYAML, "name: ann\nage: 7\n"},
+		{"form", binding.Form, MIMEPOSTForm, "name=ann&age=7"},
+		{"form post", binding.FormPost, MIMEPOSTForm, "name=ann&age=7"},
+		{"form multipart", binding.FormMultipart, multipartType, string(multipartData)},
+		{"query", binding.Query, MIMEJSON, `{}`},
+		{"header", binding.Header, MIMEJSON, `{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mc := decodeBind(t, newBindRequest(tt.contentType, []byte(tt.body)))
+			// the body can be bound more than once
+			for i := 0; i < 2; i++ {
+				var u bindUser
+				require.NoError(t, mc.ShouldBindWith(&u, tt.binding))
+				assert.Equal(t, bindUser{Name: "ann", Age: 7}, u)
+			}
+		})
+	}
+}
+
+func TestShouldBindWithProtoBuf(t *testing.T) {
+	body, err := proto.Marshal(wrapperspb.String("ann"))
+	require.NoError(t, err)
+	mc := decodeBind(t, newBindRequest(binding.MIMEPROTOBUF, body))
+
+	for i := 0; i < 2; i++ {
+		var v wrapperspb.StringValue
+		require.NoError(t, mc.ShouldBindWith(&v, binding.ProtoBuf))
+		assert.Equal(t, "ann", v.GetValue())
+	}
+}
+
+func TestBindSeveralPasses(t *testing.T) {
+	mc := decodeBind(t, newBindRequest(MIMEJSON, []byte(`{"name":"bob","age":42}`)))
+
+	var uri, header, query, body bindUser
+	require.NoError(t, mc.ShouldBindUri(&uri))
+	require.NoError(t, mc.BindHeader(&header))
+	require.NoError(t, mc.BindQuery(&query))
+	require.NoError(t, mc.Bind(&body))
+	assert.Equal(t, "ann", uri.Name)
+	assert.Equal(t, bindUser{Name: "ann", Age: 7}, header)
+	assert.Equal(t, bindUser{Name: "ann", Age: 7}, query)
+	assert.Equal(t, bindUser{Name: "bob", Age: 42}, body)
+
+	var again bindUser
+	require.NoError(t, mc.BindJSON(&again))
+	assert.Equal(t, body, again)
+	raw, err := mc.GetRawData()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"bob","age":42}`, string(raw))
+}
+
+func TestShouldBindStreamedBody(t *testing.T) {
+	svc := &RestApi{}
+	svc.SetRouter(httprouter.New())
+	svc.SetStreamBody(true)
+	r := newBindRequest(MIMEJSON, []byte(`{"name":"ann","age":7}`))
+	request, err := svc.DecodeRequest(context.Background(), r, httptest.NewRecorder())
+	require.NoError(t, err)
+	mc := request.(*Mcontext)
+
+	// a streamed body is read from the request by the first bind only...
+	var u bindUser
+	require.NoError(t, mc.ShouldBindBodyWith(&u, binding.JSON))
+	assert.Equal(t, bindUser{Name: "ann", Age: 7}, u)
+	rest, _ := io.ReadAll(mc.Request.Body)
+	assert.Empty(t, rest)
+
+	// ...and kept for the next ones
+	var again bindUser
+	require.NoError(t, mc.ShouldBindWith(&again, binding.JSON))
+	assert.Equal(t, u, again)
+}
+
+func TestBindFormAfterJSONPass(t *testing.T) {
+	mc := decodeBind(t, newBindRequest(MIMEPOSTForm, []byte("name=ann&age=7")))
+	assert.True(t, strings.Contains(mc.ContentTypeString(), "form"))
+
+	var u bindUser
+	assert.Error(t, mc.ShouldBindWith(&u, binding.JSON))
+	require.NoError(t, mc.ShouldBind(&u))
+	assert.Equal(t, bindUser{Name: "ann", Age: 7}, u)
+}
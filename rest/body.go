@@ -0,0 +1,81 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+
+	me "github.com/libra9z/mskit/v4/error"
+)
+
+// DefaultMaxBodySize is the size limit of the request bodies buffered by
+// RestApi.DecodeRequest when neither the route nor the engine set one.
+// Multipart and streamed bodies are not limited by default.
+var DefaultMaxBodySize int64 = 32 << 20
+
+// NoBodyLimit disables the size limit of request bodies.
+const NoBodyLimit int64 = -1
+
+// ErrBodyTooLarge is returned when reading a request body past its size
+// limit, so the request is answered with 413 Request Entity Too Large.
+var ErrBodyTooLarge = me.NewProblem(http.StatusRequestEntityTooLarge, "body_too_large", "request body too large")
+
+// MaxBodySize returns the limit set by the ServerMaxBodySize option of the
+// engine serving the request of ctx, or 0 if there is none.
+func MaxBodySize(ctx context.Context) int64 {
+	if ctx == nil {
+		return 0
+	}
+	n, _ := ctx.Value(ContextKeyMaxBodySize).(int64)
+	return n
+}
+
+// LimitBody returns body limited to n bytes: reading past them fails with
+// ErrBodyTooLarge. A negative n returns body unchanged.
+func LimitBody(body io.ReadCloser, n int64) io.ReadCloser {
+	if n < 0 || body == nil || body == http.NoBody {
+		return body
+	}
+	return &limitedBody{ReadCloser: body, n: n}
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	n   int64 // bytes left
+	err error
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// read one byte more than allowed to tell a body of exactly n bytes
+	// from a larger one
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	if int64(n) <= l.n {
+		l.n -= int64(n)
+		l.err = err
+		return n, err
+	}
+	n = int(l.n)
+	l.n = 0
+	l.err = ErrBodyTooLarge
+	return n, l.err
+}
+
+// BodyReader returns the body of the request: Body when DecodeRequest
+// buffered it, the request body otherwise, e.g. for services streaming their
+// bodies (see RestApi.SetStreamBody).
+func (c *Mcontext) BodyReader() io.Reader {
+	if c.Body != nil || c.Request == nil || c.Request.Body == nil {
+		return bytes.NewReader(c.Body)
+	}
+	return c.Request.Body
+}
@@ -0,0 +1,137 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/libra9z/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitBody(t *testing.T) {
+	body, err := io.ReadAll(LimitBody(io.NopCloser(strings.NewReader("12345")), 5))
+	assert.NoError(t, err)
+	assert.Equal(t, "12345", string(body))
+
+	body, err = io.ReadAll(LimitBody(io.NopCloser(strings.NewReader("123456")), 5))
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+	assert.Equal(t, "12345", string(body))
+
+	body, err = io.ReadAll(LimitBody(io.NopCloser(strings.NewReader("123456")), NoBodyLimit))
+	assert.NoError(t, err)
+	assert.Equal(t, "123456", string(body))
+}
+
+// bodyEngine serves svc, answering with the body its Post read.
+func bodyEngine(svc *RestApi, options ...ServerOption) *Engine {
+	svc.SetRouter(httprouter.New())
+	return NewEngine(
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			mc := request.(*Mcontext)
+			body, err := io.ReadAll(mc.BodyReader())
+			if err != nil {
+				return nil, err
+			}
+			return string(body), nil
+		},
+		svc.DecodeRequest,
+		svc.EncodeResponse,
+		append(options, ServerErrorEncoder(svc.ErrorEncoder))...,
+	)
+}
+
+func post(e *Engine, body string, chunked bool) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(body))
+	if chunked {
+		// the size is only known once the body is read
+		r.ContentLength = -1
+	}
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, r)
+	return w
+}
+
+func TestDecodeRequestBodyLimit(t *testing.T) {
+	svc := &RestApi{}
+	svc.SetMaxBodySize(4)
+	e := bodyEngine(svc)
+
+	assert.Equal(t, http.StatusOK, post(e, "1234", false).Code)
+	for _, chunked := range []bool{false, true} {
+		w := post(e, "12345", chunked)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Contains(t, w.Body.String(), "body_too_large")
+	}
+}
+
+func TestDecodeRequestMultipartLimit(t *testing.T) {
+	defer func(n int64) { DefaultMaxBodySize = n }(DefaultMaxBodySize)
+	DefaultMaxBodySize = 4
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "upload.bin")
+	require.NoError(t, err)
+	fw.Write(bytes.Repeat([]byte("x"), 64))
+	require.NoError(t, mw.Close())
+	upload := func(e *Engine) int {
+		r := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(body.Bytes()))
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, upload(bodyEngine(&RestApi{})), "not limited by default")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post(bodyEngine(&RestApi{}), "12345", false).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, upload(bodyEngine(&RestApi{}, ServerMaxBodySize(4))))
+}
+
+func TestServerMaxBodySize(t *testing.T) {
+	e := bodyEngine(&RestApi{}, ServerMaxBodySize(4))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post(e, "12345", true).Code)
+
+	// the route limit overrides the one of the engine
+	svc := &RestApi{}
+	svc.SetMaxBodySize(NoBodyLimit)
+	e = bodyEngine(svc, ServerMaxBodySize(4))
+	assert.Equal(t, http.StatusOK, post(e, "12345", true).Code)
+}
+
+func TestDecodeRequestStreamBody(t *testing.T) {
+	svc := &RestApi{}
+	svc.SetStreamBody(true)
+	svc.SetMaxBodySize(8)
+	svc.SetRouter(httprouter.New())
+
+	r := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("streamed"))
+	request, err := svc.DecodeRequest(context.Background(), r, httptest.NewRecorder())
+	require.NoError(t, err)
+	mc := request.(*Mcontext)
+	assert.Nil(t, mc.Body, "the body is not buffered")
+	body, err := io.ReadAll(mc.BodyReader())
+	assert.NoError(t, err)
+	assert.Equal(t, "streamed", string(body))
+
+	e := bodyEngine(svc)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post(e, "too large!", true).Code)
+}
+
+func TestHandlerEngineMaxBodySize(t *testing.T) {
+	e := NewHandlerEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), ErrorStatusCode(err, http.StatusInternalServerError))
+		}
+	}), ServerMaxBodySize(4))
+
+	assert.Equal(t, http.StatusOK, post(e, "1234", true).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post(e, "12345", true).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post(e, "12345", false).Code)
+}
@@ -0,0 +1,532 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/libra9z/mskit/v4/binding"
+	"github.com/libra9z/mskit/v4/endpoint"
+	me "github.com/libra9z/mskit/v4/error"
+	"github.com/libra9z/mskit/v4/render"
+)
+
+// Defaults of the Client options.
+const (
+	DefaultClientTimeout     = 10 * time.Second
+	DefaultClientBackoff     = 50 * time.Millisecond
+	DefaultBreakerFailures   = 5
+	DefaultBreakerOpenPeriod = 10 * time.Second
+)
+
+// maxErrorBodySize is the size of the error response bodies read into the
+// problems returned by a Client.
+const maxErrorBodySize = 64 << 10
+
+var (
+	// ErrNoInstances is returned by the endpoint of a Client when the
+	// service has no instance to call.
+	ErrNoInstances = me.NewProblem(http.StatusServiceUnavailable, "no_instances", "no instance of the service is available")
+	// ErrCircuitOpen is returned by the endpoint of a Client when the
+	// breakers of all the instances of the service are open.
+	ErrCircuitOpen = me.NewProblem(http.StatusServiceUnavailable, "circuit_open", "the circuit breakers of all the instances are open")
+)
+
+// Instancer returns the addresses, host:port, of the instances of the
+// service called by a Client, e.g. from service discovery, see sd.Instancer.
+type Instancer func(ctx context.Context) ([]string, error)
+
+// FixedInstancer returns an Instancer of fixed addresses.
+func FixedInstancer(addresses ...string) Instancer {
+	return func(context.Context) ([]string, error) { return addresses, nil }
+}
+
+// ClientRequestFunc may take information from a context and put it into the
+// outgoing HTTP request, e.g. to propagate a trace. It is executed before
+// every attempt to call an instance.
+type ClientRequestFunc func(ctx context.Context, r *http.Request) context.Context
+
+// ClientResponseFunc may take information from an HTTP response and put it
+// into the context. It is executed after every attempt that got a response,
+// prior to the response being decoded.
+type ClientResponseFunc func(ctx context.Context, r *http.Response) context.Context
+
+// ClientFinalizerFunc is executed at the end of every attempt, with the
+// context of its ClientRequestFuncs and its error, which may be nil.
+type ClientFinalizerFunc func(ctx context.Context, err error)
+
+// Client calls the endpoint of another REST service, balancing the calls
+// over the instances of the service. Its Endpoint is the client side
+// counterpart of Handle:
+//
+//	type getUser struct {
+//		ID     int64  `uri:"id"`
+//		Fields string `form:"fields"`
+//	}
+//
+//	users := rest.NewClient(http.MethodGet, "/users/:id", sd.Instancer(resolver, "users"), User{},
+//		rest.ClientRetries(2, 0))
+//	resp, err := users.Endpoint()(ctx, &getUser{ID: 42})
+//	user := resp.(*User)
+//
+// The fields of a struct request tagged uri fill the parameters of the
+// path, those tagged form the query and those tagged header the headers;
+// fields with a zero value are left out of the query and the headers. The
+// request is written as the body of POST, PUT and PATCH calls, rendered by
+// the content type of ClientContentType; a request implementing
+// render.Render is rendered as is.
+//
+// A successful response is bound to a new value of the type of response by
+// the binding of its Content-Type and returned as a pointer; with a nil
+// response the body is returned as []byte. Responses with a status of 400
+// or more are returned as *me.Problem errors, read from the problem
+// documents of mskit services.
+type Client struct {
+	method      string
+	path        string
+	instancer   Instancer
+	response    reflect.Type
+	client      *http.Client
+	scheme      string
+	contentType string
+	timeout     time.Duration
+	retries     int
+	backoff     time.Duration
+	balancer    *balancer
+	before      []ClientRequestFunc
+	after       []ClientResponseFunc
+	finalizer   []ClientFinalizerFunc
+}
+
+// NewClient returns a Client calling method on path of the instances of
+// instancer. path may have parameters, as in the routes of the service, e.g.
+// "/users/:id". Pass a zero value of the response type as response.
+func NewClient(method, path string, instancer Instancer, response interface{}, options ...ClientOption) *Client {
+	c := &Client{
+		method:      method,
+		path:        path,
+		instancer:   instancer,
+		client:      http.DefaultClient,
+		scheme:      "http",
+		contentType: binding.MIMEJSON,
+		timeout:     DefaultClientTimeout,
+		backoff:     DefaultClientBackoff,
+		balancer:    newBalancer(),
+	}
+	if response != nil {
+		c.response = reflect.TypeOf(reflect.Indirect(reflect.ValueOf(response)).Interface())
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// ClientOption sets an optional parameter for clients.
+type ClientOption func(*Client)
+
+// ClientBefore adds ClientRequestFuncs executed on the outgoing request of
+// every attempt.
+func ClientBefore(before ...ClientRequestFunc) ClientOption {
+	return func(c *Client) { c.before = append(c.before, before...) }
+}
+
+// ClientAfter adds ClientResponseFuncs executed on the response of every
+// attempt, prior to it being decoded.
+func ClientAfter(after ...ClientResponseFunc) ClientOption {
+	return func(c *Client) { c.after = append(c.after, after...) }
+}
+
+// ClientFinalizer adds ClientFinalizerFuncs executed at the end of every
+// attempt.
+func ClientFinalizer(f ...ClientFinalizerFunc) ClientOption {
+	return func(c *Client) { c.finalizer = append(c.finalizer, f...) }
+}
+
+// ClientHTTPClient sets the client sending the requests, by default
+// http.DefaultClient.
+func ClientHTTPClient(client *http.Client) ClientOption {
+	return func(c *Client) { c.client = client }
+}
+
+// ClientScheme sets the scheme of the requests, by default http.
+func ClientScheme(scheme string) ClientOption {
+	return func(c *Client) { c.scheme = scheme }
+}
+
+// ClientContentType sets the content type the request bodies are written
+// in: binding.MIMEJSON, the default, binding.MIMEXML or binding.MIMEYAML.
+func ClientContentType(contentType string) ClientOption {
+	return func(c *Client) { c.contentType = contentType }
+}
+
+// ClientTimeout sets the time limit of each attempt, DefaultClientTimeout
+// by default. 0 disables it.
+func ClientTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) { c.timeout = timeout }
+}
+
+// ClientRetries sets how many times a failed call is retried, on another
+// instance when there is one. Only the calls with an idempotent method are
+// retried, after network errors and 502, 503 and 504 responses. The n-th
+// retry waits backoff times 2^(n-1), DefaultClientBackoff if backoff is 0.
+func ClientRetries(retries int, backoff time.Duration) ClientOption {
+	return func(c *Client) {
+		c.retries = retries
+		if backoff > 0 {
+			c.backoff = backoff
+		}
+	}
+}
+
+// ClientSelectMode sets how the instance of a call is selected, RoundRobin
+// by default.
+func ClientSelectMode(mode SelectMode) ClientOption {
+	return func(c *Client) { c.balancer.mode = mode }
+}
+
+// ClientHashKey sets the key of a request selecting its instance in the
+// ConsistentHash mode. By default the key is the path and query of the
+// request.
+func ClientHashKey(key func(ctx context.Context, request interface{}) string) ClientOption {
+	return func(c *Client) { c.balancer.key = key }
+}
+
+// ClientBreaker sets the circuit breaker of the instances: an instance
+// failing failures calls in a row, with a network error or a 5xx response,
+// is not called for openPeriod, after which a single call tells whether it
+// recovered. failures below 1 disable the breakers. The default is
+// DefaultBreakerFailures and DefaultBreakerOpenPeriod.
+func ClientBreaker(failures int, openPeriod time.Duration) ClientOption {
+	return func(c *Client) {
+		c.balancer.failures = failures
+		c.balancer.openPeriod = openPeriod
+	}
+}
+
+// Endpoint returns an endpoint calling the service with the request it is
+// passed.
+func (c *Client) Endpoint() endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		target, header, body, err := c.encode(request)
+		if err != nil {
+			return nil, err
+		}
+		var key string
+		if c.balancer.mode == ConsistentHash {
+			key = target
+			if c.balancer.key != nil {
+				key = c.balancer.key(ctx, request)
+			}
+		}
+
+		tried := make(map[string]bool)
+		for attempt := 0; ; attempt++ {
+			if attempt > 0 {
+				if err := sleep(ctx, c.backoff<<(attempt-1)); err != nil {
+					return nil, err
+				}
+			}
+			addresses, err := c.instancer(ctx)
+			if err != nil {
+				return nil, err
+			}
+			address, b, err := c.balancer.pick(addresses, tried, key)
+			if err != nil {
+				return nil, err
+			}
+			tried[address] = true
+
+			response, status, err := c.call(ctx, address, target, header, body)
+			if err != nil && ctx.Err() != nil {
+				// the call was abandoned, the instance did not fail
+				b.release()
+				return nil, err
+			}
+			b.done(err == nil || (status > 0 && status < http.StatusInternalServerError))
+			if err == nil || attempt >= c.retries || !idempotent(c.method) || !retryable(status) {
+				return response, err
+			}
+		}
+	}
+}
+
+// call sends the request to address. status is the status code of the
+// response, 0 if there is none.
+func (c *Client) call(ctx context.Context, address, target string, header http.Header, body []byte) (response interface{}, status int, err error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, c.method, c.scheme+"://"+address+target, reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	for _, f := range c.before {
+		ctx = f(ctx, req)
+	}
+	if len(c.finalizer) > 0 {
+		defer func() {
+			for _, f := range c.finalizer {
+				f(ctx, err)
+			}
+		}()
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	for _, f := range c.after {
+		ctx = f(ctx, resp)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, resp.StatusCode, decodeProblem(resp)
+	}
+	response, err = c.decode(resp)
+	return response, resp.StatusCode, err
+}
+
+// encode returns the path and query, the headers and the body of request.
+func (c *Client) encode(request interface{}) (target string, header http.Header, body []byte, err error) {
+	header = make(http.Header)
+	path, query := c.path, url.Values{}
+	if v := reflect.ValueOf(request); v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Struct {
+		uri := make(map[string]string)
+		encodeFields(v.Elem(), func(tag, name string, values []string, zero bool) {
+			switch tag {
+			case "uri":
+				if len(values) > 0 {
+					uri[name] = values[0]
+				}
+			case "form":
+				if !zero {
+					query[name] = append(query[name], values...)
+				}
+			case "header":
+				if !zero {
+					for _, value := range values {
+						header.Add(name, value)
+					}
+				}
+			}
+		})
+		if path, err = expandPath(path, uri); err != nil {
+			return "", nil, nil, err
+		}
+	}
+	target = path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	if request == nil || !hasRequestBody(c.method) {
+		return target, header, nil, nil
+	}
+	r, ok := request.(render.Render)
+	if !ok {
+		switch c.contentType {
+		case binding.MIMEXML, binding.MIMEXML2:
+			r = render.XML{Data: request}
+		case binding.MIMEYAML:
+			r = render.YAML{Data: request}
+		case binding.MIMEJSON:
+			r = render.JSON{Data: request}
+		default:
+			return "", nil, nil, fmt.Errorf("cannot write request bodies as %s", c.contentType)
+		}
+	}
+	w := &bufferWriter{header: header}
+	if err := r.Render(w); err != nil {
+		return "", nil, nil, err
+	}
+	return target, header, w.buf.Bytes(), nil
+}
+
+// decode returns the response of resp.
+func (c *Client) decode(resp *http.Response) (interface{}, error) {
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if c.response == nil {
+		return body, nil
+	}
+	response := reflect.New(c.response).Interface()
+	if len(body) == 0 {
+		return response, nil
+	}
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	b, ok := binding.Default(http.MethodPost, ct).(binding.BindingBody)
+	if !ok || ct == "" {
+		b = binding.JSON
+	}
+	if err := b.BindBody(body, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// decodeProblem returns the error of a response with a status of 400 or
+// more.
+func decodeProblem(resp *http.Response) *me.Problem {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if ct == me.MIMEProblemJSON || ct == binding.MIMEJSON {
+		p := &me.Problem{}
+		if json.Unmarshal(body, p) == nil && (p.Code != "" || p.Detail != "" || p.Title != "") {
+			p.Status = resp.StatusCode
+			return p
+		}
+	}
+	return me.NewProblem(resp.StatusCode, "", strings.TrimSpace(string(body)))
+}
+
+// encodeFields calls f with the values of the fields of v tagged uri, form
+// or header, in the way binding maps them.
+func encodeFields(v reflect.Value, f func(tag, name string, values []string, zero bool)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf, fv := t.Field(i), v.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+		tagged := false
+		for _, tag := range []string{"uri", "form", "header"} {
+			name, _, _ := strings.Cut(sf.Tag.Get(tag), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			tagged = true
+			f(tag, name, fieldValues(fv, sf), fv.IsZero())
+		}
+		if !tagged {
+			if fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Time{}) {
+				encodeFields(fv, f)
+			}
+		}
+	}
+}
+
+func fieldValues(v reflect.Value, sf reflect.StructField) []string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		values := make([]string, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, fieldValues(v.Index(i), sf)...)
+		}
+		return values
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		layout := sf.Tag.Get("time_format")
+		switch layout {
+		case "":
+			layout = time.RFC3339
+		case "unix":
+			return []string{fmt.Sprint(t.Unix())}
+		case "unixnano":
+			return []string{fmt.Sprint(t.UnixNano())}
+		}
+		return []string{t.Format(layout)}
+	}
+	if d, ok := v.Interface().(time.Duration); ok {
+		return []string{d.String()}
+	}
+	return []string{fmt.Sprint(v.Interface())}
+}
+
+// expandPath replaces the parameters of path, :name and *name, with params.
+func expandPath(path string, params map[string]string) (string, error) {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if len(s) < 2 || (s[0] != ':' && s[0] != '*') {
+			continue
+		}
+		value, ok := params[s[1:]]
+		if !ok {
+			return "", fmt.Errorf("no value of the path parameter %s", s[1:])
+		}
+		if s[0] == '*' {
+			segments[i] = strings.TrimPrefix(value, "/")
+			continue
+		}
+		segments[i] = url.PathEscape(value)
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+func hasRequestBody(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		return true
+	}
+	return false
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryable reports whether a call failing with status, 0 for network
+// errors, may succeed on another instance.
+func retryable(status int) bool {
+	switch status {
+	case 0, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// bufferWriter is the http.ResponseWriter the request bodies are rendered
+// to.
+type bufferWriter struct {
+	header http.Header
+	buf    bytes.Buffer
+}
+
+func (w *bufferWriter) Header() http.Header         { return w.header }
+func (w *bufferWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+func (w *bufferWriter) WriteHeader(int)             {}
@@ -0,0 +1,171 @@
+package rest
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SelectMode is how a Client selects the instance of a call.
+type SelectMode int
+
+const (
+	// RoundRobin selects the instances in turn.
+	RoundRobin SelectMode = iota
+	// RandomSelect selects an instance at random.
+	RandomSelect
+	// ConsistentHash selects the instance of the hash key of the request,
+	// see ClientHashKey, so the calls of a key go to the same instance as
+	// long as it is available. Only the keys of an instance leaving or
+	// joining move.
+	ConsistentHash
+)
+
+// balancer selects the instances of the calls of a Client and holds their
+// circuit breakers.
+type balancer struct {
+	mode       SelectMode
+	key        func(ctx context.Context, request interface{}) string
+	failures   int
+	openPeriod time.Duration
+
+	mu       sync.Mutex
+	next     int
+	rand     *rand.Rand
+	breakers map[string]*breaker
+}
+
+func newBalancer() *balancer {
+	return &balancer{
+		failures:   DefaultBreakerFailures,
+		openPeriod: DefaultBreakerOpenPeriod,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		breakers:   make(map[string]*breaker),
+	}
+}
+
+// pick selects an instance of addresses, preferring those not tried yet,
+// whose breaker lets a call through. key is the hash key of the request.
+func (b *balancer) pick(addresses []string, tried map[string]bool, key string) (string, *breaker, error) {
+	if len(addresses) == 0 {
+		return "", nil, ErrNoInstances
+	}
+	candidates := make([]string, 0, len(addresses))
+	for _, a := range addresses {
+		if !tried[a] {
+			candidates = append(candidates, a)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = append(candidates, addresses...)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.mode {
+	case RandomSelect:
+		b.rand.Shuffle(len(candidates), func(i, j int) {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		})
+	case ConsistentHash:
+		// rendezvous hashing: the instances are ranked by the hash of the
+		// key with their address
+		scores := make(map[string]uint64, len(candidates))
+		for _, a := range candidates {
+			h := fnv.New64a()
+			h.Write([]byte(key))
+			h.Write([]byte(a))
+			scores[a] = h.Sum64()
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			return scores[candidates[i]] > scores[candidates[j]]
+		})
+	default:
+		sort.Strings(candidates)
+		n := b.next % len(candidates)
+		b.next++
+		candidates = append(append(make([]string, 0, len(candidates)), candidates[n:]...), candidates[:n]...)
+	}
+	b.prune(addresses)
+
+	now := time.Now()
+	for _, a := range candidates {
+		br := b.breakers[a]
+		if br == nil {
+			br = &breaker{failures: b.failures, openPeriod: b.openPeriod}
+			b.breakers[a] = br
+		}
+		if br.allow(now) {
+			return a, br, nil
+		}
+	}
+	return "", nil, ErrCircuitOpen
+}
+
+// prune drops the breakers of the instances gone.
+func (b *balancer) prune(addresses []string) {
+	if len(b.breakers) <= len(addresses) {
+		return
+	}
+	current := make(map[string]bool, len(addresses))
+	for _, a := range addresses {
+		current[a] = true
+	}
+	for a := range b.breakers {
+		if !current[a] {
+			delete(b.breakers, a)
+		}
+	}
+}
+
+// breaker is the circuit breaker of an instance. It opens after failures
+// failed calls in a row; once open, it lets a single call through every
+// openPeriod, which closes it if it succeeds.
+type breaker struct {
+	failures   int
+	openPeriod time.Duration
+
+	mu        sync.Mutex
+	failed    int
+	openUntil time.Time
+	probing   bool
+}
+
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < 1 || b.failed < b.failures {
+		return true
+	}
+	if b.probing || now.Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// done records the outcome of a call let through.
+func (b *breaker) done(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if ok {
+		b.failed = 0
+		return
+	}
+	b.failed++
+	if b.failures > 0 && b.failed >= b.failures {
+		b.openUntil = time.Now().Add(b.openPeriod)
+	}
+}
+
+// release records a call abandoned by its caller, which tells nothing of
+// the instance.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
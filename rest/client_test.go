@@ -0,0 +1,242 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	me "github.com/libra9z/mskit/v4/error"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// instance is a test server counting its requests.
+type instance struct {
+	*httptest.Server
+	mu   sync.Mutex
+	hits int
+}
+
+func newInstance(t *testing.T, h http.HandlerFunc) *instance {
+	i := &instance{}
+	i.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i.mu.Lock()
+		i.hits++
+		i.mu.Unlock()
+		h(w, r)
+	}))
+	t.Cleanup(i.Close)
+	return i
+}
+
+func (i *instance) address() string {
+	return strings.TrimPrefix(i.URL, "http://")
+}
+
+func (i *instance) count() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.hits
+}
+
+func status(code int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(code) }
+}
+
+func TestClientEndpoint(t *testing.T) {
+	s := httptest.NewServer(typedRouter(Handle(func(ctx context.Context, req *updateUser) (*userView, error) {
+		return &userView{ID: req.ID, Name: req.Name, Tenant: req.Tenant, Notify: req.Notify}, nil
+	})))
+	defer s.Close()
+
+	c := NewClient(http.MethodPut, "/users/:id", FixedInstancer(strings.TrimPrefix(s.URL, "http://")), userView{})
+	resp, err := c.Endpoint()(context.Background(), &updateUser{ID: 42, Notify: true, Tenant: "acme", Name: "ann"})
+	require.NoError(t, err)
+	assert.Equal(t, &userView{ID: 42, Name: "ann", Tenant: "acme", Notify: true}, resp)
+
+	_, err = c.Endpoint()(context.Background(), &updateUser{ID: 42, Tenant: "acme"})
+	p, ok := err.(*me.Problem)
+	require.True(t, ok, "%T", err)
+	assert.Equal(t, http.StatusBadRequest, p.Status)
+	assert.Equal(t, me.CodeValidation, p.Code)
+
+	c = NewClient(http.MethodPut, "/users/:id", FixedInstancer(strings.TrimPrefix(s.URL, "http://")), nil,
+		ClientContentType(MIMEXML))
+	resp, err = c.Endpoint()(context.Background(), &updateUser{ID: 7, Tenant: "acme", Name: "bob"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":7,"name":"bob","tenant":"acme","notify":false}`, string(resp.([]byte)))
+}
+
+func TestClientEncode(t *testing.T) {
+	type search struct {
+		Path   string    `uri:"path"`
+		Tags   []string  `form:"tag"`
+		Page   int       `form:"page"`
+		Since  time.Time `form:"since" time_format:"unix"`
+		Tenant string    `header:"X-Tenant"`
+	}
+	c := NewClient(http.MethodGet, "/files/*path", nil, nil)
+	target, header, body, err := c.encode(&search{Path: "/a/b c", Tags: []string{"x", "y"}, Since: time.Unix(60, 0), Tenant: "acme"})
+	require.NoError(t, err)
+	assert.Equal(t, "/files/a/b c?since=60&tag=x&tag=y", target, "zero values are left out")
+	assert.Equal(t, "acme", header.Get("X-Tenant"))
+	assert.Nil(t, body)
+
+	c = NewClient(http.MethodGet, "/users/:id", nil, nil)
+	_, _, _, err = c.encode(&search{})
+	assert.Error(t, err, "no value of id")
+	target, _, _, err = c.encode(&struct {
+		ID string `uri:"id"`
+	}{"a/b"})
+	require.NoError(t, err)
+	assert.Equal(t, "/users/a%2Fb", target)
+}
+
+func TestClientRetries(t *testing.T) {
+	bad := newInstance(t, status(http.StatusServiceUnavailable))
+	good := newInstance(t, status(http.StatusNoContent))
+	instancer := FixedInstancer(bad.address(), good.address())
+
+	c := NewClient(http.MethodGet, "/", instancer, nil, ClientRetries(1, time.Millisecond), ClientBreaker(0, 0))
+	for i := 0; i < 4; i++ {
+		_, err := c.Endpoint()(context.Background(), nil)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 4, good.count())
+	assert.Positive(t, bad.count())
+
+	// not idempotent
+	unavailable := newInstance(t, status(http.StatusServiceUnavailable))
+	c = NewClient(http.MethodPost, "/", FixedInstancer(unavailable.address()), nil, ClientRetries(3, time.Millisecond))
+	_, err := c.Endpoint()(context.Background(), nil)
+	assert.Equal(t, http.StatusServiceUnavailable, err.(*me.Problem).Status)
+	assert.Equal(t, 1, unavailable.count())
+
+	// not retryable
+	failing := newInstance(t, status(http.StatusNotFound))
+	c = NewClient(http.MethodGet, "/", FixedInstancer(failing.address()), nil, ClientRetries(3, time.Millisecond))
+	_, err = c.Endpoint()(context.Background(), nil)
+	assert.Error(t, err)
+	assert.Equal(t, 1, failing.count())
+}
+
+func TestClientTimeout(t *testing.T) {
+	slow := newInstance(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+	c := NewClient(http.MethodGet, "/", FixedInstancer(slow.address()), nil, ClientTimeout(10*time.Millisecond), ClientRetries(1, time.Millisecond))
+	start := time.Now()
+	_, err := c.Endpoint()(context.Background(), nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, 2, slow.count(), "a timeout is retried")
+}
+
+func TestClientBreaker(t *testing.T) {
+	var mu sync.Mutex
+	code := http.StatusInternalServerError
+	flaky := newInstance(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.WriteHeader(code)
+	})
+	good := newInstance(t, status(http.StatusNoContent))
+
+	c := NewClient(http.MethodGet, "/", FixedInstancer(flaky.address(), good.address()), nil, ClientBreaker(2, 200*time.Millisecond))
+	for i := 0; i < 10; i++ {
+		c.Endpoint()(context.Background(), nil)
+	}
+	assert.Equal(t, 2, flaky.count(), "open after 2 failures")
+
+	mu.Lock()
+	code = http.StatusNoContent
+	mu.Unlock()
+	time.Sleep(250 * time.Millisecond)
+	for i := 0; i < 4; i++ {
+		_, err := c.Endpoint()(context.Background(), nil)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 4, flaky.count(), "closed after a successful call")
+
+	c = NewClient(http.MethodGet, "/", FixedInstancer(good.address()), nil, ClientBreaker(1, time.Minute))
+	good.Close()
+	_, err := c.Endpoint()(context.Background(), nil)
+	assert.Error(t, err)
+	_, err = c.Endpoint()(context.Background(), nil)
+	assert.Equal(t, ErrCircuitOpen, err)
+
+	c = NewClient(http.MethodGet, "/", FixedInstancer(), nil)
+	_, err = c.Endpoint()(context.Background(), nil)
+	assert.Equal(t, ErrNoInstances, err)
+}
+
+func TestClientConsistentHash(t *testing.T) {
+	instances := []*instance{
+		newInstance(t, status(http.StatusNoContent)),
+		newInstance(t, status(http.StatusNoContent)),
+		newInstance(t, status(http.StatusNoContent)),
+	}
+	var addresses []string
+	for _, i := range instances {
+		addresses = append(addresses, i.address())
+	}
+	type get struct {
+		ID string `uri:"id"`
+	}
+	c := NewClient(http.MethodGet, "/users/:id", FixedInstancer(addresses...), nil, ClientSelectMode(ConsistentHash))
+	for i := 0; i < 5; i++ {
+		_, err := c.Endpoint()(context.Background(), &get{ID: "ann"})
+		require.NoError(t, err)
+	}
+	var counts []int
+	for _, i := range instances {
+		counts = append(counts, i.count())
+	}
+	assert.ElementsMatch(t, []int{5, 0, 0}, counts)
+}
+
+func TestClientHooks(t *testing.T) {
+	type key struct{}
+	var attempts []string
+	flaky := newInstance(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts = append(attempts, r.Header.Get("X-Attempt"))
+		if len(attempts) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	var events []string
+	c := NewClient(http.MethodDelete, "/", FixedInstancer(flaky.address()), nil,
+		ClientRetries(1, time.Millisecond),
+		ClientBefore(func(ctx context.Context, r *http.Request) context.Context {
+			events = append(events, "before")
+			r.Header.Set("X-Attempt", strconv.Itoa(len(events)))
+			return context.WithValue(ctx, key{}, r.URL.Host)
+		}),
+		ClientAfter(func(ctx context.Context, r *http.Response) context.Context {
+			events = append(events, "after "+strconv.Itoa(r.StatusCode))
+			return ctx
+		}),
+		ClientFinalizer(func(ctx context.Context, err error) {
+			assert.Equal(t, flaky.address(), ctx.Value(key{}))
+			events = append(events, "finalizer "+strconv.FormatBool(err == nil))
+		}),
+	)
+	_, err := c.Endpoint()(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"before", "after 502", "finalizer false",
+		"before", "after 204", "finalizer true",
+	}, events)
+	assert.Equal(t, []string{"1", "4"}, attempts, "the request is rebuilt for every attempt")
+}
@@ -1,13 +1,21 @@
 package rest
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/libra9z/mskit/v4/endpoint"
 	"github.com/libra9z/mskit/v4/log"
+	"net"
 	"net/http"
 )
 
+// ErrRequestAborted is handed to the error handler and error encoder when a
+// before function aborts the Mcontext without writing a response or
+// attaching an error to it.
+var ErrRequestAborted = errors.New("request aborted")
+
 // Server wraps an endpoint and implements http.Handler.
 type Engine struct {
 	e            endpoint.Endpoint
@@ -18,6 +26,7 @@ type Engine struct {
 	errorEncoder ErrorEncoder
 	finalizer    []ServerFinalizerFunc
 	errorHandler ErrorHandler
+	maxBodySize  int64
 }
 
 // NewServer constructs a new server, which implements http.Handler and wraps
@@ -89,57 +98,131 @@ func ServerFinalizer(f ...ServerFinalizerFunc) ServerOption {
 	return func(s *Engine) { s.finalizer = append(s.finalizer, f...) }
 }
 
+// ServerMaxBodySize limits the size of the request bodies read by the
+// decoder, see MaxBodySize. Routes may set their own limit, e.g. with
+// RestApi.SetMaxBodySize. NoBodyLimit disables the limit.
+func ServerMaxBodySize(n int64) ServerOption {
+	return func(s *Engine) { s.maxBodySize = n }
+}
+
 // ServeHTTP implements http.Handler.
+//
+// Before functions run in order until one returns an error or aborts the
+// Mcontext; the endpoint is then skipped and the error goes through the
+// error handler and the error encoder. An error returned by the endpoint or
+// an after function is treated the same way. The error encoder is not called
+// if a response has already been written, e.g. by AbortWithStatusJSON. If the
+// endpoint or an after function aborts, the remaining after functions and the
+// response encoder are skipped.
 func (s Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	if s.maxBodySize != 0 {
+		ctx = context.WithValue(ctx, ContextKeyMaxBodySize, s.maxBodySize)
+	}
 
+	iw := &interceptingWriter{ResponseWriter: w, code: http.StatusOK}
+	var failed error
 	if len(s.finalizer) > 0 {
-		iw := &interceptingWriter{w, http.StatusOK, 0}
 		defer func() {
 			ctx = context.WithValue(ctx, ContextKeyResponseHeaders, iw.Header())
 			ctx = context.WithValue(ctx, ContextKeyResponseSize, iw.written)
+			if failed != nil {
+				ctx = context.WithValue(ctx, ContextKeyResponseError, failed)
+			}
 			for _, f := range s.finalizer {
 				f(ctx, iw.code, r)
 			}
 		}()
-		w = iw
 	}
+	w = iw
 
 	request, err := s.dec(ctx, r, w)
 	if err != nil {
+		failed = err
 		s.errorHandler.Handle(ctx, err)
 		s.errorEncoder(ctx, err, w)
 		return
 	}
 
+	// The decoded Mcontext belongs to this request only. It travels in ctx
+	// from here on, and ctx is refreshed from mc.Ctx after each chain so
+	// values added by before/after functions (spans etc.) reach the endpoint,
+	// the encoder and the finalizers.
+	mc, _ := request.(*Mcontext)
+	if mc != nil {
+		ctx = context.WithValue(ctx, ContextKeyMcontext, mc)
+		mc.Ctx = ctx
+	}
+
 	for _, f := range s.before {
-		err = f(request.(*Mcontext), w)
-		if err != nil {
+		err = f(mc, w)
+		if mc != nil {
+			ctx = mc.Ctx
+		}
+		if err != nil || isAborted(mc) {
+			failed = s.abort(ctx, err, mc, iw)
 			return
 		}
 	}
 
 	response, err := s.e(ctx, request)
 	if err != nil {
-		s.errorHandler.Handle(ctx, err)
-		s.errorEncoder(ctx, err, w)
+		failed = s.abort(ctx, err, mc, iw)
+		return
+	}
+	if isAborted(mc) {
 		return
 	}
 
 	for _, f := range s.after {
-		err = f(request.(*Mcontext), w)
+		err = f(mc, w)
+		if mc != nil {
+			ctx = mc.Ctx
+		}
 		if err != nil {
+			failed = s.abort(ctx, err, mc, iw)
+			return
+		}
+		if isAborted(mc) {
 			return
 		}
 	}
 
 	if err := s.enc(ctx, w, response); err != nil {
+		failed = err
 		s.errorHandler.Handle(ctx, err)
 		s.errorEncoder(ctx, err, w)
 		return
 	}
 }
 
+// abort ends a request that was stopped by an error or by Mcontext.Abort.
+// If err is nil the last error attached to mc is used, and failing that
+// ErrRequestAborted. An aborted request which already wrote its response and
+// carries no error is left as it is. It returns the error handled, if any.
+func (s Engine) abort(ctx context.Context, err error, mc *Mcontext, w *interceptingWriter) error {
+	if err == nil && mc != nil {
+		if last := mc.Errors.Last(); last != nil {
+			err = last
+		}
+	}
+	if err == nil {
+		if w.wroteHeader {
+			return nil
+		}
+		err = ErrRequestAborted
+	}
+	s.errorHandler.Handle(ctx, err)
+	if !w.wroteHeader {
+		s.errorEncoder(ctx, err, w)
+	}
+	return err
+}
+
+func isAborted(mc *Mcontext) bool {
+	return mc != nil && mc.IsAborted()
+}
+
 // ErrorEncoder is responsible for encoding an error to the ResponseWriter.
 // Users are encouraged to use custom ErrorEncoders to encode HTTP errors to
 // their clients, and will likely want to pass and check for their own error
@@ -199,19 +282,34 @@ func DefaultErrorEncoder(_ context.Context, err error, w http.ResponseWriter) {
 		}
 	}
 	w.Header().Set("Content-Type", contentType)
-	if headerer, ok := err.(Headerer); ok {
+	addErrorHeaders(w, err)
+	w.WriteHeader(ErrorStatusCode(err, http.StatusInternalServerError))
+	w.Write(body)
+}
+
+// ErrorStatusCode returns the status code of the first error in err's chain
+// that implements StatusCoder, or def if there is none.
+func ErrorStatusCode(err error, def int) int {
+	var sc StatusCoder
+	if errors.As(err, &sc) {
+		if code := sc.StatusCode(); code > 0 {
+			return code
+		}
+	}
+	return def
+}
+
+// addErrorHeaders adds the headers of the first error in err's chain that
+// implements Headerer to the response.
+func addErrorHeaders(w http.ResponseWriter, err error) {
+	var headerer Headerer
+	if errors.As(err, &headerer) {
 		for k, values := range headerer.Headers() {
 			for _, v := range values {
 				w.Header().Add(k, v)
 			}
 		}
 	}
-	//code := http.StatusInternalServerError
-	//if sc, ok := err.(StatusCoder); ok {
-	//	code = sc.StatusCode()
-	//}
-	//w.WriteHeader(code)
-	w.Write(body)
 }
 
 // StatusCoder is checked by DefaultErrorEncoder. If an error value implements
@@ -230,19 +328,40 @@ type Headerer interface {
 
 type interceptingWriter struct {
 	http.ResponseWriter
-	code    int
-	written int64
+	code        int
+	written     int64
+	wroteHeader bool
 }
 
 // WriteHeader may not be explicitly called, so care must be taken to
 // initialize w.code to its default value of http.StatusOK.
 func (w *interceptingWriter) WriteHeader(code int) {
 	w.code = code
+	w.wroteHeader = true
 	w.ResponseWriter.WriteHeader(code)
 }
 
 func (w *interceptingWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
 	n, err := w.ResponseWriter.Write(p)
 	w.written += int64(n)
 	return n, err
 }
+
+// Flush implements the http.Flusher interface.
+func (w *interceptingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		f.Flush()
+	}
+}
+
+// Hijack implements the http.Hijacker interface.
+func (w *interceptingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the ResponseWriter doesn't support the Hijacker interface")
+	}
+	w.wroteHeader = true
+	return h.Hijack()
+}
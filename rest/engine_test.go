@@ -0,0 +1,245 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libra9z/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type userService struct {
+	RestApi
+}
+
+func (s *userService) Get(ctx context.Context, r *Mcontext) (interface{}, error) {
+	// give concurrent requests a chance to interleave
+	time.Sleep(time.Millisecond)
+	return H{"user": r.GetUserid(), "same": McontextFromContext(ctx) == r}, nil
+}
+
+func newUserEngine(svc RestService) *Engine {
+	svc.SetRouter(httprouter.New())
+	return NewEngine(
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			return svc.Get(ctx, request.(*Mcontext))
+		},
+		svc.DecodeRequest,
+		svc.EncodeResponse,
+		ServerBefore(func(c *Mcontext, _ http.ResponseWriter) error {
+			c.SetUserid(c.GetHeader("X-User"))
+			return nil
+		}),
+	)
+}
+
+func TestEngineMcontextTemplateNotShared(t *testing.T) {
+	svc := &userService{}
+	svc.SetMcontext(&Mcontext{UseRender: true})
+	e := newUserEngine(svc)
+
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("X-User", "u1")
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+
+	// UseRender is copied from the template, so the handler owns the writer
+	// and EncodeResponse writes nothing.
+	assert.Empty(t, w.Body.String())
+	assert.True(t, svc.Mcontext().UseRender)
+	assert.Empty(t, svc.Mcontext().Userid)
+}
+
+func TestEngineMcontextEncodesOwnResponse(t *testing.T) {
+	e := newUserEngine(&userService{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			uid := fmt.Sprintf("u%d", i)
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			req.Header.Set("X-User", uid)
+			w := httptest.NewRecorder()
+			e.ServeHTTP(w, req)
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+			assert.Equal(t, uid, got["user"])
+			assert.Equal(t, true, got["same"])
+		}(i)
+	}
+	wg.Wait()
+}
+
+type chainRecorder struct {
+	endpointCalled bool
+	handled        []error
+	encoded        []error
+}
+
+func (rec *chainRecorder) engine(before []MskitFunc, after []MskitFunc) *Engine {
+	svc := &userService{}
+	svc.SetRouter(httprouter.New())
+	var bs []RequestFunc
+	for _, f := range before {
+		bs = append(bs, RequestFunc(f))
+	}
+	var as []ServerResponseFunc
+	for _, f := range after {
+		as = append(as, ServerResponseFunc(f))
+	}
+	return NewEngine(
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			rec.endpointCalled = true
+			return H{"ok": true}, nil
+		},
+		svc.DecodeRequest,
+		svc.EncodeResponse,
+		ServerBefore(bs...),
+		ServerAfter(as...),
+		ServerErrorHandler(ErrorHandlerFunc(func(ctx context.Context, err error) {
+			rec.handled = append(rec.handled, err)
+		})),
+		ServerErrorEncoder(func(ctx context.Context, err error, w http.ResponseWriter) {
+			rec.encoded = append(rec.encoded, err)
+			w.WriteHeader(http.StatusTeapot)
+		}),
+	)
+}
+
+func serve(e *Engine) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+	return w
+}
+
+func TestEngineBeforeError(t *testing.T) {
+	errDenied := fmt.Errorf("denied")
+	rec := &chainRecorder{}
+	w := serve(rec.engine([]MskitFunc{func(*Mcontext, http.ResponseWriter) error { return errDenied }}, nil))
+
+	assert.False(t, rec.endpointCalled)
+	assert.Equal(t, []error{errDenied}, rec.handled)
+	assert.Equal(t, []error{errDenied}, rec.encoded)
+	assert.Equal(t, http.StatusTeapot, w.Code)
+}
+
+func TestEngineBeforeAbortWithResponse(t *testing.T) {
+	rec := &chainRecorder{}
+	w := serve(rec.engine([]MskitFunc{func(c *Mcontext, _ http.ResponseWriter) error {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, H{"error": "login required"})
+		return nil
+	}}, nil))
+
+	assert.False(t, rec.endpointCalled)
+	assert.Empty(t, rec.handled)
+	assert.Empty(t, rec.encoded)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"error":"login required"}`, w.Body.String())
+}
+
+func TestEngineBeforeAbortWithError(t *testing.T) {
+	errDenied := fmt.Errorf("denied")
+	rec := &chainRecorder{}
+	w := serve(rec.engine([]MskitFunc{func(c *Mcontext, _ http.ResponseWriter) error {
+		c.AbortWithError(http.StatusForbidden, errDenied)
+		return nil
+	}}, nil))
+
+	assert.False(t, rec.endpointCalled)
+	require.Len(t, rec.handled, 1)
+	assert.ErrorIs(t, rec.handled[0], errDenied)
+	assert.Empty(t, rec.encoded)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestEngineBeforeAbort(t *testing.T) {
+	rec := &chainRecorder{}
+	w := serve(rec.engine([]MskitFunc{func(c *Mcontext, _ http.ResponseWriter) error {
+		c.Abort()
+		return nil
+	}}, nil))
+
+	assert.False(t, rec.endpointCalled)
+	assert.Equal(t, []error{ErrRequestAborted}, rec.handled)
+	assert.Equal(t, []error{ErrRequestAborted}, rec.encoded)
+	assert.Equal(t, http.StatusTeapot, w.Code)
+}
+
+func TestEngineAfterAbortSkipsEncoding(t *testing.T) {
+	secondCalled := false
+	rec := &chainRecorder{}
+	w := serve(rec.engine(nil, []MskitFunc{
+		func(c *Mcontext, _ http.ResponseWriter) error {
+			c.String(http.StatusAccepted, "queued")
+			c.Abort()
+			return nil
+		},
+		func(c *Mcontext, _ http.ResponseWriter) error {
+			secondCalled = true
+			return nil
+		},
+	}))
+
+	assert.True(t, rec.endpointCalled)
+	assert.False(t, secondCalled)
+	assert.Empty(t, rec.encoded)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "queued", w.Body.String())
+}
+
+func TestHandlerEngineFinalizer(t *testing.T) {
+	var code int
+	e := NewHandlerEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusGone)
+	}), ServerFinalizer(func(ctx context.Context, c int, r *http.Request) {
+		code = c
+	}))
+
+	w := serve(e)
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Equal(t, http.StatusGone, code)
+}
+
+func TestHandlerEngineStatusOnly(t *testing.T) {
+	for _, code := range []int{http.StatusCreated, http.StatusNoContent, http.StatusNotModified} {
+		var finalized int
+		e := NewHandlerEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}), ServerFinalizer(func(ctx context.Context, c int, r *http.Request) {
+			finalized = c
+		}))
+
+		w := serve(e)
+		assert.Equal(t, code, w.Code)
+		assert.Equal(t, code, finalized)
+		assert.Empty(t, w.Body.String())
+	}
+}
+
+func TestEngineFinalizerError(t *testing.T) {
+	failure := fmt.Errorf("no such user")
+	var got error
+	e := NewEngine(
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			return nil, failure
+		},
+		DecodeHandlerRequest,
+		EncodeJSONResponse,
+		ServerFinalizer(func(ctx context.Context, code int, r *http.Request) {
+			got, _ = ctx.Value(ContextKeyResponseError).(error)
+		}),
+	)
+
+	serve(e)
+	assert.Equal(t, failure, got)
+}
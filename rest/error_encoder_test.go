@@ -0,0 +1,114 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/libra9z/httprouter"
+	me "github.com/libra9z/mskit/v4/error"
+	"github.com/stretchr/testify/assert"
+)
+
+type statusError struct {
+	code int
+}
+
+func (e statusError) Error() string        { return http.StatusText(e.code) }
+func (e statusError) StatusCode() int      { return e.code }
+func (e statusError) Headers() http.Header { return http.Header{"Retry-After": {"30"}} }
+
+func TestDefaultErrorEncoderStatusCode(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		code int
+	}{
+		{errors.New("boom"), http.StatusInternalServerError},
+		{statusError{http.StatusTooManyRequests}, http.StatusTooManyRequests},
+		{fmt.Errorf("wrapped: %w", statusError{http.StatusNotFound}), http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		DefaultErrorEncoder(context.Background(), tc.err, w)
+		assert.Equal(t, tc.code, w.Code, tc.err.Error())
+		assert.Equal(t, tc.err.Error(), w.Body.String())
+	}
+}
+
+func TestRestApiErrorEncoderHeaders(t *testing.T) {
+	w := httptest.NewRecorder()
+	(&RestApi{}).ErrorEncoder(context.Background(), statusError{http.StatusServiceUnavailable}, w)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, me.MIMEProblemJSON, w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"title":"Service Unavailable","status":503,"detail":"Service Unavailable"}`, w.Body.String())
+}
+
+func problemEngine(err error) *Engine {
+	svc := &userService{}
+	svc.SetRouter(httprouter.New())
+	return NewEngine(
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			return nil, err
+		},
+		svc.DecodeRequest,
+		svc.EncodeResponse,
+		ServerBefore(func(c *Mcontext, _ http.ResponseWriter) error {
+			c.Ctx = context.WithValue(c.Ctx, traceKey{}, "4bf92f3577b34da6")
+			return nil
+		}),
+		ServerErrorEncoder(svc.ErrorEncoder),
+	)
+}
+
+type traceKey struct{}
+
+func init() {
+	RegisterTraceIDFunc(func(ctx context.Context) string {
+		id, _ := ctx.Value(traceKey{}).(string)
+		return id
+	})
+}
+
+func TestProblemErrorEncoderNegotiation(t *testing.T) {
+	e := problemEngine(me.NewProblem(http.StatusNotFound, "user_not_found", "no user 42"))
+
+	for _, tc := range []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"", me.MIMEProblemJSON, `"code":"user_not_found"`},
+		{"application/json", "application/json; charset=utf-8", `"trace_id":"4bf92f3577b34da6"`},
+		{"application/problem+xml", me.MIMEProblemXML, `<problem xmlns="urn:ietf:rfc:7807">`},
+		{"application/xml", "application/xml; charset=utf-8", `<instance>/users/42</instance>`},
+		{"application/x-yaml", "application/x-yaml; charset=utf-8", "detail: no user 42"},
+		{"text/csv", me.MIMEProblemJSON, `"status":404`},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+		req.Header.Set("Accept", tc.accept)
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code, tc.accept)
+		assert.Equal(t, tc.contentType, w.Header().Get("Content-Type"), tc.accept)
+		assert.Contains(t, w.Body.String(), tc.body, tc.accept)
+	}
+}
+
+func TestAbortWithProblem(t *testing.T) {
+	rec := &chainRecorder{}
+	w := serve(rec.engine([]MskitFunc{func(c *Mcontext, _ http.ResponseWriter) error {
+		c.AbortWithProblem(me.NewProblem(http.StatusForbidden, "forbidden", "no access"))
+		return nil
+	}}, nil))
+
+	assert.False(t, rec.endpointCalled)
+	assert.Len(t, rec.handled, 1)
+	assert.Empty(t, rec.encoded)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, me.MIMEProblemJSON, w.Header().Get("Content-Type"))
+}
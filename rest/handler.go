@@ -0,0 +1,63 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/libra9z/mskit/v4/endpoint"
+)
+
+// NewHandlerEngine returns an Engine serving requests with h, so plain
+// http.Handlers get the before/after functions, error handling and
+// finalizers of the pipeline (tracing, metrics, ...). Endpoint middlewares
+// wrap the endpoint returned by HandlerEndpoint.
+func NewHandlerEngine(h http.Handler, options ...ServerOption) *Engine {
+	return NewEngine(HandlerEndpoint(h), DecodeHandlerRequest, NopResponseEncoder, options...)
+}
+
+// HandlerEndpoint returns an endpoint calling h with the response writer and
+// the request of the *Mcontext it is given. The request handed to h carries
+// the endpoint context, so spans and values added by before functions and
+// middlewares are visible to h. h writes the response itself, the status it
+// sets is sent even without a body; the endpoint returns a nil response.
+func HandlerEndpoint(h http.Handler) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		mc, ok := request.(*Mcontext)
+		if !ok || mc.Request == nil {
+			return nil, errors.New("no request available")
+		}
+		h.ServeHTTP(mc.Writer, mc.Request.WithContext(ctx))
+		mc.Writer.WriteHeaderNow()
+		return nil, nil
+	}
+}
+
+// DecodeHandlerRequest is a DecodeRequestFunc for http.Handlers. Unlike
+// RestApi.DecodeRequest it leaves the request body unread, so the handler
+// can consume it. The body is limited by ServerMaxBodySize only.
+func DecodeHandlerRequest(ctx context.Context, r *http.Request, w http.ResponseWriter) (interface{}, error) {
+	mc := &Mcontext{}
+	mc.Ctx = ctx
+	mc.reset()
+	mc.writermem.reset(w)
+	mc.Method = r.Method
+	if limit := MaxBodySize(ctx); limit != 0 {
+		if limit > 0 && r.ContentLength > limit {
+			return nil, ErrBodyTooLarge
+		}
+		r.Body = LimitBody(r.Body, limit)
+	}
+	mc.Request = r
+	mc.RemoteAddr = r.Header.Get("X-Real-IP")
+	if mc.RemoteAddr == "" {
+		mc.RemoteAddr = r.RemoteAddr
+	}
+	return mc, nil
+}
+
+// NopResponseEncoder is an EncodeResponseFunc writing nothing, for endpoints
+// which write their response themselves.
+func NopResponseEncoder(context.Context, http.ResponseWriter, interface{}) error {
+	return nil
+}
@@ -1,6 +1,7 @@
 package rest
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -542,23 +543,43 @@ func (c *Mcontext) ShouldBindUri(obj interface{}) error {
 
 // ShouldBindWith binds the passed struct pointer using the specified binding engine.
 // See the binding package.
+//
+// The body buffered by DecodeRequest (see Mcontext.Body) is bound, so the
+// same body can be bound several times, e.g. by a header or query pass then
+// a JSON pass. Bodies of streaming services are read from the request once.
 func (c *Mcontext) ShouldBindWith(obj interface{}, b binding.Binding) error {
+	if body, ok := c.bufferedBody(); ok {
+		if bb, ok := b.(binding.BindingBody); ok {
+			return bb.BindBody(body, obj)
+		}
+		// form bindings parse the request body
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
 	return b.Bind(c.Request, obj)
 }
 
-// ShouldBindBodyWith is similar with ShouldBindWith, but it stores the request
-// body into the context, and reuse when it is called again.
-//
-// NOTE: This method reads the body before binding. So you should use
-// ShouldBindWith for better performance if you need to call only once.
-func (c *Mcontext) ShouldBindBodyWith(obj interface{}, bb binding.BindingBody) (err error) {
-	var body []byte
+// bufferedBody returns the body of the request if it was read already, by
+// DecodeRequest or by ShouldBindBodyWith.
+func (c *Mcontext) bufferedBody() ([]byte, bool) {
+	if c.Body != nil {
+		return c.Body, true
+	}
 	if cb, ok := c.Get(BodyBytesKey); ok {
 		if cbb, ok := cb.([]byte); ok {
-			body = cbb
+			return cbb, true
 		}
 	}
-	if body == nil {
+	return nil, false
+}
+
+// ShouldBindBodyWith is similar with ShouldBindWith, but it stores the request
+// body into the context, and reuse when it is called again.
+//
+// NOTE: ShouldBindWith binds the body buffered by DecodeRequest as well. This
+// method is only needed to bind the body of a streaming service several times.
+func (c *Mcontext) ShouldBindBodyWith(obj interface{}, bb binding.BindingBody) (err error) {
+	body, ok := c.bufferedBody()
+	if !ok {
 		body, err = ioutil.ReadAll(c.Request.Body)
 		if err != nil {
 			return err
@@ -625,8 +646,12 @@ func (c *Mcontext) GetHeader(key string) string {
 	return c.requestHeader(key)
 }
 
-// GetRawData return stream data.
+// GetRawData returns the body of the request, buffered by DecodeRequest or
+// read from the request.
 func (c *Mcontext) GetRawData() ([]byte, error) {
+	if body, ok := c.bufferedBody(); ok {
+		return body, nil
+	}
 	return io.ReadAll(c.Request.Body)
 }
 
@@ -809,8 +834,18 @@ func (c *Mcontext) Negotiate(code int, config Negotiate) {
 		data := chooseData(config.JSONData, config.Data)
 		c.JSON(code, data)
 
-	case binding.MIMEXML:
+	case me.MIMEProblemJSON:
+		data := chooseData(config.JSONData, config.Data)
+		c.Header("Content-Type", me.MIMEProblemJSON)
+		c.JSON(code, data)
+
+	case binding.MIMEXML, binding.MIMEXML2:
+		data := chooseData(config.XMLData, config.Data)
+		c.XML(code, data)
+
+	case me.MIMEProblemXML:
 		data := chooseData(config.XMLData, config.Data)
+		c.Header("Content-Type", me.MIMEProblemXML)
 		c.XML(code, data)
 
 	case binding.MIMEYAML:
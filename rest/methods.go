@@ -0,0 +1,158 @@
+package rest
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+
+	me "github.com/libra9z/mskit/v4/error"
+)
+
+// Methods are the HTTP methods a RestService can serve, in the order they are
+// registered.
+var Methods = []string{
+	http.MethodGet,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodHead,
+	http.MethodOptions,
+	http.MethodTrace,
+}
+
+// ErrMethodNotAllowed is returned by the RestApi implementations of
+// Get/Post/Put/Patch/Delete/Trace, so requests for a method a service does
+// not override are answered with 405 Method Not Allowed.
+var ErrMethodNotAllowed = me.NewProblem(http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+
+// MethodLister may be implemented by a RestService to list the HTTP methods
+// it serves. Only those methods are registered with the router, which answers
+// the others with 405 and an Allow header. An empty list means all Methods.
+// RestApi implements it, see RestApi.SetMethods.
+type MethodLister interface {
+	Methods() []string
+}
+
+// ServiceMethods returns the methods svc is registered for: the ones it lists
+// if it implements MethodLister, otherwise all Methods.
+func ServiceMethods(svc RestService) []string {
+	if ml, ok := svc.(MethodLister); ok {
+		if methods := ml.Methods(); len(methods) > 0 {
+			return methods
+		}
+	}
+	return Methods
+}
+
+// AllowedMethods returns the methods reported in the Allow header when svc
+// answers a request with ErrMethodNotAllowed: the ones it lists if it
+// implements MethodLister, otherwise the Methods it overrides from RestApi,
+// along with HEAD and OPTIONS which RestApi serves by default.
+//
+// Telling the overridden methods apart is best-effort: it relies on the
+// compiler wrapping the methods promoted from embedded fields. A method it
+// cannot resolve, e.g. promoted from an embedded interface, is reported as
+// allowed. Only the Allow header depends on it, never the routing.
+func AllowedMethods(svc RestService) []string {
+	if ml, ok := svc.(MethodLister); ok {
+		if methods := ml.Methods(); len(methods) > 0 {
+			return methods
+		}
+	}
+	t := reflect.TypeOf(svc)
+	var methods []string
+	for _, m := range Methods {
+		if m == http.MethodHead || m == http.MethodOptions || overrides(t, methodNames[m]) {
+			methods = append(methods, m)
+		}
+	}
+	return methods
+}
+
+// methodNames maps the Methods to the RestService methods serving them.
+var methodNames = map[string]string{
+	http.MethodGet:     "Get",
+	http.MethodPost:    "Post",
+	http.MethodPut:     "Put",
+	http.MethodPatch:   "Patch",
+	http.MethodDelete:  "Delete",
+	http.MethodHead:    "Head",
+	http.MethodOptions: "Options",
+	http.MethodTrace:   "Trace",
+}
+
+var restApiType = reflect.TypeOf((*RestApi)(nil))
+
+// overrides reports whether the method name of t is not the one of RestApi.
+// A method promoted from an embedded field is compiled to a wrapper, so the
+// embedded fields are followed until the type declaring the method.
+func overrides(t reflect.Type, name string) bool {
+	if t == restApiType {
+		return false
+	}
+	m, ok := t.MethodByName(name)
+	if !ok {
+		return false
+	}
+	pc := m.Func.Pointer()
+	if file, _ := runtime.FuncForPC(pc).FileLine(pc); file != "<autogenerated>" {
+		return true
+	}
+
+	st := t
+	if t.Kind() == reflect.Ptr {
+		// a method with a value receiver called through a pointer
+		if _, ok := t.Elem().MethodByName(name); ok {
+			return overrides(t.Elem(), name)
+		}
+		st = t.Elem()
+	}
+	if st.Kind() != reflect.Struct {
+		return true
+	}
+	for i := 0; i < st.NumField(); i++ {
+		f := st.Field(i)
+		if !f.Anonymous {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() != reflect.Ptr {
+			ft = reflect.PtrTo(ft)
+		}
+		if _, ok := ft.MethodByName(name); ok {
+			return overrides(ft, name)
+		}
+	}
+	return true
+}
+
+// MethodNotAllowedError is ErrMethodNotAllowed with the methods to report in
+// the Allow header of the response.
+type MethodNotAllowedError struct {
+	Allow []string
+}
+
+// Error implements the error interface.
+func (e *MethodNotAllowedError) Error() string {
+	return ErrMethodNotAllowed.Error()
+}
+
+// StatusCode implements StatusCoder.
+func (e *MethodNotAllowedError) StatusCode() int {
+	return http.StatusMethodNotAllowed
+}
+
+// Headers implements Headerer.
+func (e *MethodNotAllowedError) Headers() http.Header {
+	if len(e.Allow) == 0 {
+		return nil
+	}
+	return http.Header{"Allow": []string{strings.Join(e.Allow, ", ")}}
+}
+
+// Unwrap returns ErrMethodNotAllowed.
+func (e *MethodNotAllowedError) Unwrap() error {
+	return ErrMethodNotAllowed
+}
@@ -0,0 +1,62 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type usersService struct {
+	RestApi
+}
+
+func (s *usersService) Get(ctx context.Context, r *Mcontext) (interface{}, error) {
+	return nil, nil
+}
+
+type adminService struct {
+	usersService
+}
+
+func (s adminService) Delete(ctx context.Context, r *Mcontext) (interface{}, error) {
+	return nil, nil
+}
+
+type auditedService struct {
+	adminService
+}
+
+type proxyService struct {
+	RestService
+}
+
+func TestServiceMethods(t *testing.T) {
+	assert.Equal(t, Methods, ServiceMethods(&usersService{}))
+
+	svc := &usersService{}
+	svc.SetMethods(http.MethodGet, http.MethodPost)
+	assert.Equal(t, []string{http.MethodGet, http.MethodPost}, ServiceMethods(svc))
+}
+
+func TestAllowedMethods(t *testing.T) {
+	getDelete := []string{http.MethodGet, http.MethodDelete, http.MethodHead, http.MethodOptions}
+	for _, tc := range []struct {
+		name string
+		svc  RestService
+		want []string
+	}{
+		{"RestApi", &RestApi{}, []string{http.MethodHead, http.MethodOptions}},
+		{"pointer receiver", &usersService{}, []string{http.MethodGet, http.MethodHead, http.MethodOptions}},
+		{"value receiver", &adminService{}, getDelete},
+		{"multi-level embedding", &auditedService{}, getDelete},
+		{"embedded interface", &proxyService{RestService: &usersService{}}, Methods},
+	} {
+		assert.Equal(t, tc.want, AllowedMethods(tc.svc), tc.name)
+	}
+
+	svc := &usersService{}
+	svc.SetMethods(http.MethodGet, http.MethodPost)
+	assert.Equal(t, []string{http.MethodGet, http.MethodPost}, AllowedMethods(svc))
+}
@@ -0,0 +1,98 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/libra9z/mskit/v4/binding"
+	me "github.com/libra9z/mskit/v4/error"
+)
+
+// TraceIDFunc returns the ID of the trace carried by ctx, or "" if ctx holds
+// no span. Tracer implementations register one with RegisterTraceIDFunc so
+// the rest package can stamp problems without depending on them.
+type TraceIDFunc func(ctx context.Context) string
+
+var (
+	traceIDMu    sync.RWMutex
+	traceIDFuncs []TraceIDFunc
+)
+
+// RegisterTraceIDFunc adds f to the functions consulted by TraceID.
+func RegisterTraceIDFunc(f TraceIDFunc) {
+	traceIDMu.Lock()
+	traceIDFuncs = append(traceIDFuncs, f)
+	traceIDMu.Unlock()
+}
+
+// TraceID returns the ID of the trace carried by ctx, as reported by the
+// first registered TraceIDFunc that knows it.
+func TraceID(ctx context.Context) string {
+	traceIDMu.RLock()
+	defer traceIDMu.RUnlock()
+	for _, f := range traceIDFuncs {
+		if id := f(ctx); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// problemOffers are the formats a problem can be rendered in, in order of
+// preference.
+var problemOffers = []string{
+	me.MIMEProblemJSON,
+	binding.MIMEJSON,
+	me.MIMEProblemXML,
+	binding.MIMEXML,
+	binding.MIMEXML2,
+	binding.MIMEYAML,
+}
+
+// ProblemErrorEncoder writes err as an RFC 7807 problem details document,
+// see error.AsProblem for how errors are mapped. The trace ID and the
+// request path are filled in from ctx. When the request Mcontext is in ctx
+// the format is negotiated from the Accept header, otherwise
+// application/problem+json is written.
+func ProblemErrorEncoder(ctx context.Context, err error, w http.ResponseWriter) {
+	p := me.AsProblem(err)
+	if p.TraceID == "" {
+		p.TraceID = TraceID(ctx)
+	}
+	addErrorHeaders(w, err)
+
+	if mc := McontextFromContext(ctx); mc != nil && mc.Request != nil {
+		if p.Instance == "" {
+			p.Instance = mc.Request.URL.Path
+		}
+		mc.writermem.reset(w)
+		mc.Problem(p)
+		return
+	}
+
+	w.Header().Set("Content-Type", me.MIMEProblemJSON)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Problem writes p with its status code as application/problem+json, or as
+// XML or YAML if the client asks for it in the Accept header. Formats the
+// client does not accept fall back to application/problem+json.
+func (c *Mcontext) Problem(p *me.Problem) {
+	offered := problemOffers
+	if c.NegotiateFormat(offered...) == "" {
+		offered = offered[:1]
+		c.SetAccepted(me.MIMEProblemJSON)
+	}
+	c.Negotiate(p.Status, Negotiate{Offered: offered, Data: p})
+}
+
+// AbortWithProblem calls `Abort()`, attaches p to `c.Errors` and writes it
+// with Problem.
+func (c *Mcontext) AbortWithProblem(p *me.Problem) {
+	c.Abort()
+	c.Error(p) // nolint: errcheck
+	c.Problem(p)
+}
@@ -103,4 +103,27 @@ const (
 	// ContextKeyResponseSize is populated in the context whenever a
 	// ServerFinalizerFunc is specified. Its value is of type int64.
 	ContextKeyResponseSize
+
+	// ContextKeyMcontext is populated in the context by Engine once the
+	// request has been decoded. Its value is of type *Mcontext.
+	ContextKeyMcontext
+
+	// ContextKeyMaxBodySize is populated in the context by Engine when the
+	// ServerMaxBodySize option is set. Its value is of type int64.
+	ContextKeyMaxBodySize
+
+	// ContextKeyResponseError is populated in the context whenever a
+	// ServerFinalizerFunc is specified and the request failed. Its value is
+	// the error passed to the error encoder.
+	ContextKeyResponseError
 )
+
+// McontextFromContext returns the per-request Mcontext stored in ctx by
+// Engine, or nil if there is none.
+func McontextFromContext(ctx context.Context) *Mcontext {
+	if ctx == nil {
+		return nil
+	}
+	mc, _ := ctx.Value(ContextKeyMcontext).(*Mcontext)
+	return mc
+}
@@ -42,11 +42,20 @@ func (c AftersChain) Last() MskitFunc {
 }
 
 type RestApi struct {
+	// Request is no longer populated, because a RestApi is shared by every
+	// request routed to it. Use Mcontext.Request instead.
+	//
+	// Deprecated: use the Request field of the per-request Mcontext.
 	Request *http.Request
 	Router  *httprouter.Router
 	after   AftersChain
 	before  BeforesChain
 	mc      *Mcontext
+
+	methods         []string
+	propagateErrors bool
+	maxBodySize     int64
+	streamBody      bool
 }
 
 func (c *RestApi) After() AftersChain {
@@ -65,10 +74,16 @@ func (c *RestApi) BeforeUse(handlerFunc ...MskitFunc) {
 	c.before = append(c.before, handlerFunc...)
 }
 
+// Mcontext returns the service level Mcontext set by SetMcontext. It is a
+// template only; the context of the request being served is the one passed
+// to Get/Post/... and stored in ctx (see McontextFromContext).
 func (c *RestApi) Mcontext() *Mcontext {
 	return c.mc
 }
 
+// SetMcontext sets a template Mcontext. Its UseRender, EnableCors and
+// UseContextWriter settings are copied into every request context created by
+// DecodeRequest; the template itself is never modified by requests.
 func (c *RestApi) SetMcontext(mc *Mcontext) {
 	c.mc = mc
 }
@@ -80,42 +95,58 @@ func (c *RestApi) SetRouter(r *httprouter.Router) {
 
 // Get adds a request function to handle GET request.
 func (c *RestApi) Get(ctx context.Context, r *Mcontext) (interface{}, error) {
-	return nil, nil
+	return nil, ErrMethodNotAllowed
 }
 
 // Post adds a request function to handle POST request.
 func (c *RestApi) Post(ctx context.Context, r *Mcontext) (interface{}, error) {
-	return nil, nil
+	return nil, ErrMethodNotAllowed
 }
 
 // Delete adds a request function to handle DELETE request.
 func (c *RestApi) Delete(ctx context.Context, r *Mcontext) (interface{}, error) {
-	return nil, nil
+	return nil, ErrMethodNotAllowed
 }
 
 // Put adds a request function to handle PUT request.
 func (c *RestApi) Put(ctx context.Context, r *Mcontext) (interface{}, error) {
-	return nil, nil
+	return nil, ErrMethodNotAllowed
 }
 
-// Head adds a request function to handle HEAD request.
+// Head adds a request function to handle HEAD request. By default it answers
+// with an empty response.
 func (c *RestApi) Head(ctx context.Context, r *Mcontext) (interface{}, error) {
 	return nil, nil
 }
 
 // Patch adds a request function to handle PATCH request.
 func (c *RestApi) Patch(ctx context.Context, r *Mcontext) (interface{}, error) {
-	return nil, nil
+	return nil, ErrMethodNotAllowed
 }
 
-// Options adds a request function to handle OPTIONS request.
+// Options adds a request function to handle OPTIONS request. By default it
+// answers with an empty response, e.g. to CORS preflight requests.
 func (c *RestApi) Options(ctx context.Context, r *Mcontext) (interface{}, error) {
 	return nil, nil
 }
 
-// Options adds a request function to handle OPTIONS request.
+// Trace adds a request function to handle TRACE request.
 func (c *RestApi) Trace(ctx context.Context, r *Mcontext) (interface{}, error) {
-	return nil, nil
+	return nil, ErrMethodNotAllowed
+}
+
+// Methods implements MethodLister.
+func (c *RestApi) Methods() []string {
+	return c.methods
+}
+
+// SetMethods restricts the HTTP methods the service is registered for, e.g.
+// SetMethods(http.MethodGet, http.MethodPost) for a service overriding Get
+// and Post only. Requests with other methods are answered with 405 by the
+// router. By default the service is registered for all Methods and the ones
+// it does not override return ErrMethodNotAllowed.
+func (c *RestApi) SetMethods(methods ...string) {
+	c.methods = methods
 }
 
 // GetErrorResponse adds a restservice used for endpoint.
@@ -123,6 +154,51 @@ func (c *RestApi) GetErrorResponse() interface{} {
 	return nil
 }
 
+// PropagateErrors implements ErrorPropagator.
+func (c *RestApi) PropagateErrors() bool {
+	return c.propagateErrors
+}
+
+// SetPropagateErrors chooses how errors returned by Get/Post/... are
+// reported. When propagate is false (the default) they are replaced by
+// GetErrorResponse and a successful response; when it is true they are
+// returned to the engine and encoded by ErrorEncoder.
+func (c *RestApi) SetPropagateErrors(propagate bool) {
+	c.propagateErrors = propagate
+}
+
+// SetMaxBodySize limits the size of the request bodies of the service to n
+// bytes; larger requests are answered with 413. It overrides the limit of
+// the engine (see ServerMaxBodySize) and DefaultMaxBodySize. NoBodyLimit
+// disables the limit.
+func (c *RestApi) SetMaxBodySize(n int64) {
+	c.maxBodySize = n
+}
+
+// SetStreamBody makes DecodeRequest leave request bodies unread, so large
+// bodies are not buffered in Mcontext.Body. The service reads them with
+// Mcontext.BodyReader; the limit set by SetMaxBodySize or ServerMaxBodySize
+// still applies, DefaultMaxBodySize does not.
+func (c *RestApi) SetStreamBody(stream bool) {
+	c.streamBody = stream
+}
+
+// bodyLimit returns the size limit of the request bodies of ctx. The bodies
+// DecodeRequest does not buffer, multipart or streamed ones, are only
+// limited by the limit of the service or of the engine.
+func (c *RestApi) bodyLimit(ctx context.Context, buffered bool) int64 {
+	if c.maxBodySize != 0 {
+		return c.maxBodySize
+	}
+	if n := MaxBodySize(ctx); n != 0 {
+		return n
+	}
+	if !buffered {
+		return NoBodyLimit
+	}
+	return DefaultMaxBodySize
+}
+
 // DecodeRequest adds a restservice used for endpoint.
 /*
 需要在nginx上配置
@@ -130,11 +206,14 @@ proxy_set_header Remote_addr $remote_addr;
 */
 func (c *RestApi) DecodeRequest(ctx context.Context, r *http.Request, w http.ResponseWriter) (request interface{}, err error) {
 
-	c.Request = r
-
 	req := &Mcontext{}
 	req.Ctx = ctx
 	req.reset()
+	if c.mc != nil {
+		req.UseRender = c.mc.UseRender
+		req.EnableCors = c.mc.EnableCors
+		req.useContextWriter = c.mc.useContextWriter
+	}
 	req.Method = r.Method
 	//req.writermem.reset(w)
 	req.Queries = make(map[string]interface{})
@@ -171,10 +250,18 @@ func (c *RestApi) DecodeRequest(ctx context.Context, r *http.Request, w http.Res
 		req.RemoteAddr = ip
 	}
 
+	multipart := strings.Contains(r.Header.Get("Content-Type"), "multipart/form-data")
+	limit := c.bodyLimit(ctx, !multipart && !c.streamBody)
+	if limit >= 0 && r.ContentLength > limit {
+		return nil, ErrBodyTooLarge
+	}
+	r.Body = LimitBody(r.Body, limit)
 	req.Request = r
 
-	if !strings.Contains(r.Header.Get("Content-Type"), "multipart/form-data") {
-		req.Body, err = io.ReadAll(r.Body)
+	if !multipart {
+		if !c.streamBody {
+			req.Body, err = io.ReadAll(r.Body)
+		}
 
 		if strings.Contains(r.Header.Get("Content-Type"), "application/json") {
 			req.ContentType = CONTENT_TYPE_JSON
@@ -190,7 +277,6 @@ func (c *RestApi) DecodeRequest(ctx context.Context, r *http.Request, w http.Res
 
 	mc, _ := c.Prepare(req)
 	mc.writermem.reset(w)
-	c.mc = mc
 
 	return mc, err
 }
@@ -215,20 +301,20 @@ func (c *RestApi) Finish(w http.ResponseWriter, response interface{}) error {
 func (c *RestApi) EncodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 
 	var err error
-	//w = c.mc.writermem.ResponseWriter
 
 	if response == nil {
 		response = ""
 	}
-	if !c.mc.useContextWriter && !c.mc.UseRender {
+	mc := McontextFromContext(ctx)
+	if mc == nil || (!mc.useContextWriter && !mc.UseRender) {
 		err = c.Finish(w, response)
 	} else {
-		if !c.mc.UseRender {
-			switch c.mc.ContentType {
+		if !mc.UseRender {
+			switch mc.ContentType {
 			case CONTENT_TYPE_JSON:
-				c.mc.JSON(http.StatusOK, response)
+				mc.JSON(http.StatusOK, response)
 			case CONTENT_TYPE_XML:
-				c.mc.XML(http.StatusOK, response)
+				mc.XML(http.StatusOK, response)
 			}
 		}
 	}
@@ -236,19 +322,9 @@ func (c *RestApi) EncodeResponse(ctx context.Context, w http.ResponseWriter, res
 	return err
 }
 
-type errorWrapper struct {
-	Error string `json:"error"`
-}
-
-func (c *RestApi) ErrorEncoder(_ context.Context, err error, w http.ResponseWriter) {
-	code := http.StatusInternalServerError
-	msg := err.Error()
-
-	switch err {
-	case ErrTwoZeroes, ErrMaxSizeExceeded, ErrIntOverflow:
-		code = http.StatusBadRequest
-	}
-
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(errorWrapper{Error: msg})
+// ErrorEncoder writes err as an RFC 7807 problem details document, see
+// ProblemErrorEncoder. Errors implementing StatusCoder and Headerer set the
+// status code and extra headers of the response.
+func (c *RestApi) ErrorEncoder(ctx context.Context, err error, w http.ResponseWriter) {
+	ProblemErrorEncoder(ctx, err, w)
 }
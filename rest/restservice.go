@@ -2,40 +2,35 @@ package rest
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"net/http"
 
 	"github.com/libra9z/httprouter"
+	me "github.com/libra9z/mskit/v4/error"
 )
 
 var (
 	// ErrTwoZeroes is an arbitrary business rule for the Add method.
-	ErrTwoZeroes = errors.New("can't sum two zeroes")
+	//
+	// Deprecated: sample error, return an *error.Problem instead.
+	ErrTwoZeroes = me.NewProblem(http.StatusBadRequest, "", "can't sum two zeroes")
 
-	// ErrIntOverflow protects the Add method. We've decided that this error
-	// indicates a misbehaving service and should count against e.g. circuit
-	// breakers. So, we return it directly in endpoints, to illustrate the
-	// difference. In a real service, this probably wouldn't be the case.
-	ErrIntOverflow = errors.New("integer overflow")
+	// ErrIntOverflow protects the Add method.
+	//
+	// Deprecated: sample error, return an *error.Problem instead.
+	ErrIntOverflow = me.NewProblem(http.StatusBadRequest, "", "integer overflow")
 
 	// ErrMaxSizeExceeded protects the Concat method.
-	ErrMaxSizeExceeded = errors.New("result exceeds maximum size")
+	//
+	// Deprecated: sample error, return an *error.Problem instead.
+	ErrMaxSizeExceeded = me.NewProblem(http.StatusBadRequest, "", "result exceeds maximum size")
 )
-func JsonErrorEncoder(ctx context.Context, err error, w http.ResponseWriter) {
-	code := http.StatusInternalServerError
-	msg := err.Error()
-
-	switch err {
-	case ErrTwoZeroes, ErrMaxSizeExceeded, ErrIntOverflow:
-		code = http.StatusBadRequest
-	}
 
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(errorWrapper{Error: msg})
+// JsonErrorEncoder writes err as an RFC 7807 problem details document, see
+// ProblemErrorEncoder.
+func JsonErrorEncoder(ctx context.Context, err error, w http.ResponseWriter) {
+	ProblemErrorEncoder(ctx, err, w)
 }
 
-
 type RestService interface {
 	Get(context.Context, *Mcontext) (interface{}, error)
 	Post(context.Context, *Mcontext) (interface{}, error)
@@ -63,3 +58,14 @@ type RestService interface {
 	EncodeResponse(context.Context, http.ResponseWriter, interface{}) error
 	ErrorEncoder( context.Context, error, http.ResponseWriter)
 }
+
+// ErrorPropagator may be implemented by a RestService to choose how errors
+// returned by its Get/Post/... methods are reported. If PropagateErrors
+// returns true the error is handed to the engine, so it is logged by the
+// ErrorHandler, seen by tracing finalizers and written by ErrorEncoder.
+// Otherwise the legacy behavior applies: the error is replaced by
+// GetErrorResponse() and a successful response. RestApi implements it, see
+// RestApi.SetPropagateErrors.
+type ErrorPropagator interface {
+	PropagateErrors() bool
+}
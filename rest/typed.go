@@ -0,0 +1,147 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/libra9z/mskit/v4/binding"
+	"github.com/libra9z/mskit/v4/endpoint"
+	me "github.com/libra9z/mskit/v4/error"
+)
+
+// ErrNotAcceptable is returned by EncodeNegotiatedResponse when the client
+// accepts none of the formats a response can be written in.
+var ErrNotAcceptable = me.NewProblem(http.StatusNotAcceptable, "not_acceptable", "the accepted formats are not offered by the server")
+
+// responseOffers are the formats responses are negotiated in, in order of
+// preference.
+var responseOffers = []string{
+	binding.MIMEJSON,
+	binding.MIMEXML,
+	binding.MIMEXML2,
+	binding.MIMEYAML,
+}
+
+// Handle returns an endpoint serving f with typed requests and responses:
+//
+//	type getUser struct {
+//		ID     int64  `uri:"id" binding:"required"`
+//		Fields string `form:"fields"`
+//	}
+//
+//	srv.Handle(http.MethodGet, "/users/:id", rest.Handle(func(ctx context.Context, req *getUser) (*User, error) {
+//		return users.Get(ctx, req.ID)
+//	}))
+//
+// The request of the endpoint is the *Mcontext of the request, bound to a new
+// Req with ShouldBindRequest; errors are returned as 400 problems. The *Resp
+// returned by f is the response of the endpoint, so endpoint middlewares see
+// it, and is written by EncodeNegotiatedResponse. A nil *Resp is a 204.
+func Handle[Req any, Resp any](f func(ctx context.Context, req *Req) (*Resp, error)) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		mc, ok := request.(*Mcontext)
+		if !ok || mc.Request == nil {
+			return nil, errors.New("no request available")
+		}
+		req := new(Req)
+		if err := mc.ShouldBindRequest(req); err != nil {
+			return nil, err
+		}
+		resp, err := f(ctx, req)
+		if err != nil || resp == nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// ShouldBindRequest binds, in this order, the uri parameters, the query, the
+// headers and the body of the request to obj, by the uri, form and header
+// tags of its fields and with the binding selected by the Content-Type for
+// the body. obj is then validated with binding.Validator. Bind errors are
+// returned as *me.Error of type ErrorTypeBind, validation errors as they
+// are; both are written as 400 problems by ProblemErrorEncoder.
+func (c *Mcontext) ShouldBindRequest(obj interface{}) error {
+	if isStructPtr(obj) {
+		uri := make(map[string][]string, len(c.Params))
+		for _, p := range c.Params {
+			uri[p.Key] = []string{p.Value}
+		}
+		if err := binding.MapFormWithTag(obj, uri, "uri"); err != nil {
+			return bindError(err)
+		}
+		if err := binding.MapFormWithTag(obj, c.Request.URL.Query(), "form"); err != nil {
+			return bindError(err)
+		}
+		if err := binding.MapHeader(obj, c.Request.Header); err != nil {
+			return bindError(err)
+		}
+	}
+
+	if !c.hasBody() {
+		if binding.Validator == nil {
+			return nil
+		}
+		return bindError(binding.Validator.ValidateStruct(obj))
+	}
+	// the body binding validates obj
+	return bindError(c.ShouldBindWith(obj, binding.Default(c.Request.Method, c.ContentTypeString())))
+}
+
+// hasBody reports whether the request has a body to bind.
+func (c *Mcontext) hasBody() bool {
+	if body, ok := c.bufferedBody(); ok {
+		return len(body) > 0
+	}
+	r := c.Request
+	return r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0
+}
+
+func isStructPtr(obj interface{}) bool {
+	v := reflect.ValueOf(obj)
+	return v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct
+}
+
+// bindError marks err as a bind error, unless it is a validation error.
+func bindError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var ves validator.ValidationErrors
+	if errors.As(err, &ves) {
+		return err
+	}
+	return &me.Error{Err: err, Type: me.ErrorTypeBind}
+}
+
+// EncodeNegotiatedResponse is an EncodeResponseFunc writing response as JSON,
+// XML or YAML, as negotiated from the Accept header of the request. The
+// status code is 200, or the one of a response implementing StatusCoder. A
+// nil response is written as 204 No Content.
+func EncodeNegotiatedResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if response == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	code := http.StatusOK
+	if sc, ok := response.(StatusCoder); ok && sc.StatusCode() > 0 {
+		code = sc.StatusCode()
+	}
+
+	mc := McontextFromContext(ctx)
+	if mc == nil || mc.Request == nil {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(code)
+		return json.NewEncoder(w).Encode(response)
+	}
+	if mc.NegotiateFormat(responseOffers...) == "" {
+		return ErrNotAcceptable
+	}
+	mc.writermem.reset(w)
+	mc.Negotiate(code, Negotiate{Offered: responseOffers, Data: response})
+	return nil
+}
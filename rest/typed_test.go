@@ -0,0 +1,134 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/libra9z/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type updateUser struct {
+	ID      int64  `uri:"id" binding:"required"`
+	Notify  bool   `form:"notify"`
+	Tenant  string `header:"X-Tenant" binding:"required"`
+	Name    string `json:"name" xml:"name" binding:"required"`
+	Comment string `json:"comment" xml:"comment"`
+}
+
+type userView struct {
+	ID     int64  `json:"id" xml:"id"`
+	Name   string `json:"name" xml:"name"`
+	Tenant string `json:"tenant" xml:"tenant"`
+	Notify bool   `json:"notify" xml:"notify"`
+}
+
+type created struct {
+	userView
+}
+
+func (created) StatusCode() int { return http.StatusCreated }
+
+// typedRouter routes PUT /users/:id to ep, as a grace.RouteGroup would.
+func typedRouter(ep func(context.Context, interface{}) (interface{}, error)) *httprouter.Router {
+	router := httprouter.New()
+	api := &RestApi{}
+	api.SetRouter(router)
+	router.Handler(http.MethodPut, "/users/:id", NewEngine(ep, api.DecodeRequest, EncodeNegotiatedResponse, ServerErrorEncoder(api.ErrorEncoder)))
+	return router
+}
+
+func putUser(router http.Handler, body, accept string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPut, "/users/42?notify=true", strings.NewReader(body))
+	r.Header.Set("Content-Type", MIMEJSON)
+	r.Header.Set("X-Tenant", "acme")
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestHandleBindsRequest(t *testing.T) {
+	router := typedRouter(Handle(func(ctx context.Context, req *updateUser) (*userView, error) {
+		assert.NotNil(t, McontextFromContext(ctx))
+		return &userView{ID: req.ID, Name: req.Name, Tenant: req.Tenant, Notify: req.Notify}, nil
+	}))
+
+	w := putUser(router, `{"name":"ann"}`, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"id":42,"name":"ann","tenant":"acme","notify":true}`, w.Body.String())
+
+	w = putUser(router, `{"name":"ann"}`, "application/xml")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), MIMEXML)
+	assert.Contains(t, w.Body.String(), "<name>ann</name>")
+
+	w = putUser(router, `{"name":"ann"}`, "text/csv")
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+}
+
+func TestHandleBindErrors(t *testing.T) {
+	called := false
+	router := typedRouter(Handle(func(ctx context.Context, req *updateUser) (*userView, error) {
+		called = true
+		return nil, nil
+	}))
+
+	var p struct {
+		Status  int    `json:"status"`
+		Code    string `json:"code"`
+		Details []struct {
+			Field string `json:"field"`
+		} `json:"details"`
+	}
+
+	w := putUser(router, `{"comment":"no name"}`, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, "validation_error", p.Code)
+	require.Len(t, p.Details, 1)
+	assert.Equal(t, "updateUser.Name", p.Details[0].Field)
+
+	w = putUser(router, `{"name":`, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, "bind_error", p.Code)
+	assert.False(t, called)
+}
+
+func TestHandleResponses(t *testing.T) {
+	router := typedRouter(Handle(func(ctx context.Context, req *updateUser) (*created, error) {
+		if req.Name == "none" {
+			return nil, nil
+		}
+		return &created{userView{ID: req.ID, Name: req.Name}}, nil
+	}))
+
+	assert.Equal(t, http.StatusCreated, putUser(router, `{"name":"ann"}`, "").Code)
+	w := putUser(router, `{"name":"none"}`, "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestShouldBindRequestWithoutBody(t *testing.T) {
+	type query struct {
+		Page int    `form:"page" binding:"required"`
+		Sort string `form:"sort"`
+	}
+	mc := decodeBind(t, httptest.NewRequest(http.MethodGet, "/users/ann?page=2", nil))
+
+	var q query
+	require.NoError(t, mc.ShouldBindRequest(&q))
+	assert.Equal(t, query{Page: 2}, q)
+
+	mc = decodeBind(t, httptest.NewRequest(http.MethodGet, "/users/ann", nil))
+	var missing query
+	assert.Error(t, mc.ShouldBindRequest(&missing), "page is required")
+}
@@ -110,6 +110,17 @@ func NewClientPool(size int, sdtype, sdaddr, basepath, serviceName string, failM
 	case "etcd3":
 		ss := strings.Split(sdaddr, _const.ADDR_SPLIT_STRING)
 		cs, err = etcd.NewEtcdV3Discovery(basepath, serviceName, ss, true, nil)
+	case sd.SD_TYPE_FILE, sd.SD_TYPE_STATIC:
+		var r sd.Resolver
+		r, err = sd.NewResolver(sd.WithSdType(sdtype), sd.WithSdAddress(sdaddr), sd.WithParams(params))
+		if err == nil {
+			var d *resolverDiscovery
+			if d, err = newResolverDiscovery(r, serviceName, true); err != nil {
+				r.Close()
+			} else {
+				cs = d
+			}
+		}
 	}
 	if err != nil {
 		fmt.Errorf("cannot discovery service: %v", err)
@@ -148,7 +159,9 @@ func ClientFinalizer(f ...ClientFinalizerFunc) ClientOption {
 }
 
 // Endpoint returns a usable endpoint that will invoke the RPCx specified by the
-// client.
+// client. The metadata set by the before functions is sent with the call; if
+// the client has a tracer, the call is recorded in a client span, propagated
+// in the metadata.
 func (c Client) Endpoint() endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		ctx, cancel := context.WithCancel(ctx)
@@ -166,11 +179,18 @@ func (c Client) Endpoint() endpoint.Endpoint {
 		for _, f := range c.before {
 			ctx = f(ctx, &md)
 		}
+		md["method"] = c.method
+
+		if c.tracer != nil {
+			var finish func(error)
+			ctx, finish = c.tracer.StartRPCClientSpan(ctx, c.serviceName, c.service, md)
+			defer func() { finish(err) }()
+		}
 
 		req := request.(*RpcRequest)
 		rpcxReply := reflect.New(c.rpcxReply).Interface()
 
-		ctx = context.WithValue(ctx, share.ReqMetaDataKey, map[string]string{"method": c.method})
+		ctx = context.WithValue(ctx, share.ReqMetaDataKey, md)
 		ctx = context.WithValue(ctx, share.ResMetaDataKey, make(map[string]string))
 
 		if err = c.client.Call(ctx, c.service, req, rpcxReply); err != nil {
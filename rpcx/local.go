@@ -0,0 +1,151 @@
+package rpcx
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/libra9z/mskit/v4/sd"
+	"github.com/smallnest/rpcx/client"
+	"github.com/smallnest/rpcx/server"
+)
+
+// metaNetwork is the key of the network of the instances registered by
+// LocalRegisterPlugin in their Meta.
+const metaNetwork = "network"
+
+// resolverDiscovery is the client.ServiceDiscovery of the instances of a
+// service found by a sd.Resolver.
+type resolverDiscovery struct {
+	*client.MultipleServersDiscovery
+	resolver sd.Resolver
+	owned    bool // the resolver is closed with the discovery
+	cancel   context.CancelFunc
+}
+
+var _ client.ServiceDiscovery = (*resolverDiscovery)(nil)
+
+// NewResolverDiscovery returns the discovery of the rpcx servers of service
+// found by r, e.g. for the file and static registries. The servers are
+// watched until the discovery is closed.
+func NewResolverDiscovery(r sd.Resolver, service string) (client.ServiceDiscovery, error) {
+	return newResolverDiscovery(r, service, false)
+}
+
+// newResolverDiscovery is NewResolverDiscovery closing r with the discovery
+// if owned is set, e.g. for a resolver built for the discovery only.
+func newResolverDiscovery(r sd.Resolver, service string, owned bool) (*resolverDiscovery, error) {
+	instances, err := r.Resolve(context.Background(), service)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := r.Watch(ctx, service)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	msd, _ := client.NewMultipleServersDiscovery(kvPairs(instances))
+	go func() {
+		for instances := range w {
+			msd.Update(kvPairs(instances))
+		}
+	}()
+	return &resolverDiscovery{MultipleServersDiscovery: msd, resolver: r, owned: owned, cancel: cancel}, nil
+}
+
+// Clone returns the discovery of the servers of servicePath. It shares the
+// resolver of d, which it does not close.
+func (d *resolverDiscovery) Clone(servicePath string) (client.ServiceDiscovery, error) {
+	return NewResolverDiscovery(d.resolver, servicePath)
+}
+
+// Close stops watching the servers, and closes the resolver if it belongs
+// to the discovery.
+func (d *resolverDiscovery) Close() {
+	d.cancel()
+	if d.owned {
+		d.resolver.Close()
+	}
+}
+
+// kvPairs returns the servers of instances, their network@address keys
+// with their metadata.
+func kvPairs(instances []sd.Instance) []*client.KVPair {
+	pairs := make([]*client.KVPair, 0, len(instances))
+	for _, i := range instances {
+		network := i.Meta[metaNetwork]
+		if network == "" {
+			network = "tcp"
+		}
+		meta := url.Values{}
+		for k, v := range i.Meta {
+			if k != metaNetwork {
+				meta.Set(k, v)
+			}
+		}
+		if i.Weight > 0 && meta.Get("weight") == "" {
+			meta.Set("weight", strconv.FormatFloat(i.Weight, 'f', -1, 64))
+		}
+		pairs = append(pairs, &client.KVPair{Key: network + "@" + i.Address, Value: meta.Encode()})
+	}
+	return pairs
+}
+
+// LocalRegisterPlugin registers the services of a rpcx server in a
+// sd.InstanceRegistry, the file or static registry.
+type LocalRegisterPlugin struct {
+	Registry sd.InstanceRegistry
+	// Network and ServiceAddress are the network and the address of the
+	// server.
+	Network        string
+	ServiceAddress string
+
+	mu       sync.Mutex
+	services map[string]string // the IDs of the instances of the services
+}
+
+var _ server.RegisterPlugin = (*LocalRegisterPlugin)(nil)
+
+// Register registers the instance of the server of the service name, with
+// metadata, a query string.
+func (p *LocalRegisterPlugin) Register(name string, rcvr interface{}, metadata string) error {
+	values, err := url.ParseQuery(metadata)
+	if err != nil {
+		return err
+	}
+	instance := sd.Instance{
+		ID:      name + "@" + p.Network + "@" + p.ServiceAddress,
+		Address: p.ServiceAddress,
+		Meta:    map[string]string{metaNetwork: p.Network},
+	}
+	for k := range values {
+		instance.Meta[k] = values.Get(k)
+	}
+	if w, err := strconv.ParseFloat(values.Get("weight"), 64); err == nil {
+		instance.Weight = w
+	}
+	if err := p.Registry.RegisterInstance(name, instance); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.services == nil {
+		p.services = make(map[string]string)
+	}
+	p.services[name] = instance.ID
+	return nil
+}
+
+// Unregister removes the instance of the server of the service name.
+func (p *LocalRegisterPlugin) Unregister(name string) error {
+	p.mu.Lock()
+	id, ok := p.services[name]
+	delete(p.services, name)
+	p.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return p.Registry.DeregisterInstance(name, id)
+}
@@ -0,0 +1,41 @@
+package rpcx
+
+import (
+	"testing"
+
+	"github.com/libra9z/mskit/v4/sd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type closingResolver struct {
+	sd.Resolver
+	closed int
+}
+
+func (r *closingResolver) Close() error {
+	r.closed++
+	return nil
+}
+
+func TestResolverDiscoveryClose(t *testing.T) {
+	r := &closingResolver{Resolver: sd.NewStaticResolver(map[string][]sd.Instance{
+		"Users": {{ID: "a", Address: "127.0.0.1:8972"}},
+	})}
+
+	d, err := newResolverDiscovery(r, "Users", true)
+	require.NoError(t, err)
+	assert.Len(t, d.GetServices(), 1)
+
+	clone, err := d.Clone("Users")
+	require.NoError(t, err)
+	clone.Close()
+	assert.Equal(t, 0, r.closed, "a clone shares the resolver")
+	d.Close()
+	assert.Equal(t, 1, r.closed)
+
+	shared, err := NewResolverDiscovery(r, "Users")
+	require.NoError(t, err)
+	shared.Close()
+	assert.Equal(t, 1, r.closed, "the resolver of the caller is left open")
+}
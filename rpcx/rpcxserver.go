@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"os"
 	"strings"
 	"time"
 
+	"github.com/libra9z/mskit/v4/grace"
 	"github.com/libra9z/mskit/v4/log"
 	"github.com/libra9z/mskit/v4/sd"
 	"github.com/libra9z/mskit/v4/trace"
@@ -15,11 +18,9 @@ import (
 	consul "github.com/rpcxio/rpcx-consul/serverplugin"
 	etcd "github.com/rpcxio/rpcx-etcd/serverplugin"
 	nacos "github.com/rpcxio/rpcx-nacos/serverplugin"
-	"github.com/rpcxio/rpcx-plugins/server/otel"
 	redis "github.com/rpcxio/rpcx-redis/serverplugin"
 	zookeeper "github.com/rpcxio/rpcx-zookeeper/serverplugin"
 	"github.com/smallnest/rpcx/server"
-	otrace "go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -41,6 +42,9 @@ type RpcServer struct {
 	GroupName    string
 	BasePath     string
 	DockerEnable bool
+	// SocketMode is the mode of the socket file of a unix Network, see
+	// grace.ListenUnix.
+	SocketMode os.FileMode
 
 	Methods map[string]Method
 
@@ -167,16 +171,32 @@ func (s *RpcServer) Serve() error {
 
 	addr := ""
 	ss := strings.Split(s.ServiceAddr, ":")
-	if s.DockerEnable {
+	if s.DockerEnable && len(ss) > 1 {
 		addr = ":" + ss[1]
 	} else {
 		addr = s.ServiceAddr
 	}
 	str := fmt.Sprintf("[%s] rpcx server running on: %s", s.BasePath, addr)
 	s.logger.Info("%s", str)
-	err := s.Server.Serve(s.Network, addr)
+	var err error
+	switch s.Network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		// take over the listener of the parent process on a restart, or
+		// the one passed by systemd socket activation
+		var ln net.Listener
+		if s.Network == "unix" {
+			ln, err = grace.ListenUnix(addr, s.SocketMode)
+		} else {
+			ln, err = grace.Listen(s.Network, addr)
+		}
+		if err == nil {
+			err = s.Server.ServeListener(s.Network, ln)
+		}
+	default:
+		err = s.Server.Serve(s.Network, addr)
+	}
 
-	if err != nil {
+	if err != nil && !errors.Is(err, server.ErrServerClosed) {
 		str = fmt.Sprintf("[%s] cannot run rpcx server: %v", s.BasePath, err)
 		s.logger.Error("%s", str)
 		return err
@@ -184,6 +204,14 @@ func (s *RpcServer) Serve() error {
 	return nil
 }
 
+// AttachTo ties the server to the lifecycle of app: when app shuts down the
+// server deregisters from service discovery and drains its calls, before
+// app drains its HTTP requests.
+func (s *RpcServer) AttachTo(app *grace.MicroService, options ...grace.HookOption) {
+	options = append([]grace.HookOption{grace.WithHookName("rpcx " + s.BasePath)}, options...)
+	app.OnShutdown(s.Server.Shutdown, options...)
+}
+
 func (s *RpcServer) RegisterMethod(methodName string, m Method) {
 
 	if methodName == "" {
@@ -259,7 +287,7 @@ func (jr *JSONRpc) Services(ctx context.Context, req *RpcRequest, ret *RpcRespon
 				function = RpcGetMethodByName(method)
 			}
 			if function != nil {
-				result, err = function(ctx, tracer, req.Appid, req.SiteId, req.Token, vs["params"])
+				result, err = function(TraceContext(ctx), tracer, req.Appid, req.SiteId, req.Token, vs["params"])
 			} else {
 				log.Mslog.Error("error=没有找对对应的方法。")
 			}
@@ -373,6 +401,17 @@ func NewRpcxServer(options ...RpcxServerOptions) *RpcServer {
 			s.logger.Error("error=%v", err)
 		}
 		s.Server.Plugins.Add(p)
+	case sd.SD_TYPE_FILE, sd.SD_TYPE_STATIC:
+		registry, err := sd.NewLocalRegistry(s.SdType, s.SdAddress)
+		if err != nil {
+			s.logger.Error("error=%v", err)
+			break
+		}
+		s.Server.Plugins.Add(&LocalRegisterPlugin{
+			Registry:       registry,
+			Network:        s.Network,
+			ServiceAddress: s.ServiceAddr,
+		})
 	case "etcd3":
 		p := &etcd.EtcdV3RegisterPlugin{
 			ServiceAddress: s.Network + "@" + s.ServiceAddr,
@@ -386,12 +425,7 @@ func NewRpcxServer(options ...RpcxServerOptions) *RpcServer {
 	}
 
 	if s.tracer != nil {
-		//zkp := serverplugin.OpenTracingPlugin{}
-		tt, tracer := s.tracer.GetTracer()
-		if tt == trace.TRACER_TYPE_OPENTELEMETRY {
-			zkp := otel.NewOpenTelemetryPlugin(tracer.(otrace.Tracer), nil)
-			s.Server.Plugins.Add(zkp)
-		}
+		s.Server.Plugins.Add(&TracePlugin{Tracer: s.tracer})
 	}
 	return s
 }
@@ -415,6 +449,9 @@ func RpcxServiceAddressOption(svraddr string) RpcxServerOptions {
 func RpcxNetworkOption(network string) RpcxServerOptions {
 	return func(c *RpcServer) { c.Network = network }
 }
+func RpcxSocketModeOption(mode os.FileMode) RpcxServerOptions {
+	return func(c *RpcServer) { c.SocketMode = mode }
+}
 func RpcxTracerOption(tracer trace.Tracer) RpcxServerOptions {
 	return func(c *RpcServer) { c.tracer = tracer }
 }
@@ -0,0 +1,73 @@
+package rpcx
+
+import (
+	"context"
+	"errors"
+
+	"github.com/libra9z/mskit/v4/trace"
+	"github.com/smallnest/rpcx/protocol"
+	"github.com/smallnest/rpcx/server"
+	"github.com/smallnest/rpcx/share"
+)
+
+// traceContextKey is the key of the traced context of a call in the
+// share.Context of its request, see TraceContext.
+type traceContextKey struct{}
+
+// traceFinishKey is the key of the function ending the server span of a
+// call in the share.Context of its request.
+type traceFinishKey struct{}
+
+// TracePlugin records a server span for every call received by a rpcx
+// server, a child of the span of the client extracted from the request
+// metadata. The services find the context of the span with TraceContext.
+type TracePlugin struct {
+	Tracer trace.Tracer
+}
+
+var (
+	_ server.PreHandleRequestPlugin  = (*TracePlugin)(nil)
+	_ server.PostWriteResponsePlugin = (*TracePlugin)(nil)
+)
+
+// PreHandleRequest starts the span of the call of r.
+func (p *TracePlugin) PreHandleRequest(ctx context.Context, r *protocol.Message) error {
+	sctx, ok := ctx.(*share.Context)
+	if !ok {
+		return nil
+	}
+	md := r.Metadata
+	if md == nil {
+		md = map[string]string{}
+	}
+	tctx, finish := p.Tracer.StartRPCServerSpan(ctx, r.ServicePath, r.ServiceMethod, md)
+	sctx.SetValue(traceContextKey{}, tctx)
+	sctx.SetValue(traceFinishKey{}, finish)
+	return nil
+}
+
+// PostWriteResponse ends the span of the call of req, with its error if
+// it failed.
+func (p *TracePlugin) PostWriteResponse(ctx context.Context, req *protocol.Message, res *protocol.Message, err error) error {
+	finish, ok := ctx.Value(traceFinishKey{}).(func(error))
+	if !ok {
+		return nil
+	}
+	if err == nil && res != nil && res.MessageStatusType() == protocol.Error {
+		err = errors.New(res.Metadata[protocol.ServiceError])
+	}
+	finish(err)
+	return nil
+}
+
+// TraceContext returns the context of the server span of the call of ctx,
+// the context passed to a service, recorded by TracePlugin; the spans
+// started from it and the calls made with it, e.g. by a rest.Client or
+// RpcxCall, continue the trace of the call. It returns ctx if the call is
+// not traced.
+func TraceContext(ctx context.Context) context.Context {
+	if tctx, ok := ctx.Value(traceContextKey{}).(context.Context); ok {
+		return tctx
+	}
+	return ctx
+}
@@ -5,16 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/hashicorp/consul/api"
-	"github.com/libra9z/log4go"
 	_const "github.com/libra9z/mskit/v4/const"
 	"github.com/libra9z/mskit/v4/grace"
 	mslog "github.com/libra9z/mskit/v4/log"
-	consulsd "github.com/libra9z/sd/consul"
 	"github.com/libra9z/utils"
 	"io/ioutil"
 	"net"
 	"os"
-	"os/signal"
 	"reflect"
 	"strconv"
 	"strings"
@@ -103,7 +100,7 @@ type consulRegister struct {
 	name     string
 	callback ServiceCallback
 	params   map[string]interface{}
-	reg      *consulsd.Registrar
+	reg      *consulRegistration
 	addr     string //listen on address and port
 }
 
@@ -143,7 +140,7 @@ func (c *consulRegister) Register(app *grace.MicroService, schema string, addres
 	c.servers = cs[0]
 	c.addr = address
 
-	var interval, timeout string
+	var interval, timeout, ttl string
 	if c.params != nil {
 		if c.params["interval"] != nil {
 			interval = utils.ConvertToString(c.params["interval"])
@@ -151,6 +148,9 @@ func (c *consulRegister) Register(app *grace.MicroService, schema string, addres
 		if c.params["timeout"] != nil {
 			timeout = utils.ConvertToString(c.params["timeout"])
 		}
+		if c.params["ttl"] != nil {
+			ttl = utils.ConvertToString(c.params["ttl"])
+		}
 	}
 
 	if interval == "" {
@@ -184,24 +184,33 @@ func (c *consulRegister) Register(app *grace.MicroService, schema string, addres
 	}
 
 	serviceID := c.name + "-" + c.addr
+	checkURL := schema + "://" + c.addr + c.prefix + grace.HealthPath
+	if app != nil {
+		checkURL = app.HealthURL(schema, c.addr)
+	}
+	check := &api.AgentServiceCheck{
+		CheckID:  "check-" + serviceID,
+		HTTP:     checkURL,
+		Interval: interval,
+		Timeout:  timeout,
+	}
+	if ttl != "" {
+		// the service reports its health itself
+		check = &api.AgentServiceCheck{CheckID: "check-" + serviceID, TTL: ttl}
+	}
 	service := &api.AgentServiceRegistration{
 		ID:      serviceID,
 		Name:    c.name,
 		Port:    port,
 		Address: host,
 		Tags:    tags,
-		Check: &api.AgentServiceCheck{
-			CheckID:  "check-" + serviceID,
-			HTTP:     schema + "://" + c.addr + c.prefix + "/health",
-			Interval: interval,
-			Timeout:  timeout,
-		},
+		Check:   check,
 	}
 
-	client := getConsulClient(c.servers, schema)
-
-	c.reg = consulsd.NewRegistrar(client, service, log4go.NewDefaultLogger(log4go.FINEST))
-	c.reg.Register()
+	c.reg = registerConsul(app, newConsulClient(c.servers, schema), service)
+	if app != nil {
+		app.AddDeregisterer(c, grace.WithHookName("consul "+serviceID))
+	}
 }
 
 func (c *consulRegister) RegisterFromMemory(app *grace.MicroService, schema string, reader *bytes.Buffer, exparams map[string]interface{}, callbacks ...ServiceCallback) {
@@ -269,9 +278,7 @@ func (c *consulRegister) RegisterFromMemory(app *grace.MicroService, schema stri
 				go registerService(app, schema, c.servers, c.token, v, callbacks[i], cps)
 			}
 
-			quit := make(chan os.Signal, 1)
-			signal.Notify(quit, os.Interrupt, os.Kill)
-			<-quit
+			waitStopped(app)
 
 			//select {}
 		case reflect.Map:
@@ -323,9 +330,7 @@ func (c *consulRegister) RegisterFromMemory(app *grace.MicroService, schema stri
 				go registerService(app, schema, c.servers, c.token, v, callbacks[i], cps)
 			}
 
-			quit := make(chan os.Signal, 1)
-			signal.Notify(quit, os.Interrupt, os.Kill)
-			<-quit
+			waitStopped(app)
 
 			//select {}
 		case reflect.Map:
@@ -379,27 +384,22 @@ func (c *consulRegister) RegisterFile(app *grace.MicroService, schema, fname str
 
 }
 
-func getConsulClient(addr, schema string) consulsd.Client {
-	var client consulsd.Client
-	{
-		consulConfig := api.DefaultConfig()
-		if addr != "" {
-			consulConfig.Address = addr
-		}
-		if schema != "" {
-			consulConfig.Scheme = schema
-		} else {
-			consulConfig.Scheme = "http"
-		}
-		consulClient, err := api.NewClient(consulConfig)
-		if err != nil {
-			mslog.Mslog.Critical(err)
-			os.Exit(1)
-		}
-		client = consulsd.NewClient(consulClient)
+func newConsulClient(addr, schema string) *api.Client {
+	consulConfig := api.DefaultConfig()
+	if addr != "" {
+		consulConfig.Address = addr
 	}
-
-	return client
+	if schema != "" {
+		consulConfig.Scheme = schema
+	} else {
+		consulConfig.Scheme = "http"
+	}
+	consulClient, err := api.NewClient(consulConfig)
+	if err != nil {
+		mslog.Mslog.Critical(err)
+		os.Exit(1)
+	}
+	return consulClient
 }
 
 func readFile(path string) []byte {
@@ -482,88 +482,24 @@ func registerService(app *grace.MicroService, schema, consul, token string, para
 	if params["checks"] != nil {
 		vp := params["checks"].([]interface{})
 		for _, v := range vp {
-			p := v.(map[string]interface{})
-			var c api.AgentServiceCheck
-			if p["http"] != nil {
-				c.HTTP = utils.ConvertToString(p["http"])
-			}
-			if p["interval"] != nil {
-				c.Interval = utils.ConvertToString(p["interval"])
-			}
-			if p["timeout"] != nil {
-				c.Timeout = utils.ConvertToString(p["timeout"])
-			}
-			if p["name"] != nil {
-				c.Name = utils.ConvertToString(p["name"])
-			}
-			if p["id"] != nil {
-				c.CheckID = utils.ConvertToString(p["id"])
-			}
-			if p["tcp"] != nil {
-				c.TCP = utils.ConvertToString(p["tcp"])
-			}
-			if p["shell"] != nil {
-				c.Shell = utils.ConvertToString(p["shell"])
-			}
-			if p["ttl"] != nil {
-				c.TTL = utils.ConvertToString(p["ttl"])
-			}
-			if p["method"] != nil {
-				c.Method = utils.ConvertToString(p["method"])
-			}
-			if p["status"] != nil {
-				c.Status = utils.ConvertToString(p["status"])
-			}
-
-			if p["args"] != nil {
-				vs := p["args"].([]interface{})
-				for _, s := range vs {
-					c.Args = append(c.Args, utils.ConvertToString(s))
-				}
-			}
-			if p["notes"] != nil {
-				c.Notes = utils.ConvertToString(p["notes"])
-			}
-			if p["grpc"] != nil {
-				c.GRPC = utils.ConvertToString(p["grpc"])
-			}
-
-			if p["docker_container_id"] != nil {
-				c.DockerContainerID = utils.ConvertToString(p["docker_container_id"])
-			}
-
-			if p["tls_skip_verify"] != nil {
-				c.TLSSkipVerify = p["tls_skip_verify"].(bool)
-			}
-			if p["grpc_use_tls"] != nil {
-				c.GRPCUseTLS = p["grpc_use_tls"].(bool)
-			}
-
-			if p["header"] != nil {
-				vs := p["header"].(map[string]interface{})
-				var h map[string][]string
-				h = make(map[string][]string)
-
-				for k, v := range vs {
-					var ss []string
-					s1 := v.([]interface{})
-					for _, s := range s1 {
-						ss = append(ss, utils.ConvertToString(s))
-					}
-					h[k] = ss
-				}
-
-				c.Header = h
-			}
-
-			checks = append(checks, &c)
+			checks = append(checks, consulCheck(v.(map[string]interface{})))
 		}
 	}
 
-	if checks == nil {
+	if checks == nil && params["ttl"] != nil {
+		// the service reports its health itself, e.g. behind NAT or in docker
+		check = &api.AgentServiceCheck{
+			CheckID: "check-" + serviceID,
+			TTL:     utils.ConvertToString(params["ttl"]),
+		}
+	} else if checks == nil {
+		checkURL := schema + "://" + addr + prefix + grace.HealthPath
+		if app != nil {
+			checkURL = app.HealthURL(schema, addr)
+		}
 		check = &api.AgentServiceCheck{
 			CheckID:  "check-" + serviceID,
-			HTTP:     schema + "://" + addr + prefix + "/health",
+			HTTP:     checkURL,
 			Interval: "30s",
 			Timeout:  "3s",
 		}
@@ -621,20 +557,12 @@ func registerService(app *grace.MicroService, schema, consul, token string, para
 	if caddr != "" {
 		consul = caddr
 	}
-	c := getConsulClient(consul, schema)
-
-	reg := consulsd.NewRegistrar(c, service, log4go.NewDefaultLogger(log4go.FINEST))
-
-	reg.Register()
+	reg := registerConsul(app, newConsulClient(consul, schema), service)
 
 	mslog.Mslog.Info("%s", fmt.Sprintf("Registered service %q in consul with tags: %q", name, strings.Join(tags, ",")))
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, os.Kill)
-	<-quit
-
-	reg.Deregister()
-
-	mslog.Mslog.Info("Deregistered service %q in consul", name)
-
+	deregisterOnStop(app, grace.DeregisterFunc(func() {
+		reg.Deregister()
+		mslog.Mslog.Info("Deregistered service %q in consul", name)
+	}), "consul "+serviceID)
 }
@@ -0,0 +1,108 @@
+package sd
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	_const "github.com/libra9z/mskit/v4/const"
+	consulsd "github.com/libra9z/sd/consul"
+	"github.com/libra9z/utils"
+)
+
+type consulResolver struct {
+	*cache
+	client consulsd.Client
+	tag    string
+	wait   time.Duration
+}
+
+// NewConsulResolver returns a resolver of the services registered with the
+// consul agent at address, the first of a list, with their passing
+// instances. The instances are watched with blocking queries. params may
+// set:
+//
+//	tag:  only resolve the instances with the tag
+//	wait: the longest a blocking query waits for a change, e.g. "5m"
+func NewConsulResolver(address, token string, params map[string]interface{}) (Resolver, error) {
+	config := api.DefaultConfig()
+	if cs := strings.Split(address, _const.ADDR_SPLIT_STRING); cs[0] != "" {
+		config.Address = cs[0]
+	}
+	config.Token = token
+	client, err := api.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	r := newConsulResolver(consulsd.NewClient(client))
+	if params != nil && params["tag"] != nil {
+		r.tag = utils.ConvertToString(params["tag"])
+	}
+	if params != nil && params["wait"] != nil {
+		if r.wait, err = time.ParseDuration(utils.ConvertToString(params["wait"])); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func newConsulResolver(client consulsd.Client) *consulResolver {
+	r := &consulResolver{client: client}
+	r.cache = newCache(r.watch)
+	return r
+}
+
+func (r *consulResolver) watch(ctx context.Context, service string, update func([]Instance, error)) {
+	var index uint64
+	for ctx.Err() == nil {
+		opts := (&api.QueryOptions{WaitIndex: index, WaitTime: r.wait}).WithContext(ctx)
+		entries, meta, err := r.client.Service(service, r.tag, true, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			update(nil, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(resolverRetry):
+			}
+			continue
+		}
+		switch {
+		case meta.LastIndex < index:
+			// the index went backwards, e.g. the agent restarted
+			index = 0
+		case meta.LastIndex == 0:
+			// a query waiting on index 0 does not block
+			index = 1
+		default:
+			index = meta.LastIndex
+		}
+		update(consulInstances(entries), nil)
+	}
+}
+
+func consulInstances(entries []*api.ServiceEntry) []Instance {
+	instances := make([]Instance, 0, len(entries))
+	for _, e := range entries {
+		host := e.Service.Address
+		if host == "" && e.Node != nil {
+			host = e.Node.Address
+		}
+		weight := 1.0
+		if e.Service.Weights.Passing > 0 {
+			weight = float64(e.Service.Weights.Passing)
+		}
+		instances = append(instances, Instance{
+			ID:      e.Service.ID,
+			Address: net.JoinHostPort(host, strconv.Itoa(e.Service.Port)),
+			Tags:    e.Service.Tags,
+			Meta:    e.Service.Meta,
+			Weight:  weight,
+		})
+	}
+	return instances
+}
@@ -0,0 +1,88 @@
+package sd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/libra9z/mskit/v4/grace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func skipWithoutSIGINT(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no SIGINT on windows")
+	}
+}
+
+// interruptUntil sends SIGINT to the test process until done is closed, e.g.
+// by a registration waiting for it without a MicroService.
+func interruptUntil(t *testing.T, done <-chan struct{}) {
+	// catch the SIGINT in the test process too
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt)
+	defer signal.Stop(quit)
+
+	self, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		self.Signal(os.Interrupt)
+		select {
+		case <-done:
+			return true
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, time.Millisecond, "registration waits for SIGINT")
+}
+
+func TestConsulRegisterServiceWithoutApp(t *testing.T) {
+	skipWithoutSIGINT(t)
+
+	var mu sync.Mutex
+	var registered *api.AgentServiceRegistration
+	var deregistered string
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/v1/agent/service/register":
+			registered = &api.AgentServiceRegistration{}
+			json.NewDecoder(r.Body).Decode(registered)
+		case strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+			deregistered = strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/")
+		}
+	}))
+	defer agent.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		params := map[string]interface{}{"name": "orders", "address": "127.0.0.1", "port": 8082, "tags": []interface{}{"/orders"}}
+		registerService(nil, "http", strings.TrimPrefix(agent.URL, "http://"), "", params, func(app *grace.MicroService, params map[string]interface{}) error {
+			return nil
+		}, map[string]interface{}{})
+	}()
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return registered != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	interruptUntil(t, done)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "orders-127.0.0.1:8082", registered.ID)
+	assert.Equal(t, "http://127.0.0.1:8082/orders"+grace.HealthPath, registered.Check.HTTP)
+	assert.Equal(t, "orders-127.0.0.1:8082", deregistered)
+}
@@ -17,6 +17,13 @@ const (
 const(
 	SD_TYPE_CONSUL 	= "consul"
 	SD_TYPE_NACOS 	= "nacos"
+	// SD_TYPE_FILE is a registry in a local JSON or YAML file, the address
+	// of the registry, see NewFileRegistry.
+	SD_TYPE_FILE 	= "file"
+	// SD_TYPE_STATIC is the registry of the process, StaticRegistry.
+	SD_TYPE_STATIC 	= "static"
+	// SD_TYPE_ETCD is an etcd v3 cluster, see EtcdRegistry.
+	SD_TYPE_ETCD 	= "etcd3"
 )
 
 
@@ -51,86 +58,90 @@ func (so *ServiceOptions) GetConsulRegistration() *api.AgentServiceRegistration
 	}
 
 	var checks []*api.AgentServiceCheck
-	if len(so.Checks) > 0 {
-		for _, p := range so.Checks {
-			var c api.AgentServiceCheck
-			if p["http"] != nil {
-				c.HTTP = utils.ConvertToString(p["http"])
-			}
-			if p["interval"] != nil {
-				c.Interval = utils.ConvertToString(p["interval"])
-			}
-			if p["timeout"] != nil {
-				c.Timeout = utils.ConvertToString(p["timeout"])
-			}
-			if p["name"] != nil {
-				c.Name = utils.ConvertToString(p["name"])
-			}
-			if p["id"] != nil {
-				c.CheckID = utils.ConvertToString(p["id"])
-			}
-			if p["tcp"] != nil {
-				c.TCP = utils.ConvertToString(p["tcp"])
-			}
-			if p["shell"] != nil {
-				c.Shell = utils.ConvertToString(p["shell"])
-			}
-			if p["ttl"] != nil {
-				c.TTL = utils.ConvertToString(p["ttl"])
-			}
-			if p["method"] != nil {
-				c.Method = utils.ConvertToString(p["method"])
-			}
-			if p["status"] != nil {
-				c.Status = utils.ConvertToString(p["status"])
-			}
-
-			if p["args"] != nil {
-				vs := p["args"].([]interface{})
-				for _, s := range vs {
-					c.Args = append(c.Args, utils.ConvertToString(s))
-				}
-			}
-			if p["notes"] != nil {
-				c.Notes = utils.ConvertToString(p["notes"])
-			}
-			if p["grpc"] != nil {
-				c.GRPC = utils.ConvertToString(p["grpc"])
-			}
+	for _, p := range so.Checks {
+		checks = append(checks, consulCheck(p))
+	}
 
-			if p["docker_container_id"] != nil {
-				c.DockerContainerID = utils.ConvertToString(p["docker_container_id"])
-			}
+	service.Checks = checks
 
-			if p["tls_skip_verify"] != nil {
-				c.TLSSkipVerify = p["tls_skip_verify"].(bool)
-			}
-			if p["grpc_use_tls"] != nil {
-				c.GRPCUseTLS = p["grpc_use_tls"].(bool)
-			}
+	return service
+}
 
-			if p["header"] != nil {
-				vs := p["header"].(map[string]interface{})
-				var h map[string][]string
-				h = make(map[string][]string)
-
-				for k, v := range vs {
-					var ss []string
-					s1 := v.([]interface{})
-					for _, s := range s1 {
-						ss = append(ss, utils.ConvertToString(s))
-					}
-					h[k] = ss
-				}
-
-				c.Header = h
-			}
+// consulCheck returns the check described by the keys of p, named after the
+// fields of the checks of consul service definitions.
+func consulCheck(p map[string]interface{}) *api.AgentServiceCheck {
+	var c api.AgentServiceCheck
+	if p["http"] != nil {
+		c.HTTP = utils.ConvertToString(p["http"])
+	}
+	if p["interval"] != nil {
+		c.Interval = utils.ConvertToString(p["interval"])
+	}
+	if p["timeout"] != nil {
+		c.Timeout = utils.ConvertToString(p["timeout"])
+	}
+	if p["name"] != nil {
+		c.Name = utils.ConvertToString(p["name"])
+	}
+	if p["id"] != nil {
+		c.CheckID = utils.ConvertToString(p["id"])
+	}
+	if p["tcp"] != nil {
+		c.TCP = utils.ConvertToString(p["tcp"])
+	}
+	if p["shell"] != nil {
+		c.Shell = utils.ConvertToString(p["shell"])
+	}
+	if p["ttl"] != nil {
+		c.TTL = utils.ConvertToString(p["ttl"])
+	}
+	if p["method"] != nil {
+		c.Method = utils.ConvertToString(p["method"])
+	}
+	if p["status"] != nil {
+		c.Status = utils.ConvertToString(p["status"])
+	}
 
-			checks = append(checks, &c)
+	if p["args"] != nil {
+		vs := p["args"].([]interface{})
+		for _, s := range vs {
+			c.Args = append(c.Args, utils.ConvertToString(s))
 		}
 	}
+	if p["notes"] != nil {
+		c.Notes = utils.ConvertToString(p["notes"])
+	}
+	if p["grpc"] != nil {
+		c.GRPC = utils.ConvertToString(p["grpc"])
+	}
 
-	service.Checks = checks
+	if p["docker_container_id"] != nil {
+		c.DockerContainerID = utils.ConvertToString(p["docker_container_id"])
+	}
 
-	return service
+	if p["tls_skip_verify"] != nil {
+		c.TLSSkipVerify = p["tls_skip_verify"].(bool)
+	}
+	if p["grpc_use_tls"] != nil {
+		c.GRPCUseTLS = p["grpc_use_tls"].(bool)
+	}
+
+	if p["header"] != nil {
+		vs := p["header"].(map[string]interface{})
+		var h map[string][]string
+		h = make(map[string][]string)
+
+		for k, v := range vs {
+			var ss []string
+			s1 := v.([]interface{})
+			for _, s := range s1 {
+				ss = append(ss, utils.ConvertToString(s))
+			}
+			h[k] = ss
+		}
+
+		c.Header = h
+	}
+
+	return &c
 }
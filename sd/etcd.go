@@ -0,0 +1,265 @@
+package sd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	_const "github.com/libra9z/mskit/v4/const"
+	"github.com/libra9z/utils"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Defaults of the etcd registry.
+const (
+	DefaultEtcdBasePath = "/mskit/services"
+	DefaultEtcdTTL      = 10 * time.Second
+)
+
+// etcdTimeout bounds the requests to etcd which are not watches.
+var etcdTimeout = 5 * time.Second
+
+// NewEtcdRegistar returns the Registar of the etcd v3 cluster at address, a
+// list of endpoints, see NewEtcdRegistry. params may set the params of
+// newEtcdClient, base_path and ttl, and the tags and meta of the instance
+// registered by Register.
+func NewEtcdRegistar(name string, prefix string, addr, etcd, token string, callback ServiceCallback, params map[string]interface{}) (Registar, error) {
+	client, err := newEtcdClient(etcd, params)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := newEtcdRegistry(client, params)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &registryRegister{
+		sdType:   SD_TYPE_ETCD,
+		registry: registry,
+		name:     name,
+		prefix:   prefix,
+		callback: callback,
+		params:   params,
+		addr:     addr,
+	}, nil
+}
+
+// newEtcdClient returns a client of the endpoints of address. params may
+// set:
+//
+//	username, password: the credentials of the client
+//	dial_timeout:       how long connecting may take, e.g. "5s"
+func newEtcdClient(address string, params map[string]interface{}) (*clientv3.Client, error) {
+	config := clientv3.Config{
+		Endpoints:   strings.Split(address, _const.ADDR_SPLIT_STRING),
+		DialTimeout: etcdTimeout,
+	}
+	if params != nil {
+		if params["username"] != nil {
+			config.Username = utils.ConvertToString(params["username"])
+		}
+		if params["password"] != nil {
+			config.Password = utils.ConvertToString(params["password"])
+		}
+	}
+	var err error
+	if config.DialTimeout, err = paramDuration(params, "dial_timeout", etcdTimeout); err != nil {
+		return nil, err
+	}
+	return clientv3.New(config)
+}
+
+// paramDuration returns the duration param key, e.g. "10s" or a number of
+// seconds, or def if it is not set.
+func paramDuration(params map[string]interface{}, key string, def time.Duration) (time.Duration, error) {
+	if params == nil || params[key] == nil {
+		return def, nil
+	}
+	s := utils.ConvertToString(params[key])
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return d, nil
+}
+
+// EtcdRegistry is a registry of the instances of services in etcd v3. An
+// instance is the JSON value of the key base path/service/ID, attached to
+// a lease kept alive while it is registered: the instances of a process
+// which did not shut down are removed once their TTL expires. A lease lost,
+// e.g. after etcd was unreachable for longer than the TTL, is replaced.
+type EtcdRegistry struct {
+	client   *clientv3.Client
+	basePath string
+	ttl      time.Duration
+
+	mu    sync.Mutex
+	lives map[string]*etcdLease // by key
+}
+
+var _ InstanceRegistry = (*EtcdRegistry)(nil)
+
+// NewEtcdRegistry returns the registry of client under basePath,
+// DefaultEtcdBasePath if empty, registering instances with leases of ttl,
+// DefaultEtcdTTL if 0.
+func NewEtcdRegistry(client *clientv3.Client, basePath string, ttl time.Duration) *EtcdRegistry {
+	if basePath == "" {
+		basePath = DefaultEtcdBasePath
+	}
+	if ttl <= 0 {
+		ttl = DefaultEtcdTTL
+	}
+	return &EtcdRegistry{
+		client:   client,
+		basePath: basePath,
+		ttl:      ttl,
+		lives:    make(map[string]*etcdLease),
+	}
+}
+
+func newEtcdRegistry(client *clientv3.Client, params map[string]interface{}) (*EtcdRegistry, error) {
+	ttl, err := paramDuration(params, "ttl", DefaultEtcdTTL)
+	if err != nil {
+		return nil, err
+	}
+	var basePath string
+	if params != nil && params["base_path"] != nil {
+		basePath = utils.ConvertToString(params["base_path"])
+	}
+	return NewEtcdRegistry(client, basePath, ttl), nil
+}
+
+// servicePrefix returns the prefix of the keys of the instances of service.
+func servicePrefix(basePath, service string) string {
+	return path.Join(basePath, service) + "/"
+}
+
+func (r *EtcdRegistry) RegisterInstance(service string, instance Instance) error {
+	value, err := json.Marshal(instance)
+	if err != nil {
+		return err
+	}
+	key := servicePrefix(r.basePath, service) + instance.ID
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if l := r.lives[key]; l != nil {
+		l.stop()
+		delete(r.lives, key)
+	}
+	l := &etcdLease{client: r.client, key: key, value: string(value), ttl: r.ttl}
+	if err := l.start(); err != nil {
+		return err
+	}
+	r.lives[key] = l
+	return nil
+}
+
+func (r *EtcdRegistry) DeregisterInstance(service, id string) error {
+	key := servicePrefix(r.basePath, service) + id
+	r.mu.Lock()
+	l := r.lives[key]
+	delete(r.lives, key)
+	r.mu.Unlock()
+	if l != nil {
+		return l.stop()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), etcdTimeout)
+	defer cancel()
+	_, err := r.client.Delete(ctx, key)
+	return err
+}
+
+// etcdLease keeps a key registered with a lease.
+type etcdLease struct {
+	client *clientv3.Client
+	key    string
+	value  string
+	ttl    time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	mu     sync.Mutex
+	id     clientv3.LeaseID
+}
+
+// start puts the key with a new lease and keeps it alive.
+func (l *etcdLease) start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	keepAlive, err := l.put(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	l.cancel, l.done = cancel, make(chan struct{})
+	go l.keep(ctx, keepAlive)
+	return nil
+}
+
+// put puts the key with a new lease, returning the channel of its
+// keep-alive responses.
+func (l *etcdLease) put(ctx context.Context) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	rctx, cancel := context.WithTimeout(ctx, etcdTimeout)
+	defer cancel()
+	lease, err := l.client.Grant(rctx, int64((l.ttl+time.Second-1)/time.Second))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := l.client.Put(rctx, l.key, l.value, clientv3.WithLease(lease.ID)); err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	l.id = lease.ID
+	l.mu.Unlock()
+	return l.client.KeepAlive(ctx, lease.ID)
+}
+
+// keep consumes the keep-alive responses and registers the key again when
+// the lease is lost, until ctx is done.
+func (l *etcdLease) keep(ctx context.Context, keepAlive <-chan *clientv3.LeaseKeepAliveResponse) {
+	defer close(l.done)
+	for {
+		for range keepAlive {
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Warn("key=%s,error=lease lost, registering again", l.key)
+		for {
+			var err error
+			if keepAlive, err = l.put(ctx); err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error("key=%s,error=%v", l.key, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(resolverRetry):
+			}
+		}
+	}
+}
+
+// stop stops keeping the key alive and revokes its lease, which deletes
+// the key.
+func (l *etcdLease) stop() error {
+	l.cancel()
+	<-l.done
+	l.mu.Lock()
+	id := l.id
+	l.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), etcdTimeout)
+	defer cancel()
+	_, err := l.client.Revoke(ctx, id)
+	return err
+}
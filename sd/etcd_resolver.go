@@ -0,0 +1,119 @@
+package sd
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/libra9z/utils"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+type etcdResolver struct {
+	*cache
+	client   *clientv3.Client
+	basePath string
+	owned    bool // the client is closed with the resolver
+}
+
+// NewEtcdResolver returns a resolver of the services registered in the
+// etcd v3 cluster at address, a list of endpoints, by an EtcdRegistry. The
+// instances are watched. params may set base_path, DefaultEtcdBasePath by
+// default, and the params of the client, see NewEtcdRegistar.
+func NewEtcdResolver(address string, params map[string]interface{}) (Resolver, error) {
+	client, err := newEtcdClient(address, params)
+	if err != nil {
+		return nil, err
+	}
+	var basePath string
+	if params != nil && params["base_path"] != nil {
+		basePath = utils.ConvertToString(params["base_path"])
+	}
+	r := newEtcdResolver(client, basePath)
+	r.owned = true
+	return r, nil
+}
+
+func newEtcdResolver(client *clientv3.Client, basePath string) *etcdResolver {
+	if basePath == "" {
+		basePath = DefaultEtcdBasePath
+	}
+	r := &etcdResolver{client: client, basePath: basePath}
+	r.cache = newCache(r.watch)
+	return r
+}
+
+func (r *etcdResolver) Close() error {
+	r.cache.Close()
+	if r.owned {
+		return r.client.Close()
+	}
+	return nil
+}
+
+// watch gets the instances of service and watches their changes from the
+// revision of the get; it gets them again when the watch fails, e.g. when
+// the revision was compacted.
+func (r *etcdResolver) watch(ctx context.Context, service string, update func([]Instance, error)) {
+	prefix := servicePrefix(r.basePath, service)
+	for ctx.Err() == nil {
+		resp, err := r.client.Get(ctx, prefix, clientv3.WithPrefix())
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			update(nil, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(resolverRetry):
+			}
+			continue
+		}
+		instances := make(map[string]Instance, len(resp.Kvs))
+		for _, kv := range resp.Kvs {
+			r.put(instances, kv.Key, kv.Value)
+		}
+		update(etcdInstances(instances), nil)
+
+		wctx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+		for wr := range r.client.Watch(wctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1)) {
+			if err := wr.Err(); err != nil {
+				logger.Error("service=%s,error=%v", service, err)
+				break
+			}
+			for _, ev := range wr.Events {
+				switch ev.Type {
+				case clientv3.EventTypePut:
+					r.put(instances, ev.Kv.Key, ev.Kv.Value)
+				case clientv3.EventTypeDelete:
+					delete(instances, string(ev.Kv.Key))
+				}
+			}
+			update(etcdInstances(instances), nil)
+		}
+		cancel()
+	}
+}
+
+// put adds the instance of the value of key to instances, unless it is
+// not one.
+func (r *etcdResolver) put(instances map[string]Instance, key, value []byte) {
+	var i Instance
+	if err := json.Unmarshal(value, &i); err != nil || i.Address == "" {
+		logger.Warn("key=%s,error=not an instance", key)
+		return
+	}
+	if i.ID == "" {
+		i.ID = strings.TrimPrefix(string(key)[strings.LastIndex(string(key), "/"):], "/")
+	}
+	instances[string(key)] = i
+}
+
+func etcdInstances(instances map[string]Instance) []Instance {
+	list := make([]Instance, 0, len(instances))
+	for _, i := range instances {
+		list = append(list, i)
+	}
+	return list
+}
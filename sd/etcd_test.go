@@ -0,0 +1,131 @@
+package sd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/libra9z/mskit/v4/grace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+func freeURL(t *testing.T) url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return url.URL{Scheme: "http", Host: l.Addr().String()}
+}
+
+// startEtcd starts an embedded etcd server, returning its client endpoint.
+func startEtcd(t *testing.T) string {
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	client, peer := freeURL(t), freeURL(t)
+	cfg.LCUrls, cfg.ACUrls = []url.URL{client}, []url.URL{client}
+	cfg.LPUrls, cfg.APUrls = []url.URL{peer}, []url.URL{peer}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	e, err := embed.StartEtcd(cfg)
+	require.NoError(t, err)
+	t.Cleanup(e.Close)
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("etcd not ready")
+	}
+	return client.Host
+}
+
+func TestEtcdRegistry(t *testing.T) {
+	defer func(retry time.Duration) { resolverRetry = retry }(resolverRetry)
+	resolverRetry = 10 * time.Millisecond
+
+	endpoint := startEtcd(t)
+	client, err := newEtcdClient(endpoint, nil)
+	require.NoError(t, err)
+	defer client.Close()
+
+	registry := NewEtcdRegistry(client, "", time.Second)
+	r := newEtcdResolver(client, "")
+	defer r.Close()
+	w, err := r.Watch(context.Background(), "users")
+	require.NoError(t, err)
+	assert.Empty(t, receive(t, w))
+
+	a := Instance{ID: "users-a", Address: "127.0.0.1:8081", Tags: []string{"v1"}, Meta: map[string]string{"zone": "a"}, Weight: 2}
+	require.NoError(t, registry.RegisterInstance("users", a))
+	assert.Equal(t, []Instance{a}, receive(t, w))
+
+	resp, err := client.Get(context.Background(), DefaultEtcdBasePath+"/users/users-a")
+	require.NoError(t, err)
+	require.Len(t, resp.Kvs, 1)
+	assert.NotZero(t, resp.Kvs[0].Lease, "registered with a lease")
+
+	// kept alive past its TTL
+	time.Sleep(2500 * time.Millisecond)
+	instances, err := r.Resolve(context.Background(), "users")
+	require.NoError(t, err)
+	assert.Equal(t, []Instance{a}, instances)
+
+	// registered again when the lease is lost
+	_, err = client.Revoke(context.Background(), clientv3.LeaseID(resp.Kvs[0].Lease))
+	require.NoError(t, err)
+	assert.Empty(t, receive(t, w))
+	assert.Equal(t, []Instance{a}, receive(t, w))
+
+	require.NoError(t, registry.DeregisterInstance("users", "users-a"))
+	assert.Empty(t, receive(t, w))
+	resp, err = client.Get(context.Background(), DefaultEtcdBasePath+"/", clientv3.WithPrefix())
+	require.NoError(t, err)
+	assert.Empty(t, resp.Kvs)
+}
+
+func TestEtcdRegistar(t *testing.T) {
+	endpoint := startEtcd(t)
+	params := map[string]interface{}{"base_path": "/test", "ttl": "5s"}
+	reg := NewRegistar(WithSdType(SD_TYPE_ETCD), WithSdAddress(endpoint), WithServiceName("orders"), WithPrefix("/orders"), WithParams(params))
+	require.NotNil(t, reg)
+
+	served := make(chan struct{})
+	app := &grace.MicroService{}
+	reg.Register(app, "http", "127.0.0.1:8082", map[string]interface{}{
+		"tags": []interface{}{"v2"},
+		"meta": map[string]interface{}{"version": 2},
+	}, func(app *grace.MicroService, params map[string]interface{}) error {
+		close(served)
+		return nil
+	})
+	<-served
+
+	r, err := NewResolver(WithSdType(SD_TYPE_ETCD), WithSdAddress(endpoint), WithParams(params))
+	require.NoError(t, err)
+	defer r.Close()
+	instances, err := r.Resolve(context.Background(), "orders")
+	require.NoError(t, err)
+	assert.Equal(t, []Instance{{
+		ID:      "orders-127.0.0.1:8082",
+		Address: "127.0.0.1:8082",
+		Tags:    []string{"urlprefix-/orders", "v2"},
+		Meta:    map[string]string{"version": "2"},
+		Weight:  1,
+	}}, instances)
+
+	reg.Deregister()
+	w, err := r.Watch(context.Background(), "orders")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		select {
+		case instances := <-w:
+			return len(instances) == 0
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond, fmt.Sprint("deregistered"))
+}
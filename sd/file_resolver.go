@@ -0,0 +1,76 @@
+package sd
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/libra9z/utils"
+)
+
+// DefaultFileInterval is how often a file resolver checks its file for
+// changes.
+const DefaultFileInterval = time.Second
+
+type fileResolver struct {
+	*cache
+	registry *FileRegistry
+	interval time.Duration
+}
+
+// NewFileResolver returns a resolver of the services of the FileRegistry at
+// path. The file is checked for changes every DefaultFileInterval, or the
+// interval param, e.g. "500ms"; a missing file has no services.
+func NewFileResolver(path string, params map[string]interface{}) (Resolver, error) {
+	registry, err := NewLocalRegistry(SD_TYPE_FILE, path)
+	if err != nil {
+		return nil, err
+	}
+	r := &fileResolver{registry: registry.(*FileRegistry), interval: DefaultFileInterval}
+	if params != nil && params["interval"] != nil {
+		if r.interval, err = time.ParseDuration(utils.ConvertToString(params["interval"])); err != nil {
+			return nil, err
+		}
+	}
+	r.cache = newCache(r.watch)
+	return r, nil
+}
+
+// watch reads the file every time its size or modification time changes.
+// The file is replaced when registrations change it, so it is checked by
+// name rather than through an open descriptor.
+func (r *fileResolver) watch(ctx context.Context, service string, update func([]Instance, error)) {
+	var last os.FileInfo
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for first := true; ; first = false {
+		fi, err := os.Stat(r.registry.path)
+		if err != nil && !os.IsNotExist(err) {
+			update(nil, err)
+		} else if first || changed(last, fi) {
+			last = fi
+			services, err := r.registry.Services()
+			if err != nil {
+				update(nil, err)
+				// read it again on the next tick
+				last = nil
+			} else {
+				update(services[service], nil)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// changed reports whether the file of fi is not the one of last, either
+// of which may be nil for a missing file.
+func changed(last, fi os.FileInfo) bool {
+	if last == nil || fi == nil {
+		return last != fi
+	}
+	return !last.ModTime().Equal(fi.ModTime()) || last.Size() != fi.Size() || !os.SameFile(last, fi)
+}
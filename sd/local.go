@@ -0,0 +1,469 @@
+package sd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libra9z/mskit/v4/grace"
+	mslog "github.com/libra9z/mskit/v4/log"
+	"github.com/libra9z/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// InstanceRegistry is a registry the instances of services are added to
+// and removed from one at a time: the registries without a server, for
+// development and tests, StaticRegistry and FileRegistry, or an
+// EtcdRegistry.
+type InstanceRegistry interface {
+	// RegisterInstance adds instance to the instances of service,
+	// replacing the one with the same ID.
+	RegisterInstance(service string, instance Instance) error
+	// DeregisterInstance removes the instance with the ID id from the
+	// instances of service.
+	DeregisterInstance(service, id string) error
+}
+
+// StaticRegistry is the registry of the process, SD_TYPE_STATIC: the
+// services registered with it are resolved by the other services of the
+// process.
+var StaticRegistry = NewStaticResolver(nil)
+
+var (
+	_ InstanceRegistry = (*StaticResolver)(nil)
+	_ InstanceRegistry = (*FileRegistry)(nil)
+)
+
+// NewLocalRegistry returns the registry of sdType, SD_TYPE_STATIC or
+// SD_TYPE_FILE with the path of the file as address.
+func NewLocalRegistry(sdType, address string) (InstanceRegistry, error) {
+	switch sdType {
+	case SD_TYPE_STATIC:
+		return StaticRegistry, nil
+	case SD_TYPE_FILE:
+		if address == "" {
+			return nil, errors.New("no registry file")
+		}
+		return NewFileRegistry(address), nil
+	}
+	return nil, fmt.Errorf("%q is not a local registry", sdType)
+}
+
+// fileLockTimeout is how long a FileRegistry waits for the lock of its
+// file; a lock older than that was left by a crashed process and is broken.
+var fileLockTimeout = 5 * time.Second
+
+// FileRegistry is a registry in a local file, by default JSON and YAML if
+// its name ends in .yaml or .yml, mapping the names of the services to
+// their instances:
+//
+//	{
+//	  "users": [
+//	    {"id": "users-127.0.0.1:8081", "address": "127.0.0.1:8081", "tags": ["urlprefix-/users"]}
+//	  ]
+//	}
+//
+// The file may be written by hand or by the services registering in it,
+// which update it under a lock file, path with the suffix .lock. The
+// instances of a process which did not shut down stay in the file until
+// they are registered again or removed by hand.
+type FileRegistry struct {
+	path string
+}
+
+// NewFileRegistry returns the registry of the file at path, which is
+// created by the first registration.
+func NewFileRegistry(path string) *FileRegistry {
+	return &FileRegistry{path: path}
+}
+
+// Services returns the instances of the services of the registry, none if
+// its file does not exist.
+func (f *FileRegistry) Services() (map[string][]Instance, error) {
+	data, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return map[string][]Instance{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	services := make(map[string][]Instance)
+	if len(bytes.TrimSpace(data)) == 0 {
+		return services, nil
+	}
+	if f.yaml() {
+		err = yaml.Unmarshal(data, &services)
+	} else {
+		err = json.Unmarshal(data, &services)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("registry %s: %w", f.path, err)
+	}
+	return services, nil
+}
+
+func (f *FileRegistry) RegisterInstance(service string, instance Instance) error {
+	return f.update(func(services map[string][]Instance) {
+		services[service] = append(withoutInstance(services[service], instance.ID), instance)
+	})
+}
+
+func (f *FileRegistry) DeregisterInstance(service, id string) error {
+	return f.update(func(services map[string][]Instance) {
+		services[service] = withoutInstance(services[service], id)
+		if len(services[service]) == 0 {
+			delete(services, service)
+		}
+	})
+}
+
+func (f *FileRegistry) yaml() bool {
+	ext := strings.ToLower(filepath.Ext(f.path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// update changes the services of the file with change, under its lock. The
+// file is replaced at once, so it is never read half written.
+func (f *FileRegistry) update(change func(map[string][]Instance)) error {
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	services, err := f.Services()
+	if err != nil {
+		return err
+	}
+	change(services)
+	var data []byte
+	if f.yaml() {
+		data, err = yaml.Marshal(services)
+	} else {
+		data, err = json.MarshalIndent(services, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), "."+filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// lock takes the lock file of the registry, breaking it if it is stale.
+func (f *FileRegistry) lock() (unlock func(), err error) {
+	name := f.path + ".lock"
+	deadline := time.Now().Add(fileLockTimeout)
+	for {
+		lf, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			lf.Close()
+			return func() { os.Remove(name) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if fi, err := os.Stat(name); err == nil && time.Since(fi.ModTime()) > fileLockTimeout {
+			logger.Warn("registry=%s,breaking a stale lock", f.path)
+			os.Remove(name)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("registry %s: locked by %s", f.path, name)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+var _ Registar = (*registryRegister)(nil)
+
+// registryRegister is the Registar of an InstanceRegistry.
+type registryRegister struct {
+	sdType   string
+	registry InstanceRegistry
+	prefix   string
+	name     string
+	callback ServiceCallback
+	params   map[string]interface{}
+	addr     string //listen on address and port
+	id       string
+}
+
+// NewLocalRegistar returns the Registar of the local registry of sdType,
+// SD_TYPE_STATIC or SD_TYPE_FILE with the path of the file as address, see
+// NewLocalRegistry.
+func NewLocalRegistar(name string, prefix string, addr, sdType, address string, callback ServiceCallback, params map[string]interface{}) (Registar, error) {
+	registry, err := NewLocalRegistry(sdType, address)
+	if err != nil {
+		return nil, err
+	}
+	return &registryRegister{
+		sdType:   sdType,
+		registry: registry,
+		name:     name,
+		prefix:   prefix,
+		callback: callback,
+		params:   params,
+		addr:     addr,
+	}, nil
+}
+
+func (l *registryRegister) Register(app *grace.MicroService, schema string, address string, params map[string]interface{}, callbacks ...ServiceCallback) {
+	if l.name == "" {
+		mslog.Mslog.Critical("name empty")
+	}
+	l.params = params
+	if len(callbacks) > 0 {
+		l.callback = callbacks[0]
+	}
+	l.addr = address
+
+	go func() {
+		mslog.Mslog.Info("Listening on %s serving %s", l.addr, l.prefix)
+		if err := l.callback(app, l.params); err != nil {
+			mslog.Mslog.Critical(err)
+		}
+	}()
+
+	var tags []string
+	if l.prefix != "" {
+		for _, p := range strings.Split(l.prefix, ",") {
+			tags = append(tags, "urlprefix-"+p)
+		}
+	}
+	instance := Instance{ID: l.name + "-" + l.addr, Address: l.addr, Tags: tags, Weight: 1}
+	if l.params != nil {
+		instance.Tags = append(instance.Tags, paramTags(l.params)...)
+		instance.Meta = paramMeta(l.params)
+		if l.params["weight"] != nil {
+			instance.Weight = utils.Convert2Float64(l.params["weight"])
+		}
+	}
+	if err := l.registry.RegisterInstance(l.name, instance); err != nil {
+		mslog.Mslog.Critical(err)
+		return
+	}
+	l.id = instance.ID
+	mslog.Mslog.Info("Registered service %q in the %s registry", l.name, l.sdType)
+	if app != nil {
+		app.AddDeregisterer(l, grace.WithHookName(l.sdType+" "+l.id))
+	}
+}
+
+func (l *registryRegister) Deregister() {
+	if l.id == "" {
+		return
+	}
+	if err := l.registry.DeregisterInstance(l.name, l.id); err != nil {
+		mslog.Mslog.Error(err)
+		return
+	}
+	mslog.Mslog.Info("Deregistered service %q in the %s registry", l.name, l.sdType)
+}
+
+func (l *registryRegister) RegisterFromMemory(app *grace.MicroService, schema string, buf *bytes.Buffer, exparams map[string]interface{}, callbacks ...ServiceCallback) {
+	if buf == nil {
+		mslog.Mslog.Critical("内存中没有默认配置。")
+		return
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &data); err != nil {
+		mslog.Mslog.Critical("json:" + err.Error())
+		return
+	}
+
+	var p interface{}
+	key := schema + "_"
+	if data[key+"service"] != nil {
+		p = data[key+"service"]
+	} else if data[key+"services"] != nil {
+		p = data[key+"services"]
+	}
+
+	cps := make(map[string]interface{})
+	if data["TLSConfig"] != nil {
+		vs := data["TLSConfig"].(map[string]interface{})
+		cps["certfile"] = vs["certfile"]
+		cps["keyfile"] = vs["keyfile"]
+		cps["trustfile"] = vs["trustfile"]
+	}
+	if data["docker_enable"] != nil {
+		cps["docker_enable"] = data["docker_enable"]
+	}
+
+	switch schema {
+	case "http", "https", "tcp":
+		switch reflect.ValueOf(p).Kind() {
+		case reflect.Slice:
+			ps := p.([]interface{})
+			if len(ps) != len(callbacks) {
+				mslog.Mslog.Critical("服务数量与回调函数数量不匹配。")
+				return
+			}
+			for i, vs := range ps {
+				go l.registerService(app, vs.(map[string]interface{}), callbacks[i], cps)
+			}
+			waitStopped(app)
+		case reflect.Map:
+			if len(callbacks) < 1 {
+				mslog.Mslog.Critical("没有指定回调函数。")
+				return
+			}
+			l.registerService(app, p.(map[string]interface{}), callbacks[0], cps)
+		}
+	case "rpcx":
+		// the rpcx servers register their services themselves
+		if data["rpcx"] != nil {
+			for i, vv := range data["rpcx"].([]interface{}) {
+				v := vv.(map[string]interface{})
+				m := make(map[string]interface{})
+				if v["address"] != nil {
+					m["host"] = utils.ConvertToString(v["address"])
+				}
+				if v["port"] != nil {
+					m["port"] = utils.ConvertToString(v["port"])
+				}
+				m["sd_type"] = l.sdType
+				if v["sd_address"] != nil {
+					m["sd_address"] = v["sd_address"]
+				}
+				if cps["docker_enable"] != nil {
+					m["docker_enable"] = cps["docker_enable"]
+				}
+				go callbacks[i](app, m)
+			}
+		}
+	default:
+		mslog.Mslog.Critical("没有配置参数。")
+		panic("没有配置参数")
+	}
+}
+
+func (l *registryRegister) RegisterWithConf(app *grace.MicroService, schema string, fname string, callbacks ...ServiceCallback) {
+	l.RegisterFile(app, schema, fname, callbacks...)
+}
+
+func (l *registryRegister) RegisterFile(app *grace.MicroService, schema string, fname string, callbacks ...ServiceCallback) {
+	if fname == "" {
+		mslog.Mslog.Critical("没有指定配置文件。\n")
+		return
+	}
+	l.RegisterFromMemory(app, schema, bytes.NewBuffer(readFile(fname)), nil, callbacks...)
+}
+
+// registerService registers the service configured by params, as in the
+// configuration files of registerService, and serves it with callback.
+func (l *registryRegister) registerService(app *grace.MicroService, params map[string]interface{}, callback ServiceCallback, datas map[string]interface{}) {
+	var name, host string
+
+	de, _ := datas["docker_enable"].(bool)
+	if params["name"] != nil {
+		name = utils.ConvertToString(params["name"])
+	}
+	tags := paramTags(params)
+	if params["address"] != nil {
+		host = utils.Hostname2IPv4(utils.ConvertToString(params["address"]))
+	}
+	var port int
+	if params["port"] != nil {
+		port = utils.Convert2Int(params["port"])
+		datas["port"] = port
+	}
+	if port == 0 {
+		mslog.Mslog.Critical("没有指定端口号。")
+		return
+	}
+
+	go func() {
+		datas["host"] = host
+		if de {
+			datas["host"] = ""
+		}
+		mslog.Mslog.Info("Listening on %v:%d serving %s", datas["host"], port, strings.Join(tags, ","))
+		if err := callback(app, datas); err != nil {
+			mslog.Mslog.Critical(err)
+		}
+	}()
+
+	instance := Instance{
+		Address: net.JoinHostPort(host, strconv.Itoa(port)),
+		Tags:    tags,
+		Meta:    paramMeta(params),
+		Weight:  1,
+	}
+	if params["id"] != nil {
+		instance.ID = utils.ConvertToString(params["id"])
+	}
+	if instance.ID == "" {
+		instance.ID = name + "-" + instance.Address
+	}
+	if params["weight"] != nil {
+		instance.Weight = utils.Convert2Float64(params["weight"])
+	}
+
+	if err := l.registry.RegisterInstance(name, instance); err != nil {
+		mslog.Mslog.Critical(err)
+		return
+	}
+	mslog.Mslog.Info("Registered service %q in the %s registry with tags: %q", name, l.sdType, strings.Join(tags, ","))
+
+	deregisterOnStop(app, grace.DeregisterFunc(func() {
+		if err := l.registry.DeregisterInstance(name, instance.ID); err != nil {
+			mslog.Mslog.Error(err)
+			return
+		}
+		mslog.Mslog.Info("Deregistered service %q in the %s registry", name, l.sdType)
+	}), l.sdType+" "+instance.ID)
+}
+
+// paramTags returns the tags param, a list.
+func paramTags(params map[string]interface{}) []string {
+	var tags []string
+	switch vs := params["tags"].(type) {
+	case []string:
+		tags = append(tags, vs...)
+	case []interface{}:
+		for _, v := range vs {
+			tags = append(tags, utils.ConvertToString(v))
+		}
+	}
+	return tags
+}
+
+// paramMeta returns the meta param, a map.
+func paramMeta(params map[string]interface{}) map[string]string {
+	var meta map[string]string
+	switch vs := params["meta"].(type) {
+	case map[string]string:
+		meta = make(map[string]string, len(vs))
+		for k, v := range vs {
+			meta[k] = v
+		}
+	case map[string]interface{}:
+		meta = make(map[string]string, len(vs))
+		for k, v := range vs {
+			meta[k] = utils.ConvertToString(v)
+		}
+	}
+	return meta
+}
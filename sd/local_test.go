@@ -0,0 +1,179 @@
+package sd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libra9z/mskit/v4/grace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileRegistry(t *testing.T) {
+	for _, name := range []string{"registry.json", "registry.yaml"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			f := NewFileRegistry(path)
+			services, err := f.Services()
+			require.NoError(t, err)
+			assert.Empty(t, services, "no file")
+
+			a := Instance{ID: "users-a", Address: "127.0.0.1:8081", Tags: []string{"v1"}, Meta: map[string]string{"zone": "a"}, Weight: 2}
+			b := Instance{ID: "users-b", Address: "127.0.0.1:8082"}
+			require.NoError(t, f.RegisterInstance("users", a))
+			require.NoError(t, f.RegisterInstance("users", b))
+			b.Address = "127.0.0.1:8083"
+			require.NoError(t, f.RegisterInstance("users", b), "replaced")
+
+			services, err = f.Services()
+			require.NoError(t, err)
+			assert.Equal(t, map[string][]Instance{"users": {a, b}}, services)
+
+			require.NoError(t, f.DeregisterInstance("users", "users-a"))
+			require.NoError(t, f.DeregisterInstance("users", "users-b"))
+			services, err = f.Services()
+			require.NoError(t, err)
+			assert.Empty(t, services)
+			_, err = os.Stat(path + ".lock")
+			assert.True(t, os.IsNotExist(err), "unlocked")
+		})
+	}
+}
+
+func TestFileRegistryConcurrentUpdates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// a registry per process
+			f := NewFileRegistry(path)
+			assert.NoError(t, f.RegisterInstance("users", Instance{ID: fmt.Sprint(i), Address: fmt.Sprintf("127.0.0.1:%d", 8000+i)}))
+		}(i)
+	}
+	wg.Wait()
+	services, err := NewFileRegistry(path).Services()
+	require.NoError(t, err)
+	assert.Len(t, services["users"], 10)
+}
+
+func TestFileRegistryStaleLock(t *testing.T) {
+	defer func(timeout time.Duration) { fileLockTimeout = timeout }(fileLockTimeout)
+	fileLockTimeout = 50 * time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "registry.json")
+	require.NoError(t, ioutil.WriteFile(path+".lock", nil, 0644))
+	f := NewFileRegistry(path)
+	assert.NoError(t, f.RegisterInstance("users", Instance{ID: "a"}), "the lock is broken once stale")
+}
+
+func TestFileResolver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.yml")
+	r, err := NewFileResolver(path, map[string]interface{}{"interval": "5ms"})
+	require.NoError(t, err)
+	defer r.Close()
+
+	w, err := r.Watch(context.Background(), "users")
+	require.NoError(t, err)
+	assert.Empty(t, receive(t, w))
+
+	f := NewFileRegistry(path)
+	a := Instance{ID: "a", Address: "127.0.0.1:8081"}
+	require.NoError(t, f.RegisterInstance("users", a))
+	assert.Equal(t, []Instance{a}, receive(t, w))
+	require.NoError(t, f.RegisterInstance("orders", Instance{ID: "b", Address: "127.0.0.1:8082"}))
+
+	// written by hand, at once so it is never seen empty
+	tmp := path + ".tmp"
+	require.NoError(t, ioutil.WriteFile(tmp, []byte("users: [{"), 0644))
+	require.NoError(t, os.Rename(tmp, path))
+	time.Sleep(20 * time.Millisecond)
+	instances, err := r.Resolve(context.Background(), "users")
+	assert.NoError(t, err, "the instances known are kept")
+	assert.Equal(t, []Instance{a}, instances)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("users:\n- id: c\n  address: 127.0.0.1:8083\n"), 0644))
+	receiveUntil(t, w, []Instance{{ID: "c", Address: "127.0.0.1:8083"}})
+}
+
+func TestStaticRegistry(t *testing.T) {
+	r, err := NewResolver(WithSdType(SD_TYPE_STATIC))
+	require.NoError(t, err)
+	w, err := r.Watch(context.Background(), "static-users")
+	require.NoError(t, err)
+	assert.Empty(t, receive(t, w))
+
+	a := Instance{ID: "a", Address: "127.0.0.1:8081"}
+	require.NoError(t, StaticRegistry.RegisterInstance("static-users", a))
+	assert.Equal(t, []Instance{a}, receive(t, w))
+	require.NoError(t, StaticRegistry.DeregisterInstance("static-users", "a"))
+	assert.Empty(t, receive(t, w))
+
+	require.NoError(t, r.Close())
+	_, err = StaticRegistry.Resolve(context.Background(), "static-users")
+	assert.NoError(t, err, "the registry of the process stays open")
+}
+
+func TestLocalRegistar(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	reg := NewRegistar(WithSdType(SD_TYPE_FILE), WithSdAddress(path), WithServiceName("users"), WithPrefix("/users"))
+	require.NotNil(t, reg)
+	assert.Nil(t, NewRegistar(WithSdType("zookeeper")), "unknown type")
+	assert.Nil(t, NewRegistar(WithSdType(SD_TYPE_FILE)), "no file")
+
+	served := make(chan struct{})
+	app := &grace.MicroService{}
+	reg.Register(app, "http", "127.0.0.1:8081", map[string]interface{}{"weight": 3}, func(app *grace.MicroService, params map[string]interface{}) error {
+		close(served)
+		return nil
+	})
+	<-served
+
+	services, err := NewFileRegistry(path).Services()
+	require.NoError(t, err)
+	assert.Equal(t, []Instance{{
+		ID:      "users-127.0.0.1:8081",
+		Address: "127.0.0.1:8081",
+		Tags:    []string{"urlprefix-/users"},
+		Weight:  3,
+	}}, services["users"])
+
+	reg.Deregister()
+	services, err = NewFileRegistry(path).Services()
+	require.NoError(t, err)
+	assert.Empty(t, services)
+}
+
+func TestLocalRegistarWithoutApp(t *testing.T) {
+	skipWithoutSIGINT(t)
+	path := filepath.Join(t.TempDir(), "registry.json")
+	reg := NewRegistar(WithSdType(SD_TYPE_FILE), WithSdAddress(path))
+	require.NotNil(t, reg)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conf := bytes.NewBufferString(`{"http_service":{"name":"orders","address":"127.0.0.1","port":8082}}`)
+		reg.RegisterFromMemory(nil, "http", conf, nil, func(app *grace.MicroService, params map[string]interface{}) error {
+			return nil
+		})
+	}()
+	require.Eventually(t, func() bool {
+		services, err := NewFileRegistry(path).Services()
+		return err == nil && len(services["orders"]) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	interruptUntil(t, done)
+
+	services, err := NewFileRegistry(path).Services()
+	require.NoError(t, err)
+	assert.Empty(t, services["orders"], "deregistered")
+}
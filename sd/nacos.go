@@ -13,8 +13,6 @@ import (
 	"github.com/nacos-group/nacos-sdk-go/common/constant"
 	"github.com/nacos-group/nacos-sdk-go/vo"
 	"net"
-	"os"
-	"os/signal"
 	"reflect"
 	"strconv"
 	"strings"
@@ -113,8 +111,9 @@ func (n *nacosRegister) Register(app *grace.MicroService, schema string, address
 	clientConfig := GetClientConfig(n.params)
 	serverConfigs := GetServerConfig(n.servers, n.params)
 
+	serviceID := n.name + "-" + n.addr
+	serviceName, weight := nacosNaming(n.name, serviceID, n.params)
 	clusterName := ""
-	weight := 0.0
 	if n.params != nil && n.params["clustername"] != nil {
 		clusterName = utils.ConvertToString(n.params["clustername"])
 	}
@@ -127,11 +126,10 @@ func (n *nacosRegister) Register(app *grace.MicroService, schema string, address
 		"clientConfig":  clientConfig,
 	})
 	n.iclient = namingClient
-	serviceID := n.name + "-" + n.addr
 	success, _ := namingClient.RegisterInstance(vo.RegisterInstanceParam{
 		Ip:          host,
 		Port:        uint64(port),
-		ServiceName: serviceID,
+		ServiceName: serviceName,
 		Weight:      weight,
 		ClusterName: clusterName,
 		Enable:      true,
@@ -143,14 +141,11 @@ func (n *nacosRegister) Register(app *grace.MicroService, schema string, address
 		return
 	}
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, os.Kill)
-	<-quit
-
+	deregisterOnStop(app, n, "nacos "+serviceID)
 }
 
 func (n *nacosRegister) Deregister() {
-	serviceID := n.name + "-" + n.addr
+	serviceName, _ := nacosNaming(n.name, n.name+"-"+n.addr, n.params)
 	host, portstr, err := net.SplitHostPort(n.addr)
 	if err != nil {
 		log.Mslog.Error(err)
@@ -162,13 +157,26 @@ func (n *nacosRegister) Deregister() {
 	success, _ := n.iclient.DeregisterInstance(vo.DeregisterInstanceParam{
 		Ip:          host,
 		Port:        uint64(port),
-		ServiceName: serviceID,
+		ServiceName: serviceName,
 		Ephemeral:   true,
 	})
 
 	log.Mslog.Info("Deregistered service %q in consul %v", n.name, success)
 }
 
+// nacosNaming returns the nacos service name an instance of the service
+// name is registered as, and its default weight. By default it is
+// registered as serviceID, the name and address of the instance, with a
+// weight of 0. With the register_by_name param set, the instances of a
+// service share its name, with a weight of 1, so NewNacosResolver finds
+// them; the consumers looking up serviceID do not any more.
+func nacosNaming(name, serviceID string, params map[string]interface{}) (string, float64) {
+	if byName, _ := params["register_by_name"].(bool); byName {
+		return name, 1
+	}
+	return serviceID, 0
+}
+
 func (n *nacosRegister) RegisterFromMemory(app *grace.MicroService, schema string, buf *bytes.Buffer, exparams map[string]interface{}, callbacks ...ServiceCallback) {
 
 	if buf == nil {
@@ -232,9 +240,7 @@ func (n *nacosRegister) RegisterFromMemory(app *grace.MicroService, schema strin
 				go nacosRegisterService(app, schema, n.servers, n.token, v, callbacks[i], cps)
 			}
 
-			quit := make(chan os.Signal, 1)
-			signal.Notify(quit, os.Interrupt, os.Kill)
-			<-quit
+			waitStopped(app)
 
 			//select {}
 		case reflect.Map:
@@ -286,9 +292,7 @@ func (n *nacosRegister) RegisterFromMemory(app *grace.MicroService, schema strin
 				go nacosRegisterService(app, schema, n.servers, n.token, v, callbacks[i], cps)
 			}
 
-			quit := make(chan os.Signal, 1)
-			signal.Notify(quit, os.Interrupt, os.Kill)
-			<-quit
+			waitStopped(app)
 
 			//select {}
 		case reflect.Map:
@@ -469,8 +473,8 @@ func nacosRegisterService(app *grace.MicroService, schema, nacos, token string,
 	clientConfig := GetClientConfig(params)
 	serverConfigs := GetServerConfig(nacos, params)
 
+	serviceName, weight := nacosNaming(name, serviceID, params)
 	clusterName := ""
-	weight := 0.0
 	if params != nil && params["clustername"] != nil {
 		clusterName = utils.ConvertToString(params["clustername"])
 	}
@@ -494,7 +498,7 @@ func nacosRegisterService(app *grace.MicroService, schema, nacos, token string,
 	success, err := namingClient.RegisterInstance(vo.RegisterInstanceParam{
 		Ip:          host,
 		Port:        uint64(port),
-		ServiceName: serviceID,
+		ServiceName: serviceName,
 		Weight:      weight,
 		ClusterName: clusterName,
 		GroupName:   grpname,
@@ -507,17 +511,14 @@ func nacosRegisterService(app *grace.MicroService, schema, nacos, token string,
 		return
 	}
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, os.Kill)
-	<-quit
-
-	success, _ = namingClient.DeregisterInstance(vo.DeregisterInstanceParam{
-		Ip:          host,
-		Port:        uint64(port),
-		ServiceName: serviceID,
-		Ephemeral:   true,
-	})
-
-	log.Mslog.Info("Deregistered service %q in consul", name)
-
+	deregisterOnStop(app, grace.DeregisterFunc(func() {
+		success, _ := namingClient.DeregisterInstance(vo.DeregisterInstanceParam{
+			Ip:          host,
+			Port:        uint64(port),
+			ServiceName: serviceName,
+			GroupName:   grpname,
+			Ephemeral:   true,
+		})
+		log.Mslog.Info("Deregistered service %q in nacos %v", name, success)
+	}), "nacos "+serviceID)
 }
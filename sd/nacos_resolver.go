@@ -0,0 +1,88 @@
+package sd
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/libra9z/utils"
+	"github.com/nacos-group/nacos-sdk-go/clients"
+	"github.com/nacos-group/nacos-sdk-go/clients/naming_client"
+	"github.com/nacos-group/nacos-sdk-go/model"
+	"github.com/nacos-group/nacos-sdk-go/vo"
+)
+
+type nacosResolver struct {
+	*cache
+	client naming_client.INamingClient
+	group  string
+}
+
+// NewNacosResolver returns a resolver of the services registered with the
+// nacos servers at address, with their healthy instances. The instances are
+// watched with subscriptions. params configures the client like for the
+// registrar, see GetClientConfig, and may set group_name. The instances are
+// looked up by the name of their service, so they must be registered with
+// the register_by_name param.
+func NewNacosResolver(address string, params map[string]interface{}) (Resolver, error) {
+	client, err := clients.CreateNamingClient(map[string]interface{}{
+		"serverConfigs": GetServerConfig(address, params),
+		"clientConfig":  GetClientConfig(params),
+	})
+	if err != nil {
+		return nil, err
+	}
+	r := &nacosResolver{client: client}
+	if params != nil && params["group_name"] != nil {
+		r.group = utils.ConvertToString(params["group_name"])
+	}
+	r.cache = newCache(r.watch)
+	return r, nil
+}
+
+func (r *nacosResolver) watch(ctx context.Context, service string, update func([]Instance, error)) {
+	subscription := &vo.SubscribeParam{
+		ServiceName: service,
+		GroupName:   r.group,
+		SubscribeCallback: func(_ []model.SubscribeService, err error) {
+			if err != nil {
+				update(nil, err)
+				return
+			}
+			// the services of the callback do not tell which are healthy
+			update(r.instances(service))
+		},
+	}
+	update(r.instances(service))
+	if err := r.client.Subscribe(subscription); err != nil {
+		update(nil, err)
+	}
+	<-ctx.Done()
+	r.client.Unsubscribe(subscription)
+}
+
+func (r *nacosResolver) instances(service string) ([]Instance, error) {
+	hosts, err := r.client.SelectInstances(vo.SelectInstancesParam{
+		ServiceName: service,
+		GroupName:   r.group,
+		HealthyOnly: true,
+	})
+	if err != nil {
+		// the client fails on services without instances
+		if strings.Contains(err.Error(), "instance list is empty") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	instances := make([]Instance, 0, len(hosts))
+	for _, h := range hosts {
+		instances = append(instances, Instance{
+			ID:      h.InstanceId,
+			Address: net.JoinHostPort(h.Ip, strconv.FormatUint(h.Port, 10)),
+			Meta:    h.Metadata,
+			Weight:  h.Weight,
+		})
+	}
+	return instances, nil
+}
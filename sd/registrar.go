@@ -3,6 +3,9 @@ package sd
 import (
 	"bytes"
 	"fmt"
+	"os"
+	"os/signal"
+
 	"github.com/libra9z/mskit/v4/grace"
 )
 
@@ -58,6 +61,12 @@ func NewRegistar(options ...SdOption) Registar {
 		s.r, err = NewConsulRegistar(s.name, s.prefix, s.addr, s.SdAddress, s.SdToken, s.callback, s.params)
 	case SD_TYPE_NACOS:
 		s.r, err = NewNacosRegistar(s.name, s.prefix, s.addr, s.SdAddress, s.SdToken, s.callback, s.params)
+	case SD_TYPE_ETCD:
+		s.r, err = NewEtcdRegistar(s.name, s.prefix, s.addr, s.SdAddress, s.SdToken, s.callback, s.params)
+	case SD_TYPE_FILE, SD_TYPE_STATIC:
+		s.r, err = NewLocalRegistar(s.name, s.prefix, s.addr, s.SdType, s.SdAddress, s.callback, s.params)
+	default:
+		err = fmt.Errorf("unknown service discovery type %q", s.SdType)
 	}
 	if err != nil {
 		logger.Error("error=%s", fmt.Sprintf("不能注册服务-%s", err.Error()))
@@ -83,3 +92,30 @@ func (s *serviceDiscovery) RegisterFromMemory(app *grace.MicroService, schema st
 func (s *serviceDiscovery) Deregister() {
 	s.r.Deregister()
 }
+
+// waitStopped blocks until app has shut down, letting app handle SIGINT and
+// SIGTERM. The registrations attached to app with AddDeregisterer are
+// removed before its requests are drained. Without app, it blocks until
+// SIGINT.
+func waitStopped(app *grace.MicroService) {
+	if app == nil {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, os.Interrupt, os.Kill)
+		<-quit
+		return
+	}
+	app.NotifySignals()
+	<-app.Done()
+}
+
+// deregisterOnStop attaches d to app as name and waits for app to stop, see
+// waitStopped. Without app, d is removed once SIGINT is received.
+func deregisterOnStop(app *grace.MicroService, d grace.Deregisterer, name string) {
+	if app == nil {
+		waitStopped(nil)
+		d.Deregister()
+		return
+	}
+	app.AddDeregisterer(d, grace.WithHookName(name))
+	waitStopped(app)
+}
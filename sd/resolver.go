@@ -0,0 +1,331 @@
+package sd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libra9z/mskit/v4/rest"
+)
+
+// ErrResolverClosed is returned by the methods of a closed Resolver.
+var ErrResolverClosed = errors.New("resolver closed")
+
+// resolverRetry is the delay before a failed query of the instances of a
+// service is retried.
+var resolverRetry = time.Second
+
+// Instance is a healthy instance of a service.
+type Instance struct {
+	ID      string            `json:"id" yaml:"id"`
+	Address string            `json:"address" yaml:"address"` // host:port
+	Tags    []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty" yaml:"meta,omitempty"`
+	// Weight is the relative share of the requests the instance should
+	// receive, as set in the registry; 0 counts as 1.
+	Weight float64 `json:"weight,omitempty" yaml:"weight,omitempty"`
+}
+
+// Resolver finds the healthy instances of services. The instances of a
+// service are watched from the first time they are asked for and cached,
+// so Resolve only waits for the registry once per service.
+//
+// The instances returned are shared and must not be modified.
+type Resolver interface {
+	// Resolve returns the healthy instances of service, which may be none.
+	// It returns an error if the registry could not be queried yet; later
+	// failures leave the last instances known in place.
+	Resolve(ctx context.Context, service string) ([]Instance, error)
+	// Watch returns a channel receiving the healthy instances of service
+	// once known and every time they change. A slow receiver only gets the
+	// latest list. The channel is closed when ctx is done or the resolver
+	// is closed.
+	Watch(ctx context.Context, service string) (<-chan []Instance, error)
+	// Close stops watching the services.
+	Close() error
+}
+
+// NewResolver returns the resolver of the registry set by WithSdType and
+// WithSdAddress, configured by WithParams, see NewConsulResolver,
+// NewNacosResolver, NewEtcdResolver and NewFileResolver. The resolver of
+// SD_TYPE_STATIC is StaticRegistry, which Close leaves open.
+func NewResolver(options ...SdOption) (Resolver, error) {
+	s := &serviceDiscovery{}
+	for _, option := range options {
+		option(s)
+	}
+	switch s.SdType {
+	case SD_TYPE_CONSUL:
+		return NewConsulResolver(s.SdAddress, s.SdToken, s.params)
+	case SD_TYPE_NACOS:
+		return NewNacosResolver(s.SdAddress, s.params)
+	case SD_TYPE_ETCD:
+		return NewEtcdResolver(s.SdAddress, s.params)
+	case SD_TYPE_FILE:
+		return NewFileResolver(s.SdAddress, s.params)
+	case SD_TYPE_STATIC:
+		return sharedResolver{StaticRegistry}, nil
+	}
+	return nil, fmt.Errorf("unknown service discovery type %q", s.SdType)
+}
+
+// Instancer returns the rest.Instancer of the addresses of the instances of
+// service, to call it with a rest.Client.
+func Instancer(r Resolver, service string) rest.Instancer {
+	return func(ctx context.Context) ([]string, error) {
+		instances, err := r.Resolve(ctx, service)
+		if err != nil {
+			return nil, err
+		}
+		addresses := make([]string, 0, len(instances))
+		for _, i := range instances {
+			addresses = append(addresses, i.Address)
+		}
+		return addresses, nil
+	}
+}
+
+// watchFunc watches the instances of service until ctx is done, calling
+// update with every list of instances it gets, or with the error of a
+// failed query.
+type watchFunc func(ctx context.Context, service string, update func([]Instance, error))
+
+// cache implements Resolver with the watches of a registry.
+type cache struct {
+	watch    watchFunc
+	ctx      context.Context
+	cancel   context.CancelFunc
+	mu       sync.Mutex
+	services map[string]*serviceCache
+}
+
+type serviceCache struct {
+	// resolved is closed once the first list, or error, is known.
+	resolved  chan struct{}
+	instances []Instance
+	err       error
+	watchers  map[chan []Instance]struct{}
+}
+
+func newCache(watch watchFunc) *cache {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &cache{
+		watch:    watch,
+		ctx:      ctx,
+		cancel:   cancel,
+		services: make(map[string]*serviceCache),
+	}
+}
+
+// service returns the cache of name, watching it if it is not yet.
+func (c *cache) service(name string) (*serviceCache, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ctx.Err() != nil {
+		return nil, ErrResolverClosed
+	}
+	s := c.services[name]
+	if s == nil {
+		s = &serviceCache{
+			resolved: make(chan struct{}),
+			watchers: make(map[chan []Instance]struct{}),
+		}
+		c.services[name] = s
+		go c.watch(c.ctx, name, func(instances []Instance, err error) {
+			c.update(name, s, instances, err)
+		})
+	}
+	return s, nil
+}
+
+// update records the instances, or the error, of the service of s and
+// notifies its watchers of a change. An error leaves the instances known
+// before in place.
+func (c *cache) update(name string, s *serviceCache, instances []Instance, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	first := true
+	select {
+	case <-s.resolved:
+		first = false
+	default:
+		defer close(s.resolved)
+	}
+
+	if err != nil {
+		logger.Error("service=%s,error=%v", name, err)
+		if first || s.err != nil {
+			s.err = err
+		}
+		return
+	}
+	instances = sortInstances(instances)
+	changed := first || s.err != nil || !reflect.DeepEqual(instances, s.instances)
+	s.instances, s.err = instances, nil
+	if !changed {
+		return
+	}
+	for w := range s.watchers {
+		notify(w, instances)
+	}
+}
+
+// notify sends instances to w, replacing the list w holds if its receiver
+// is late. Only called with the lock of the cache held.
+func notify(w chan []Instance, instances []Instance) {
+	select {
+	case <-w:
+	default:
+	}
+	w <- instances
+}
+
+func sortInstances(instances []Instance) []Instance {
+	sorted := append([]Instance{}, instances...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Address != sorted[j].Address {
+			return sorted[i].Address < sorted[j].Address
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+	return sorted
+}
+
+func (c *cache) Resolve(ctx context.Context, service string) ([]Instance, error) {
+	s, err := c.service(service)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-s.resolved:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.ctx.Done():
+		return nil, ErrResolverClosed
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return s.instances, s.err
+}
+
+func (c *cache) Watch(ctx context.Context, service string) (<-chan []Instance, error) {
+	s, err := c.service(service)
+	if err != nil {
+		return nil, err
+	}
+	w := make(chan []Instance, 1)
+	c.mu.Lock()
+	s.watchers[w] = struct{}{}
+	select {
+	case <-s.resolved:
+		if s.err == nil {
+			w <- s.instances
+		}
+	default:
+	}
+	c.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.ctx.Done():
+		}
+		c.mu.Lock()
+		delete(s.watchers, w)
+		close(w)
+		c.mu.Unlock()
+	}()
+	return w, nil
+}
+
+func (c *cache) Close() error {
+	c.cancel()
+	return nil
+}
+
+// StaticResolver is a Resolver of fixed instances, e.g. for tests or for
+// services without a registry. Set changes the instances of a service and
+// notifies its watchers.
+type StaticResolver struct {
+	*cache
+	mu       sync.Mutex
+	services map[string][]Instance
+}
+
+var _ Resolver = (*StaticResolver)(nil)
+
+// NewStaticResolver returns a resolver of the instances of services.
+func NewStaticResolver(services map[string][]Instance) *StaticResolver {
+	r := &StaticResolver{services: make(map[string][]Instance, len(services))}
+	for name, instances := range services {
+		r.services[name] = instances
+	}
+	r.cache = newCache(func(ctx context.Context, service string, update func([]Instance, error)) {
+		// under the lock, so Set does not race with the first update
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		update(r.services[service], nil)
+	})
+	return r
+}
+
+// Set sets the instances of service.
+func (r *StaticResolver) Set(service string, instances ...Instance) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.set(service, instances)
+}
+
+// RegisterInstance adds instance to the instances of service, replacing the
+// one with the same ID.
+func (r *StaticResolver) RegisterInstance(service string, instance Instance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.set(service, append(withoutInstance(r.services[service], instance.ID), instance))
+	return nil
+}
+
+// DeregisterInstance removes the instance with the ID id from the instances
+// of service.
+func (r *StaticResolver) DeregisterInstance(service, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.set(service, withoutInstance(r.services[service], id))
+	return nil
+}
+
+// set sets the instances of service, with the lock of r held.
+func (r *StaticResolver) set(service string, instances []Instance) {
+	r.services[service] = instances
+
+	r.cache.mu.Lock()
+	s := r.cache.services[service]
+	r.cache.mu.Unlock()
+	if s != nil {
+		r.cache.update(service, s, instances, nil)
+	}
+}
+
+// withoutInstance returns a copy of instances without the one with the ID
+// id.
+func withoutInstance(instances []Instance, id string) []Instance {
+	kept := make([]Instance, 0, len(instances))
+	for _, i := range instances {
+		if i.ID != id {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
+
+// sharedResolver is a Resolver shared by its users, which Close leaves
+// open.
+type sharedResolver struct {
+	Resolver
+}
+
+func (sharedResolver) Close() error { return nil }
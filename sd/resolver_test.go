@@ -0,0 +1,226 @@
+package sd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receive(t *testing.T, w <-chan []Instance) []Instance {
+	t.Helper()
+	select {
+	case instances, ok := <-w:
+		require.True(t, ok, "watch closed")
+		return instances
+	case <-time.After(time.Second):
+		t.Fatal("no instances received")
+		return nil
+	}
+}
+
+// receiveUntil receives from w until want, e.g. past the updates of a file
+// being rewritten.
+func receiveUntil(t *testing.T, w <-chan []Instance, want []Instance) {
+	t.Helper()
+	deadline := time.After(time.Second)
+	var got []Instance
+	for {
+		select {
+		case instances, ok := <-w:
+			require.True(t, ok, "watch closed")
+			if got = instances; assert.ObjectsAreEqual(want, got) {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("instances %v not received, last %v", want, got)
+		}
+	}
+}
+
+func TestStaticResolver(t *testing.T) {
+	a := Instance{ID: "a", Address: "10.0.0.1:80"}
+	b := Instance{ID: "b", Address: "10.0.0.2:80"}
+	r := NewStaticResolver(map[string][]Instance{"users": {b, a}})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	instances, err := r.Resolve(ctx, "users")
+	require.NoError(t, err)
+	assert.Equal(t, []Instance{a, b}, instances, "sorted by address")
+	instances, err = r.Resolve(ctx, "orders")
+	require.NoError(t, err)
+	assert.Empty(t, instances)
+
+	w, err := r.Watch(ctx, "users")
+	require.NoError(t, err)
+	assert.Equal(t, []Instance{a, b}, receive(t, w))
+
+	r.Set("users", a, b)
+	select {
+	case <-w:
+		t.Fatal("notified without a change")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// a late receiver only gets the latest list
+	r.Set("users", a)
+	r.Set("users", b)
+	assert.Equal(t, []Instance{b}, receive(t, w))
+	instances, _ = r.Resolve(ctx, "users")
+	assert.Equal(t, []Instance{b}, instances)
+
+	addresses, err := Instancer(r, "users")(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.2:80"}, addresses)
+
+	cancel()
+	_, ok := <-w
+	assert.False(t, ok, "the watch is closed with its context")
+
+	require.NoError(t, r.Close())
+	_, err = r.Resolve(context.Background(), "users")
+	assert.ErrorIs(t, err, ErrResolverClosed)
+}
+
+// fakeConsul answers the blocking queries of the consul resolver: a query
+// waits until the index of the service moves past its WaitIndex.
+type fakeConsul struct {
+	mu      sync.Mutex
+	changed chan struct{}
+	index   uint64
+	entries []*api.ServiceEntry
+	err     error
+	queries []string
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{changed: make(chan struct{}), index: 1}
+}
+
+func (f *fakeConsul) set(entries []*api.ServiceEntry, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries, f.err = entries, err
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeConsul) Register(r *api.AgentServiceRegistration) error   { return nil }
+func (f *fakeConsul) Deregister(r *api.AgentServiceRegistration) error { return nil }
+
+func (f *fakeConsul) Service(service, tag string, passingOnly bool, q *api.QueryOptions) ([]*api.ServiceEntry, *api.QueryMeta, error) {
+	for {
+		f.mu.Lock()
+		f.queries = append(f.queries, service+"/"+tag)
+		index, entries, err, changed := f.index, f.entries, f.err, f.changed
+		f.mu.Unlock()
+		if err != nil {
+			return nil, nil, err
+		}
+		if !passingOnly {
+			return nil, nil, errors.New("not passing only")
+		}
+		if index > q.WaitIndex {
+			return entries, &api.QueryMeta{LastIndex: index}, nil
+		}
+		select {
+		case <-changed:
+		case <-q.Context().Done():
+			return nil, nil, q.Context().Err()
+		}
+	}
+}
+
+func entry(id, address string, port int) *api.ServiceEntry {
+	return &api.ServiceEntry{
+		Node:    &api.Node{Address: "192.168.0.1"},
+		Service: &api.AgentService{ID: id, Address: address, Port: port, Tags: []string{"v1"}},
+	}
+}
+
+func TestConsulResolver(t *testing.T) {
+	defer func(retry time.Duration) { resolverRetry = retry }(resolverRetry)
+	resolverRetry = time.Millisecond
+
+	consul := newFakeConsul()
+	consul.set([]*api.ServiceEntry{entry("users-1", "10.0.0.1", 80), entry("users-2", "", 81)}, nil)
+	r := newConsulResolver(consul)
+	r.tag = "v1"
+	defer r.Close()
+
+	instances, err := r.Resolve(context.Background(), "users")
+	require.NoError(t, err)
+	assert.Equal(t, []Instance{
+		{ID: "users-1", Address: "10.0.0.1:80", Tags: []string{"v1"}, Weight: 1},
+		{ID: "users-2", Address: "192.168.0.1:81", Tags: []string{"v1"}, Weight: 1},
+	}, instances)
+
+	w, err := r.Watch(context.Background(), "users")
+	require.NoError(t, err)
+	receive(t, w)
+
+	consul.set([]*api.ServiceEntry{entry("users-2", "", 81)}, nil)
+	instances = receive(t, w)
+	require.Len(t, instances, 1)
+	assert.Equal(t, "users-2", instances[0].ID)
+
+	// failures keep the instances known
+	consul.set(nil, errors.New("agent down"))
+	time.Sleep(10 * time.Millisecond)
+	instances, err = r.Resolve(context.Background(), "users")
+	assert.NoError(t, err)
+	assert.Len(t, instances, 1)
+
+	consul.set(nil, nil)
+	assert.Empty(t, receive(t, w))
+
+	consul.mu.Lock()
+	assert.Contains(t, consul.queries, "users/v1")
+	consul.mu.Unlock()
+}
+
+func TestConsulResolverError(t *testing.T) {
+	defer func(retry time.Duration) { resolverRetry = retry }(resolverRetry)
+	resolverRetry = time.Millisecond
+
+	consul := newFakeConsul()
+	consul.set(nil, errors.New("agent down"))
+	r := newConsulResolver(consul)
+	defer r.Close()
+
+	_, err := r.Resolve(context.Background(), "users")
+	assert.EqualError(t, err, "agent down")
+
+	consul.set([]*api.ServiceEntry{entry("users-1", "10.0.0.1", 80)}, nil)
+	require.Eventually(t, func() bool {
+		instances, err := r.Resolve(context.Background(), "users")
+		return err == nil && len(instances) == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestNewResolver(t *testing.T) {
+	_, err := NewResolver(WithSdType("zookeeper"))
+	assert.Error(t, err)
+
+	r, err := NewResolver(WithSdType(SD_TYPE_CONSUL), WithSdAddress("127.0.0.1:8500"), WithParams(map[string]interface{}{"tag": "v1", "wait": "1m"}))
+	require.NoError(t, err)
+	assert.Equal(t, "v1", r.(*consulResolver).tag)
+	assert.Equal(t, time.Minute, r.(*consulResolver).wait)
+	r.Close()
+}
+
+func TestNacosNaming(t *testing.T) {
+	name, weight := nacosNaming("users", "users-127.0.0.1:8081", nil)
+	assert.Equal(t, "users-127.0.0.1:8081", name)
+	assert.Equal(t, 0.0, weight)
+
+	name, weight = nacosNaming("users", "users-127.0.0.1:8081", map[string]interface{}{"register_by_name": true})
+	assert.Equal(t, "users", name)
+	assert.Equal(t, 1.0, weight)
+}
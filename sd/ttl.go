@@ -0,0 +1,152 @@
+package sd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/libra9z/log4go"
+	"github.com/libra9z/mskit/v4/grace"
+	consulsd "github.com/libra9z/sd/consul"
+)
+
+// ttlUpdater updates the status of consul TTL checks, like *api.Agent.
+type ttlUpdater interface {
+	UpdateTTL(checkID, output, status string) error
+}
+
+// ttlHeartbeat keeps a consul TTL check of a service up to date with the
+// health of app, see grace.MicroService.CheckHealth: instead of consul
+// polling the service, which it may not reach behind NAT or in docker, the
+// service reports its status every third of the TTL.
+type ttlHeartbeat struct {
+	agent    ttlUpdater
+	app      *grace.MicroService
+	checkID  string
+	interval time.Duration
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func startHeartbeat(agent ttlUpdater, app *grace.MicroService, checkID string, ttl time.Duration) *ttlHeartbeat {
+	hb := &ttlHeartbeat{
+		agent:    agent,
+		app:      app,
+		checkID:  checkID,
+		interval: ttl / 3,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go hb.run()
+	return hb
+}
+
+func (hb *ttlHeartbeat) run() {
+	defer close(hb.done)
+	ticker := time.NewTicker(hb.interval)
+	defer ticker.Stop()
+	for {
+		hb.beat()
+		select {
+		case <-hb.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// beat reports the health of the service: passing when it is healthy and
+// ready, critical otherwise, with the health report as output.
+func (hb *ttlHeartbeat) beat() {
+	status, output := api.HealthPassing, "ok"
+	if hb.app != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), hb.interval)
+		report := hb.app.CheckHealth(ctx)
+		cancel()
+		if report.Status != grace.StatusUp {
+			status = api.HealthCritical
+		}
+		if b, err := json.Marshal(report); err == nil {
+			output = string(b)
+		}
+	}
+	if err := hb.agent.UpdateTTL(hb.checkID, output, status); err != nil {
+		logger.Error("error=%v", err)
+	}
+}
+
+// Stop stops the heartbeat and turns the check critical.
+func (hb *ttlHeartbeat) Stop() error {
+	var err error
+	hb.stopOnce.Do(func() {
+		close(hb.stop)
+		<-hb.done
+		err = hb.agent.UpdateTTL(hb.checkID, "shutting down", api.HealthCritical)
+	})
+	return err
+}
+
+// consulRegistration is a service registered in consul, with the
+// heartbeats of its TTL checks.
+type consulRegistration struct {
+	reg        *consulsd.Registrar
+	heartbeats []*ttlHeartbeat
+}
+
+// registerConsul registers service with consul and starts the heartbeats
+// of its TTL checks, reporting the health of app. TTL checks without an ID
+// are given one, so they can be updated.
+func registerConsul(app *grace.MicroService, client *api.Client, service *api.AgentServiceRegistration) *consulRegistration {
+	checks := service.Checks
+	if service.Check != nil {
+		checks = append(api.AgentServiceChecks{service.Check}, checks...)
+	}
+	for i, check := range checks {
+		if check.TTL != "" && check.CheckID == "" {
+			check.CheckID = fmt.Sprintf("ttl-%s-%d", service.ID, i)
+		}
+	}
+
+	r := &consulRegistration{
+		reg: consulsd.NewRegistrar(consulsd.NewClient(client), service, log4go.NewDefaultLogger(log4go.FINEST)),
+	}
+	r.reg.Register()
+	for _, check := range checks {
+		if check.TTL == "" {
+			continue
+		}
+		ttl, err := time.ParseDuration(check.TTL)
+		if err != nil || ttl <= 0 {
+			logger.Error("error=invalid ttl %q of check %s", check.TTL, check.CheckID)
+			continue
+		}
+		r.heartbeats = append(r.heartbeats, startHeartbeat(client.Agent(), app, check.CheckID, ttl))
+	}
+	return r
+}
+
+// Deregister stops the heartbeats, turning the TTL checks critical, then
+// deregisters the service.
+func (r *consulRegistration) Deregister() {
+	for _, hb := range r.heartbeats {
+		if err := hb.Stop(); err != nil {
+			logger.Error("error=%v", err)
+		}
+	}
+	r.reg.Deregister()
+}
+
+// Register registers the service with the consul agent at consulAddr.
+// Checks with a ttl key are TTL checks, kept up to date with the health of
+// app by the service itself until app shuts down, see
+// grace.MicroService.CheckHealth; the service is deregistered then.
+func (so *ServiceOptions) Register(app *grace.MicroService, consulAddr string) {
+	r := registerConsul(app, newConsulClient(consulAddr, ""), so.GetConsulRegistration())
+	if app != nil {
+		app.AddDeregisterer(r, grace.WithHookName("consul "+so.ServiceId))
+	}
+}
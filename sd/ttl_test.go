@@ -0,0 +1,73 @@
+package sd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/libra9z/httprouter"
+	"github.com/libra9z/mskit/v4/grace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ttlUpdate struct {
+	checkID, status string
+}
+
+type fakeAgent struct {
+	mu      sync.Mutex
+	updates []ttlUpdate
+}
+
+func (a *fakeAgent) UpdateTTL(checkID, output, status string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.updates = append(a.updates, ttlUpdate{checkID, status})
+	return nil
+}
+
+func (a *fakeAgent) last() ttlUpdate {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.updates) == 0 {
+		return ttlUpdate{}
+	}
+	return a.updates[len(a.updates)-1]
+}
+
+func TestTTLHeartbeat(t *testing.T) {
+	app := &grace.MicroService{Router: httprouter.New(), Server: &http.Server{}}
+	agent := &fakeAgent{}
+	hb := startHeartbeat(agent, app, "check-1", 30*time.Millisecond)
+
+	// not serving yet
+	require.Eventually(t, func() bool { return agent.last().status == api.HealthCritical }, time.Second, time.Millisecond)
+
+	var failing error
+	var mu sync.Mutex
+	app.AddReadinessCheck("database", func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return failing
+	})
+	go app.Serve("127.0.0.1", "0")
+	require.Eventually(t, func() bool { return agent.last().status == api.HealthPassing }, time.Second, time.Millisecond)
+
+	mu.Lock()
+	failing = errors.New("down")
+	mu.Unlock()
+	require.Eventually(t, func() bool { return agent.last().status == api.HealthCritical }, time.Second, time.Millisecond)
+
+	require.NoError(t, hb.Stop())
+	assert.Equal(t, ttlUpdate{"check-1", api.HealthCritical}, agent.last())
+	n := len(agent.updates)
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, agent.updates, n, "no update after Stop")
+	assert.NoError(t, hb.Stop())
+	assert.NoError(t, app.Shutdown(context.Background()))
+}
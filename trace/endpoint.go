@@ -0,0 +1,56 @@
+package trace
+
+import (
+	"context"
+
+	"github.com/libra9z/mskit/v4/endpoint"
+	"github.com/libra9z/mskit/v4/rest"
+)
+
+// TraceEndpoint returns a Middleware recording a span of tracer for every
+// call of the endpoint, a child of the span of the context, e.g. the span of
+// the request started by HTTPServerTrace. The span is named by the Name
+// option, the method of the request by default, and tagged with the Tags
+// option. It records the error returned by the endpoint, or the error of a
+// response implementing endpoint.Failer.
+//
+//	ep = trace.TraceEndpoint(tracer, trace.Name("create user"))(ep)
+func TraceEndpoint(tracer Tracer, options ...TracerOption) endpoint.Middleware {
+	o := &TracerOptions{Tags: make(map[string]string)}
+	for _, option := range options {
+		option(o)
+	}
+
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			name := o.Name
+			if name == "" {
+				name = endpointName(ctx, request)
+			}
+
+			ctx, finish := tracer.StartSpan(ctx, name, o.Tags)
+			defer func() {
+				failure := err
+				if f, ok := response.(endpoint.Failer); ok && failure == nil {
+					failure = f.Failed()
+				}
+				finish(failure)
+			}()
+
+			return next(ctx, request)
+		}
+	}
+}
+
+// endpointName returns the method of the request of the endpoint, or
+// "endpoint" if it is not known.
+func endpointName(ctx context.Context, request interface{}) string {
+	mc, _ := request.(*rest.Mcontext)
+	if mc == nil {
+		mc = rest.McontextFromContext(ctx)
+	}
+	if mc != nil && mc.Method != "" {
+		return mc.Method
+	}
+	return "endpoint"
+}
@@ -0,0 +1,82 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/libra9z/mskit/v4/endpoint"
+	"github.com/libra9z/mskit/v4/rest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	otrace "go.opentelemetry.io/otel/trace"
+)
+
+type failedResponse struct{ err error }
+
+func (r failedResponse) Failed() error { return r.err }
+
+func TestTraceEndpoint(t *testing.T) {
+	tracer, recorder := newRecordingTracer()
+	mw := TraceEndpoint(tracer, Name("create user"), Tags(map[string]string{"layer": "service"}))
+
+	ctx, finish := tracer.StartSpan(context.Background(), "request", nil)
+	parent := otrace.SpanContextFromContext(ctx)
+	_, err := mw(endpoint.Nop)(ctx, nil)
+	require.NoError(t, err)
+	_, err = mw(func(context.Context, interface{}) (interface{}, error) {
+		return nil, errors.New("database down")
+	})(ctx, nil)
+	assert.EqualError(t, err, "database down")
+	response, err := mw(func(context.Context, interface{}) (interface{}, error) {
+		return failedResponse{errors.New("name taken")}, nil
+	})(ctx, nil)
+	assert.NoError(t, err)
+	assert.IsType(t, failedResponse{}, response)
+	finish(nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 4)
+	for i, description := range []string{"", "database down", "name taken"} {
+		s := spans[i]
+		assert.Equal(t, "create user", s.Name())
+		assert.Equal(t, parent.SpanID(), s.Parent().SpanID())
+		assert.Equal(t, "service", spanAttributes(s)["layer"].AsString())
+		assert.Equal(t, description, s.Status().Description)
+		if description != "" {
+			assert.Equal(t, codes.Error, s.Status().Code)
+		}
+	}
+}
+
+func TestStartSpanFromContext(t *testing.T) {
+	ctx, finish := StartSpanFromContext(context.Background(), "untraced", nil)
+	assert.Equal(t, context.Background(), ctx)
+	finish(nil)
+
+	tracer, recorder := newRecordingTracer()
+	e := rest.NewEngine(
+		TraceEndpoint(tracer)(func(ctx context.Context, request interface{}) (interface{}, error) {
+			mc := request.(*rest.Mcontext)
+			_, finish := StartSpanFromContext(mc.Ctx, "load user", map[string]string{"id": "1"})
+			finish(nil)
+			return nil, nil
+		}),
+		rest.DecodeHandlerRequest,
+		rest.NopResponseEncoder,
+		tracer.HTTPServerTrace("/users/:id"),
+	)
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	load, ep, server := spans[0], spans[1], spans[2]
+	assert.Equal(t, "load user", load.Name())
+	assert.Equal(t, "1", spanAttributes(load)["id"].AsString())
+	assert.Equal(t, http.MethodGet, ep.Name(), "named by the method of the request")
+	assert.Equal(t, server.SpanContext().SpanID(), ep.Parent().SpanID())
+	assert.Equal(t, server.SpanContext().TraceID(), load.SpanContext().TraceID())
+}
@@ -0,0 +1,111 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// newExporter returns the span exporter of exporterType sending to url:
+//
+//	zipkin:   the URL of the Zipkin collector, e.g. http://zipkin:9411/api/v2/spans
+//	jaeger:   the URL of the Jaeger collector, e.g. http://jaeger:14268/api/traces
+//	otlphttp: the OTLP/HTTP endpoint, e.g. http://collector:4318/v1/traces
+//	otlpgrpc: the OTLP/gRPC endpoint, e.g. http://collector:4317
+//	stdout:   the file the spans are appended to, the standard output if empty
+//
+// The OTLP exporters use TLS unless the scheme of url is http; without url,
+// they use the endpoint of the OTEL_EXPORTER_OTLP_ environment variables.
+func newExporter(exporterType, url string) (sdktrace.SpanExporter, error) {
+	switch exporterType {
+	case OT_EXPORTER_ZIPKIN:
+		return zipkin.New(url)
+	case OT_EXPORTER_JAEGER:
+		return jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(url)))
+	case OT_EXPORTER_OTLP_HTTP:
+		host, path, insecure, err := otlpEndpoint(url)
+		if err != nil {
+			return nil, err
+		}
+		var options []otlptracehttp.Option
+		if host != "" {
+			options = append(options, otlptracehttp.WithEndpoint(host))
+		}
+		if path != "" {
+			options = append(options, otlptracehttp.WithURLPath(path))
+		}
+		if insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(context.Background(), options...)
+	case OT_EXPORTER_OTLP_GRPC:
+		host, _, insecure, err := otlpEndpoint(url)
+		if err != nil {
+			return nil, err
+		}
+		var options []otlptracegrpc.Option
+		if host != "" {
+			options = append(options, otlptracegrpc.WithEndpoint(host))
+		}
+		if insecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(context.Background(), options...)
+	case OT_EXPORTER_STDOUT:
+		return newStdoutExporter(url)
+	}
+	return nil, fmt.Errorf("unknown opentelemetry exporter type %q", exporterType)
+}
+
+// otlpEndpoint returns the host, the path and whether the connection is
+// insecure of rawurl, a URL or a host:port.
+func otlpEndpoint(rawurl string) (host, path string, insecure bool, err error) {
+	if !strings.Contains(rawurl, "://") {
+		return rawurl, "", false, nil
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", "", false, err
+	}
+	return u.Host, u.Path, u.Scheme == "http", nil
+}
+
+// fileExporter is a stdout exporter writing to a file, closed when the
+// exporter shuts down.
+type fileExporter struct {
+	*stdouttrace.Exporter
+	file *os.File
+}
+
+func newStdoutExporter(path string) (sdktrace.SpanExporter, error) {
+	if path == "" {
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	e, err := stdouttrace.New(stdouttrace.WithWriter(f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileExporter{Exporter: e, file: f}, nil
+}
+
+func (e *fileExporter) Shutdown(ctx context.Context) error {
+	err := e.Exporter.Shutdown(ctx)
+	if cerr := e.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
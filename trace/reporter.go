@@ -0,0 +1,73 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	_const "github.com/libra9z/mskit/v4/const"
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/openzipkin/zipkin-go/reporter"
+	rhttp "github.com/openzipkin/zipkin-go/reporter/http"
+	"github.com/openzipkin/zipkin-go/reporter/kafka"
+)
+
+// newReporter returns the span reporter of reporterType sending to url:
+//
+//	http:  the URL of the Zipkin collector, e.g. http://zipkin:9411/api/v2/spans
+//	kafka: the list of the Kafka brokers, e.g. kafka1:9092,kafka2:9092; the
+//	       spans are sent to the zipkin topic
+//	log:   the file the spans are appended to, a JSON span per line, the
+//	       standard output if empty
+//	noop:  none, the spans are dropped
+func newReporter(reporterType, url string) (reporter.Reporter, error) {
+	switch reporterType {
+	case ZIPKIN_REPORTER_TYPE_HTTP:
+		return rhttp.NewReporter(url), nil
+	case ZIPKIN_REPORTER_TYPE_KAFKA:
+		if url == "" {
+			return nil, fmt.Errorf("no kafka brokers")
+		}
+		return kafka.NewReporter(strings.Split(url, _const.ADDR_SPLIT_STRING))
+	case ZIPKIN_REPORTER_TYPE_LOG:
+		if url == "" {
+			return &logReporter{w: os.Stdout}, nil
+		}
+		f, err := os.OpenFile(url, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return &logReporter{w: f, closer: f}, nil
+	case ZIPKIN_REPORTER_TYPE_NOOP:
+		return reporter.NewNoopReporter(), nil
+	}
+	return nil, fmt.Errorf("unknown zipkin reporter type %q", reporterType)
+}
+
+// logReporter writes the spans to w, a JSON span per line, e.g. for an
+// offline ingestion.
+type logReporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer // the file written, if any
+}
+
+func (r *logReporter) Send(s model.SpanModel) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.w.Write(append(b, '\n'))
+}
+
+func (r *logReporter) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
@@ -0,0 +1,111 @@
+package trace
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/libra9z/mskit/v4/log"
+	"github.com/libra9z/mskit/v4/rest"
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newReporterTracer(t *testing.T, reporterType, url string) *zipkinTracer {
+	tracer, err := NewZipkinTracer(log.Mslog, "", "users", reporterType, url, "127.0.0.1:8081", nil, true, true, nil)
+	require.NoError(t, err)
+	return tracer.(*zipkinTracer)
+}
+
+func TestZipkinLogReporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.log")
+	tracer := newReporterTracer(t, ZIPKIN_REPORTER_TYPE_LOG, path)
+	for _, name := range []string{"load user", "save user"} {
+		_, finish := tracer.StartSpan(context.Background(), name, nil)
+		finish(nil)
+	}
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var span model.SpanModel
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &span), "a span per line")
+		assert.Equal(t, "users", span.LocalEndpoint.ServiceName)
+		names = append(names, span.Name)
+	}
+	assert.Equal(t, []string{"load user", "save user"}, names)
+}
+
+func TestZipkinLogReporterServerSpan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.log")
+	tracer := newReporterTracer(t, ZIPKIN_REPORTER_TYPE_LOG, path)
+	e := rest.NewHandlerEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), tracer.HTTPServerTrace("/users"))
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(t, lines, 1, "a span per request")
+	var span model.SpanModel
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &span))
+	assert.Equal(t, model.Server, span.Kind)
+}
+
+func TestZipkinKafkaReporter(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("zipkin", 0, broker.BrokerID()),
+		"ProduceRequest": sarama.NewMockProduceResponse(t).SetVersion(3),
+	})
+
+	tracer := newReporterTracer(t, ZIPKIN_REPORTER_TYPE_KAFKA, broker.Addr())
+	_, finish := tracer.StartSpan(context.Background(), "load user", nil)
+	finish(nil)
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	var produced int
+	for _, rr := range broker.History() {
+		if _, ok := rr.Request.(*sarama.ProduceRequest); ok {
+			produced++
+		}
+	}
+	assert.Equal(t, 1, produced)
+}
+
+func TestZipkinNoopReporter(t *testing.T) {
+	tracer := newReporterTracer(t, ZIPKIN_REPORTER_TYPE_NOOP, "")
+	md := map[string]string{}
+	_, finish := tracer.StartRPCClientSpan(context.Background(), "Users", "Get", md)
+	finish(nil)
+	assert.NotEmpty(t, md["x-b3-traceid"], "spans are still propagated")
+	assert.NoError(t, tracer.Shutdown(context.Background()))
+}
+
+func TestZipkinReporterErrors(t *testing.T) {
+	for _, tc := range []struct{ reporterType, url string }{
+		{"carrier-pigeon", ""},
+		{ZIPKIN_REPORTER_TYPE_KAFKA, ""},
+		{ZIPKIN_REPORTER_TYPE_LOG, filepath.Join(t.TempDir(), "missing", "spans.log")},
+	} {
+		_, err := NewZipkinTracer(log.Mslog, "", "users", tc.reporterType, tc.url, "", nil, true, true, nil)
+		assert.Error(t, err, tc.reporterType)
+	}
+	assert.Nil(t, NewTracer(WithTraceType(TRACER_TYPE_ZIPKIN), WithTraceLog(log.Mslog), WithReporterType("carrier-pigeon")))
+}
@@ -0,0 +1,86 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/libra9z/mskit/v4/log"
+	"github.com/openzipkin/zipkin-go"
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/openzipkin/zipkin-go/reporter/recorder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	otrace "go.opentelemetry.io/otel/trace"
+)
+
+func newRecordingZipkinTracer(t *testing.T) (*zipkinTracer, *recorder.ReporterRecorder) {
+	rec := recorder.NewReporter()
+	zt, err := zipkin.NewTracer(rec)
+	require.NoError(t, err)
+	return &zipkinTracer{
+		zipkinTracer:  zt,
+		logger:        log.Mslog,
+		Propagate:     true,
+		flushOnFinish: true,
+	}, rec
+}
+
+func TestOpentelemetryRPCSpans(t *testing.T) {
+	tracer, recorder := newRecordingTracer()
+
+	md := map[string]string{}
+	ctx, finish := tracer.StartRPCClientSpan(context.Background(), "Users", "Get", md)
+	client := otrace.SpanContextFromContext(ctx)
+	assert.NotEmpty(t, md["traceparent"])
+	assert.Contains(t, md["b3"], client.TraceID().String())
+
+	sctx, serverFinish := tracer.StartRPCServerSpan(context.Background(), "Users", "Get", md)
+	server := otrace.SpanContextFromContext(sctx)
+	assert.Equal(t, client.TraceID(), server.TraceID())
+	serverFinish(errors.New("no such user"))
+	finish(nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, otrace.SpanKindServer, spans[0].SpanKind())
+	assert.Equal(t, client.SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, "Users/Get", spans[1].Name())
+	assert.Equal(t, otrace.SpanKindClient, spans[1].SpanKind())
+	assert.Equal(t, codes.Unset, spans[1].Status().Code)
+}
+
+func TestRPCSpansAcrossTracers(t *testing.T) {
+	otel, otelSpans := newRecordingTracer()
+	zt, zipkinSpans := newRecordingZipkinTracer(t)
+
+	// zipkin client, opentelemetry server
+	md := map[string]string{}
+	_, finish := zt.StartRPCClientSpan(context.Background(), "Users", "Get", md)
+	sctx, serverFinish := otel.StartRPCServerSpan(context.Background(), "Users", "Get", md)
+	serverFinish(nil)
+	finish(nil)
+
+	client := zipkinSpans.Flush()
+	require.Len(t, client, 1)
+	assert.Equal(t, model.Client, client[0].Kind)
+	server := otrace.SpanContextFromContext(sctx)
+	assert.Equal(t, client[0].TraceID.String(), server.TraceID().String()[16:])
+	assert.Equal(t, client[0].ID.String(), otelSpans.Ended()[0].Parent().SpanID().String())
+
+	// opentelemetry client, zipkin server
+	md = map[string]string{}
+	ctx, finish := otel.StartRPCClientSpan(context.Background(), "Orders", "List", md)
+	_, serverFinish = zt.StartRPCServerSpan(context.Background(), "Orders", "List", md)
+	serverFinish(errors.New("timeout"))
+	finish(nil)
+
+	spans := zipkinSpans.Flush()
+	require.Len(t, spans, 1)
+	assert.Equal(t, model.Server, spans[0].Kind)
+	assert.Equal(t, otrace.SpanContextFromContext(ctx).TraceID().String(), spans[0].TraceID.String())
+	assert.Equal(t, "timeout", spans[0].Tags["error"])
+	assert.Equal(t, "Orders", spans[0].Tags["rpc.service"])
+}
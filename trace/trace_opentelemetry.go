@@ -4,20 +4,26 @@ import (
 	"context"
 	"github.com/libra9z/mskit/v4/log"
 	"github.com/libra9z/mskit/v4/rest"
+	"go.opentelemetry.io/contrib/propagators/b3"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/jaeger"
-	"go.opentelemetry.io/otel/exporters/zipkin"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
 	otrace "go.opentelemetry.io/otel/trace"
+	"net"
 	"net/http"
+	"os"
 )
 
 const (
-	OT_EXPORTER_ZIPKIN = "zipkin"
-	OT_EXPORTER_JAEGER = "jaeger"
+	OT_EXPORTER_ZIPKIN    = "zipkin"
+	OT_EXPORTER_JAEGER    = "jaeger"
+	OT_EXPORTER_OTLP_HTTP = "otlphttp"
+	OT_EXPORTER_OTLP_GRPC = "otlpgrpc"
+	OT_EXPORTER_STDOUT    = "stdout"
 )
 
 type openTelemetry struct {
@@ -26,6 +32,7 @@ type openTelemetry struct {
 	logger        log.Logger
 	flushOnFinish bool
 	tp            *sdktrace.TracerProvider
+	propagator    propagation.TextMapPropagator
 
 	Tags           map[string]string
 	Propagate      bool
@@ -37,7 +44,33 @@ type openTelemetry struct {
 
 var _ Tracer = (*openTelemetry)(nil)
 
+func init() {
+	rest.RegisterTraceIDFunc(func(ctx context.Context) string {
+		if sc := otrace.SpanContextFromContext(ctx); sc.HasTraceID() {
+			return sc.TraceID().String()
+		}
+		return ""
+	})
+}
+
+// DefaultEnvironment is the deployment environment of the tracers which
+// set none.
+const DefaultEnvironment = "production"
+
+// providerConfig is the configuration of the tracer provider of an
+// openTelemetry tracer, besides its exporter type and URL.
+type providerConfig struct {
+	version     string
+	environment string
+	sampler     sdktrace.Sampler
+	exporter    sdktrace.SpanExporter
+}
+
 func NewOpentelemetryTracer(logger log.Logger, name, servicename, exportertype, exporterurl, address string, tags map[string]string, Propagate, flushOnFinish bool, RequestSampler func(r *http.Request) bool) (Tracer, error) {
+	return newOpentelemetryTracer(logger, name, servicename, exportertype, exporterurl, address, tags, Propagate, flushOnFinish, RequestSampler, providerConfig{})
+}
+
+func newOpentelemetryTracer(logger log.Logger, name, servicename, exportertype, exporterurl, address string, tags map[string]string, Propagate, flushOnFinish bool, RequestSampler func(r *http.Request) bool, config providerConfig) (Tracer, error) {
 	o := &openTelemetry{
 		logger:         logger,
 		Name:           name,
@@ -49,57 +82,81 @@ func NewOpentelemetryTracer(logger log.Logger, name, servicename, exportertype,
 		Propagate:      Propagate,
 		flushOnFinish:  flushOnFinish,
 		RequestSampler: RequestSampler,
+		propagator:     newPropagator(),
 	}
 	var err error
-	o.tp, err = tracerProvider(o.exporterType, o.exporterUrl, o.ServiceName, "production")
+	o.tp, err = tracerProvider(o.exporterType, o.exporterUrl, o.ServiceName, o.Tags, config)
 	if err != nil {
-		logger.Error("exporter=connnection error.")
+		logger.Error("exporter=%s,error=%v", o.exporterType, err)
 		return nil, err
 	}
 	otel.SetTracerProvider(o.tp)
+	otel.SetTextMapPropagator(o.propagator)
 	return o, nil
 }
 
-func tracerProvider(exporterType, url, service, env string) (*sdktrace.TracerProvider, error) {
-
-	var tp *sdktrace.TracerProvider
+// newPropagator returns the propagator of the W3C trace context and
+// baggage and of the B3 headers, single or multiple, extracting any of them
+// and injecting all.
+func newPropagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}, b3.New(),
+	)
+}
 
-	switch exporterType {
-	case OT_EXPORTER_ZIPKIN:
-		//logg := olog.New(os.Stderr, "[zipkin-exporter]: ", olog.Ldate|olog.Ltime|olog.Lmsgprefix)
-		exporter, err := zipkin.New(url)
-		//exporter, err := zipkin.New(url, zipkin.WithLogger(logg))
-		if err != nil {
-			return nil, err
-		}
-		batcher := sdktrace.NewBatchSpanProcessor(exporter)
-
-		tp = sdktrace.NewTracerProvider(
-			sdktrace.WithSpanProcessor(batcher),
-			sdktrace.WithResource(resource.NewWithAttributes(
-				semconv.SchemaURL,
-				semconv.ServiceNameKey.String(service),
-			)),
-		)
-	case OT_EXPORTER_JAEGER:
-		// Create the Jaeger exporter
-		exp, err := jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(url)))
+// tracerProvider returns the provider of the tracers of service, exporting
+// its spans in batches to the exporter of exporterType at url, or as they
+// end to the exporter of config if set. Its resource has the name, the
+// version and the environment of the service, the host name and the tags.
+func tracerProvider(exporterType, url, service string, tags map[string]string, config providerConfig) (*sdktrace.TracerProvider, error) {
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			resourceAttributes(service, tags, config)...,
+		)),
+	}
+	if config.sampler != nil {
+		options = append(options, sdktrace.WithSampler(config.sampler))
+	}
+	if config.exporter != nil {
+		options = append(options, sdktrace.WithSyncer(config.exporter))
+	} else {
+		exporter, err := newExporter(exporterType, url)
 		if err != nil {
 			return nil, err
 		}
-		tp = sdktrace.NewTracerProvider(
-			// Always be sure to batch in production.
-			sdktrace.WithBatcher(exp),
-			// Record information about this application in a Resource.
-			sdktrace.WithResource(resource.NewWithAttributes(
-				semconv.SchemaURL,
-				semconv.ServiceNameKey.String(service),
-				attribute.String("environment", env),
-			)),
-		)
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+	return sdktrace.NewTracerProvider(options...), nil
+}
+
+func resourceAttributes(service string, tags map[string]string, config providerConfig) []attribute.KeyValue {
+	env := config.environment
+	if env == "" {
+		env = DefaultEnvironment
+	}
+	attrs := []attribute.KeyValue{
+		semconv.ServiceNameKey.String(service),
+		semconv.DeploymentEnvironmentKey.String(env),
 	}
+	if config.version != "" {
+		attrs = append(attrs, semconv.ServiceVersionKey.String(config.version))
+	}
+	if host, err := os.Hostname(); err == nil {
+		attrs = append(attrs, semconv.HostNameKey.String(host))
+	}
+	for k, v := range tags {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+	return attrs
+}
 
-	return tp, nil
+// Shutdown flushes the spans still buffered and stops the exporter.
+func (t *openTelemetry) Shutdown(ctx context.Context) error {
+	if t.tp == nil {
+		return nil
+	}
+	return t.tp.Shutdown(ctx)
 }
 
 func (t *openTelemetry) GetServiceName() string {
@@ -114,9 +171,17 @@ func (t *openTelemetry) GetTracer() (string, interface{}) {
 	return TRACER_TYPE_OPENTELEMETRY, t.tp.Tracer(t.Name)
 }
 
-func (t *openTelemetry) HTTPServerTrace(operatename string) rest.ServerOption {
+// serverSpanKey is the context key of the span of a request started by
+// HTTPServerTrace, ended by its finalizer.
+type serverSpanKey struct{}
 
-	var span otrace.Span
+// HTTPServerTrace returns the options of a rest.Engine recording a server
+// span for every request, stored in its context. Unless propagation is
+// disabled, the span is the child of the remote span extracted from the
+// W3C traceparent or B3 headers of the request, and the W3C baggage is
+// extracted too. The span ends in the finalizer, with the status of the
+// response and the error of the request, if any.
+func (t *openTelemetry) HTTPServerTrace(operatename string) rest.ServerOption {
 
 	serverBefore := rest.ServerBefore(
 		func(c *rest.Mcontext, w http.ResponseWriter) error {
@@ -128,21 +193,44 @@ func (t *openTelemetry) HTTPServerTrace(operatename string) rest.ServerOption {
 				name = operatename
 			}
 
-			tr := t.tp.Tracer(t.Name)
-			c.Ctx, span = tr.Start(c.Ctx, name, otrace.WithSpanKind(otrace.SpanKindServer))
-			return nil
-		},
-	)
+			ctx := c.Ctx
+			if t.Propagate {
+				ctx = t.propagator.Extract(ctx, propagation.HeaderCarrier(c.Request.Header))
+			}
 
-	serverAfter := rest.ServerAfter(
-		func(c *rest.Mcontext, _ http.ResponseWriter) error {
-			span.End()
+			attrs := semconv.HTTPServerAttributesFromHTTPRequest(t.ServiceName, operatename, c.Request)
+			if ip := clientIP(c.RemoteAddr); ip != "" {
+				attrs = append(attrs, semconv.HTTPClientIPKey.String(ip))
+			}
+
+			ctx, span := t.tp.Tracer(t.Name).Start(ctx, name,
+				otrace.WithSpanKind(otrace.SpanKindServer),
+				otrace.WithAttributes(attrs...),
+			)
+			c.Ctx = withTracer(context.WithValue(ctx, serverSpanKey{}, span), t)
 			return nil
 		},
 	)
 
 	serverFinalizer := rest.ServerFinalizer(
 		func(ctx context.Context, code int, r *http.Request) {
+			span, ok := ctx.Value(serverSpanKey{}).(otrace.Span)
+			if !ok {
+				return
+			}
+			span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(code)...)
+			if rs, ok := ctx.Value(rest.ContextKeyResponseSize).(int64); ok {
+				span.SetAttributes(semconv.HTTPResponseContentLengthKey.Int64(rs))
+			}
+			span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(code, otrace.SpanKindServer))
+			if err, ok := ctx.Value(rest.ContextKeyResponseError).(error); ok {
+				span.RecordError(err)
+				if code > 499 {
+					span.SetStatus(codes.Error, err.Error())
+				}
+			}
+			span.End()
+
 			if t.flushOnFinish {
 				t.tp.ForceFlush(ctx)
 			}
@@ -151,7 +239,127 @@ func (t *openTelemetry) HTTPServerTrace(operatename string) rest.ServerOption {
 
 	return func(s *rest.Engine) {
 		serverBefore(s)
-		serverAfter(s)
 		serverFinalizer(s)
 	}
 }
+
+// clientIP returns the IP of addr, a host with an optional port, or "" if
+// it is not one.
+func clientIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// HTTPClientTrace returns the option of a rest.Client recording a client
+// span for every request it sends, with the span of the context as parent.
+// The span is propagated in W3C traceparent and B3 headers, with the W3C
+// baggage, unless propagation is disabled.
+func (t *openTelemetry) HTTPClientTrace(operatename string) rest.ClientOption {
+	name := operatename
+	if name == "" {
+		name = t.Name
+	}
+
+	clientBefore := rest.ClientBefore(
+		func(ctx context.Context, r *http.Request) context.Context {
+			ctx, _ = t.tp.Tracer(t.Name).Start(ctx, name,
+				otrace.WithSpanKind(otrace.SpanKindClient),
+				otrace.WithAttributes(
+					semconv.HTTPMethodKey.String(r.Method),
+					semconv.HTTPURLKey.String(r.URL.String()),
+				),
+			)
+			if t.Propagate {
+				t.propagator.Inject(ctx, propagation.HeaderCarrier(r.Header))
+			}
+			return ctx
+		},
+	)
+
+	clientAfter := rest.ClientAfter(
+		func(ctx context.Context, r *http.Response) context.Context {
+			span := otrace.SpanFromContext(ctx)
+			span.SetAttributes(semconv.HTTPStatusCodeKey.Int(r.StatusCode))
+			if r.StatusCode > 399 {
+				span.SetStatus(codes.Error, http.StatusText(r.StatusCode))
+			}
+			return ctx
+		},
+	)
+
+	clientFinalizer := rest.ClientFinalizer(
+		func(ctx context.Context, err error) {
+			span := otrace.SpanFromContext(ctx)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		},
+	)
+
+	return func(c *rest.Client) {
+		clientBefore(c)
+		clientAfter(c)
+		clientFinalizer(c)
+	}
+}
+
+// StartRPCClientSpan starts the client span of a call, see Tracer. The span
+// is propagated in W3C traceparent and B3 metadata, with the W3C baggage.
+func (t *openTelemetry) StartRPCClientSpan(ctx context.Context, service, method string, md map[string]string) (context.Context, func(error)) {
+	ctx, span := t.tp.Tracer(t.Name).Start(ctx, service+"/"+method,
+		otrace.WithSpanKind(otrace.SpanKindClient),
+		otrace.WithAttributes(rpcAttributes(service, method)...),
+	)
+	if t.Propagate {
+		t.propagator.Inject(ctx, propagation.MapCarrier(md))
+	}
+	return ctx, finishSpan(span)
+}
+
+// StartRPCServerSpan starts the server span of a call, see Tracer. The
+// remote span is extracted from W3C traceparent or B3 metadata.
+func (t *openTelemetry) StartRPCServerSpan(ctx context.Context, service, method string, md map[string]string) (context.Context, func(error)) {
+	if t.Propagate {
+		ctx = t.propagator.Extract(ctx, propagation.MapCarrier(md))
+	}
+	ctx, span := t.tp.Tracer(t.Name).Start(ctx, service+"/"+method,
+		otrace.WithSpanKind(otrace.SpanKindServer),
+		otrace.WithAttributes(rpcAttributes(service, method)...),
+	)
+	return withTracer(ctx, t), finishSpan(span)
+}
+
+// StartSpan starts an internal span, see Tracer.
+func (t *openTelemetry) StartSpan(ctx context.Context, name string, tags map[string]string) (context.Context, func(error)) {
+	attrs := make([]attribute.KeyValue, 0, len(tags))
+	for k, v := range tags {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+	ctx, span := t.tp.Tracer(t.Name).Start(ctx, name, otrace.WithAttributes(attrs...))
+	return withTracer(ctx, t), finishSpan(span)
+}
+
+func finishSpan(span otrace.Span) func(error) {
+	return func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+func rpcAttributes(service, method string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.RPCSystemKey.String("rpcx"),
+		semconv.RPCServiceKey.String(service),
+		semconv.RPCMethodKey.String(method),
+	}
+}
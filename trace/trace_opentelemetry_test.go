@@ -0,0 +1,193 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/libra9z/mskit/v4/log"
+	"github.com/libra9z/mskit/v4/rest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	otrace "go.opentelemetry.io/otel/trace"
+)
+
+func newRecordingTracer() (*openTelemetry, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	return &openTelemetry{
+		logger:      log.Mslog,
+		ServiceName: "users",
+		Propagate:   true,
+		tp:          sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+		propagator:  newPropagator(),
+	}, recorder
+}
+
+func spanAttributes(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range s.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestOpentelemetryServerTraceConcurrent(t *testing.T) {
+	tracer, recorder := newRecordingTracer()
+	e := rest.NewHandlerEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := otrace.SpanFromContext(r.Context())
+		fmt.Fprint(w, span.SpanContext().SpanID())
+	}), tracer.HTTPServerTrace("/users/:id"))
+
+	const n = 20
+	parents := make(map[string]string, n) // by span ID
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			traceID := fmt.Sprintf("%032x", i+1)
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			if i%2 == 0 {
+				req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+			} else {
+				req.Header.Set("b3", traceID+"-00f067aa0ba902b7-1")
+			}
+			req.Header.Set("X-Real-IP", "10.0.0.1")
+			w := httptest.NewRecorder()
+			e.ServeHTTP(w, req)
+			mu.Lock()
+			parents[w.Body.String()] = traceID
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, n, "every span is ended once")
+	for _, s := range spans {
+		assert.Equal(t, parents[s.SpanContext().SpanID().String()], s.SpanContext().TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", s.Parent().SpanID().String())
+		assert.True(t, s.Parent().IsRemote())
+		assert.Equal(t, otrace.SpanKindServer, s.SpanKind())
+
+		attrs := spanAttributes(s)
+		assert.Equal(t, "/users/:id", attrs["http.route"].AsString())
+		assert.Equal(t, int64(http.StatusOK), attrs["http.status_code"].AsInt64())
+		assert.Equal(t, int64(16), attrs["http.response_content_length"].AsInt64())
+		assert.Equal(t, "10.0.0.1", attrs["http.client_ip"].AsString())
+	}
+}
+
+func TestOpentelemetryServerTraceError(t *testing.T) {
+	tracer, recorder := newRecordingTracer()
+	tracer.Propagate = false
+	e := rest.NewEngine(
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			return nil, fmt.Errorf("database down")
+		},
+		rest.DecodeHandlerRequest,
+		rest.EncodeJSONResponse,
+		tracer.HTTPServerTrace("/users"),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	s := spans[0]
+	assert.False(t, s.Parent().IsValid(), "not propagated")
+	assert.Equal(t, codes.Error, s.Status().Code)
+	assert.Equal(t, "database down", s.Status().Description)
+	require.Len(t, s.Events(), 1)
+	assert.Equal(t, "exception", s.Events()[0].Name)
+}
+
+func serveTraced(tracer Tracer, header http.Header) {
+	e := rest.NewHandlerEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), tracer.HTTPServerTrace("/users"))
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	e.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestNewTracerSampling(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := NewTracer(
+		WithTraceType(TRACER_TYPE_OPENTELEMETRY),
+		WithServiceNameOption("users"),
+		WithServiceVersion("1.2.0"),
+		WithEnvironment("staging"),
+		WithTraceTags(map[string]string{"team": "core"}),
+		WithTraceLog(log.Mslog),
+		WithAllowPropagation(true),
+		WithSampleRatio(0),
+		WithSpanExporter(exporter),
+	)
+	require.NotNil(t, tracer)
+
+	serveTraced(tracer, nil)
+	assert.Empty(t, exporter.GetSpans(), "root spans are not sampled")
+
+	serveTraced(tracer, http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}})
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1, "the sampled parent is followed")
+	attrs := make(map[attribute.Key]string)
+	for _, kv := range spans[0].Resource.Attributes() {
+		attrs[kv.Key] = kv.Value.Emit()
+	}
+	assert.Equal(t, "users", attrs["service.name"])
+	assert.Equal(t, "1.2.0", attrs["service.version"])
+	assert.Equal(t, "staging", attrs["deployment.environment"])
+	assert.Equal(t, "core", attrs["team"])
+	assert.NotEmpty(t, attrs["host.name"])
+}
+
+func TestNewTracerStdoutExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	tracer := NewTracer(
+		WithTraceType(TRACER_TYPE_OPENTELEMETRY),
+		WithTraceName("users-api"),
+		WithServiceNameOption("users"),
+		WithTraceLog(log.Mslog),
+		WithExporterType(OT_EXPORTER_STDOUT),
+		WithExporterURL(path),
+	)
+	require.NotNil(t, tracer)
+	serveTraced(tracer, nil)
+	require.NoError(t, tracer.(interface{ Shutdown(context.Context) error }).Shutdown(context.Background()))
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"Name":"users-api"`)
+}
+
+func TestNewTracerUnknownExporter(t *testing.T) {
+	assert.Nil(t, NewTracer(WithTraceType(TRACER_TYPE_OPENTELEMETRY), WithTraceLog(log.Mslog), WithExporterType("carrier-pigeon")))
+}
+
+func TestOtlpEndpoint(t *testing.T) {
+	host, path, insecure, err := otlpEndpoint("http://collector:4318/v1/traces")
+	require.NoError(t, err)
+	assert.Equal(t, "collector:4318", host)
+	assert.Equal(t, "/v1/traces", path)
+	assert.True(t, insecure)
+
+	host, path, insecure, err = otlpEndpoint("collector:4317")
+	require.NoError(t, err)
+	assert.Equal(t, "collector:4317", host)
+	assert.Empty(t, path)
+	assert.False(t, insecure)
+}
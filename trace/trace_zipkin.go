@@ -2,7 +2,6 @@ package trace
 
 import (
 	"context"
-	"errors"
 	"github.com/libra9z/mskit/v4/log"
 	"github.com/libra9z/mskit/v4/rest"
 	"github.com/opentracing/opentracing-go"
@@ -11,9 +10,8 @@ import (
 	"github.com/openzipkin/zipkin-go/model"
 	"github.com/openzipkin/zipkin-go/propagation/b3"
 	"github.com/openzipkin/zipkin-go/reporter"
-	rhttp "github.com/openzipkin/zipkin-go/reporter/http"
+	"net"
 	"net/http"
-	"os"
 	"strconv"
 )
 
@@ -21,13 +19,24 @@ const (
 	ZIPKIN_REPORTER_TYPE_HTTP  = "http"
 	ZIPKIN_REPORTER_TYPE_KAFKA = "kafka"
 	ZIPKIN_REPORTER_TYPE_LOG   = "log"
+	ZIPKIN_REPORTER_TYPE_NOOP  = "noop"
 )
 
 var _ Tracer = (*zipkinTracer)(nil)
 
+func init() {
+	rest.RegisterTraceIDFunc(func(ctx context.Context) string {
+		if span := zipkin.SpanFromContext(ctx); span != nil {
+			return span.Context().TraceID.String()
+		}
+		return ""
+	})
+}
+
 type zipkinTracer struct {
 	zipkinTracer  *zipkin.Tracer
 	zkTracer      opentracing.Tracer
+	reporter      reporter.Reporter
 	Name          string
 	ServiceName   string
 	logger        log.Logger
@@ -58,29 +67,35 @@ func NewZipkinTracer(log log.Logger, name, servicename, reportertype, reporturl,
 	if zt.reporterType == "" {
 		zt.reporterType = ZIPKIN_REPORTER_TYPE_HTTP
 	}
-	var reporter reporter.Reporter
 	var err error
-	switch zt.reporterType {
-	case ZIPKIN_REPORTER_TYPE_HTTP:
-		reporter = rhttp.NewReporter(zt.reportUrl)
-		if reporter == nil {
-			return nil, errors.New("cannot creater a new zipkin reporter")
-		}
-
+	if zt.reporter, err = newReporter(zt.reporterType, zt.reportUrl); err != nil {
+		return nil, err
 	}
 	ep, err := zipkin.NewEndpoint(zt.ServiceName, zt.address)
+	if err != nil {
+		zt.reporter.Close()
+		return nil, err
+	}
 	zt.zipkinTracer, err = zipkin.NewTracer(
-		reporter, zipkin.WithLocalEndpoint(ep), //zipkin.WithSharedSpans(true), zipkin.WithNoopTracer(useNoopTracer),
+		zt.reporter, zipkin.WithLocalEndpoint(ep), //zipkin.WithSharedSpans(true), zipkin.WithNoopTracer(useNoopTracer),
 	)
 	if err != nil {
-		zt.logger.Error("error=%v", err)
-		os.Exit(1)
+		zt.reporter.Close()
+		return nil, err
 	}
 	zt.zkTracer = zkOt.Wrap(zt.zipkinTracer)
 	opentracing.SetGlobalTracer(zt.zkTracer)
 	return zt, nil
 }
 
+// Shutdown flushes the spans still buffered and closes the reporter.
+func (t *zipkinTracer) Shutdown(ctx context.Context) error {
+	if t.reporter == nil {
+		return nil
+	}
+	return t.reporter.Close()
+}
+
 func (t *zipkinTracer) GetServiceName() string {
 	return t.ServiceName
 }
@@ -133,7 +148,7 @@ func (t *zipkinTracer) HTTPServerTrace(operatename string) rest.ServerOption {
 				zipkin.FlushOnFinish(t.flushOnFinish),
 			)
 
-			c.Ctx = zipkin.NewContext(c.Ctx, span)
+			c.Ctx = withTracer(zipkin.NewContext(c.Ctx, span), t)
 			return nil
 		},
 	)
@@ -164,8 +179,10 @@ func (t *zipkinTracer) HTTPServerTrace(operatename string) rest.ServerOption {
 				// ServerAfter we can at least time the early bail out by calling it
 				// here.
 				span.Finish()
-				// send span to the Reporter
-				span.Flush()
+				if !t.flushOnFinish {
+					// send span to the Reporter
+					span.Flush()
+				}
 			}
 		},
 	)
@@ -176,3 +193,153 @@ func (t *zipkinTracer) HTTPServerTrace(operatename string) rest.ServerOption {
 		serverFinalizer(s)
 	}
 }
+
+// HTTPClientTrace returns the option of a rest.Client recording a client
+// span for every request it sends, with the span of the context as parent.
+// The span is propagated in B3 headers unless propagation is disabled.
+func (t *zipkinTracer) HTTPClientTrace(operatename string) rest.ClientOption {
+	name := operatename
+	if name == "" {
+		name = t.Name
+	}
+
+	clientBefore := rest.ClientBefore(
+		func(ctx context.Context, r *http.Request) context.Context {
+			span, ctx := t.zipkinTracer.StartSpanFromContext(
+				ctx,
+				name,
+				zipkin.Kind(model.Client),
+				zipkin.Tags(t.Tags),
+				zipkin.Tags(map[string]string{
+					string(zipkin.TagHTTPMethod): r.Method,
+					string(zipkin.TagHTTPUrl):    r.URL.String(),
+				}),
+				zipkin.RemoteEndpoint(remoteEndpoint(r.URL.Host)),
+				zipkin.FlushOnFinish(t.flushOnFinish),
+			)
+			if t.Propagate {
+				if err := b3.InjectHTTP(r)(span.Context()); err != nil {
+					t.logger.Error("error=%v", err)
+				}
+			}
+			return ctx
+		},
+	)
+
+	clientAfter := rest.ClientAfter(
+		func(ctx context.Context, r *http.Response) context.Context {
+			if span := zipkin.SpanFromContext(ctx); span != nil {
+				zipkin.TagHTTPStatusCode.Set(span, strconv.Itoa(r.StatusCode))
+				if r.StatusCode > 399 {
+					zipkin.TagError.Set(span, http.StatusText(r.StatusCode))
+				}
+			}
+			return ctx
+		},
+	)
+
+	clientFinalizer := rest.ClientFinalizer(
+		func(ctx context.Context, err error) {
+			if span := zipkin.SpanFromContext(ctx); span != nil {
+				if err != nil {
+					zipkin.TagError.Set(span, err.Error())
+				}
+				span.Finish()
+				if !t.flushOnFinish {
+					span.Flush()
+				}
+			}
+		},
+	)
+
+	return func(c *rest.Client) {
+		clientBefore(c)
+		clientAfter(c)
+		clientFinalizer(c)
+	}
+}
+
+// StartRPCClientSpan starts the client span of a call, see Tracer. The span
+// is propagated in B3 metadata.
+func (t *zipkinTracer) StartRPCClientSpan(ctx context.Context, service, method string, md map[string]string) (context.Context, func(error)) {
+	span, ctx := t.zipkinTracer.StartSpanFromContext(
+		ctx,
+		service+"/"+method,
+		zipkin.Kind(model.Client),
+		zipkin.Tags(t.Tags),
+		zipkin.Tags(rpcTags(service, method)),
+		zipkin.FlushOnFinish(t.flushOnFinish),
+	)
+	if t.Propagate {
+		m := b3.Map(md)
+		if err := m.Inject()(span.Context()); err != nil {
+			t.logger.Error("error=%v", err)
+		}
+	}
+	return ctx, finishZipkinSpan(span)
+}
+
+// StartRPCServerSpan starts the server span of a call, see Tracer. The
+// remote span is extracted from B3 metadata.
+func (t *zipkinTracer) StartRPCServerSpan(ctx context.Context, service, method string, md map[string]string) (context.Context, func(error)) {
+	var spanContext model.SpanContext
+	if t.Propagate {
+		m := b3.Map(md)
+		spanContext = t.zipkinTracer.Extract(m.Extract)
+		if spanContext.Err != nil {
+			t.logger.Error("error=%v", spanContext.Err)
+		}
+	}
+	span := t.zipkinTracer.StartSpan(
+		service+"/"+method,
+		zipkin.Kind(model.Server),
+		zipkin.Tags(t.Tags),
+		zipkin.Tags(rpcTags(service, method)),
+		zipkin.Parent(spanContext),
+		zipkin.FlushOnFinish(t.flushOnFinish),
+	)
+	return withTracer(zipkin.NewContext(ctx, span), t), finishZipkinSpan(span)
+}
+
+// StartSpan starts a span, see Tracer.
+func (t *zipkinTracer) StartSpan(ctx context.Context, name string, tags map[string]string) (context.Context, func(error)) {
+	span, ctx := t.zipkinTracer.StartSpanFromContext(
+		ctx,
+		name,
+		zipkin.Tags(t.Tags),
+		zipkin.Tags(tags),
+		zipkin.FlushOnFinish(t.flushOnFinish),
+	)
+	return withTracer(ctx, t), finishZipkinSpan(span)
+}
+
+func finishZipkinSpan(span zipkin.Span) func(error) {
+	return func(err error) {
+		if err != nil {
+			zipkin.TagError.Set(span, err.Error())
+		}
+		span.Finish()
+	}
+}
+
+func rpcTags(service, method string) map[string]string {
+	return map[string]string{
+		"rpc.system":  "rpcx",
+		"rpc.service": service,
+		"rpc.method":  method,
+	}
+}
+
+// remoteEndpoint returns the endpoint of the instance at hostport, or nil
+// if it is not an IP address: names are not looked up on every request.
+func remoteEndpoint(hostport string) *model.Endpoint {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil || net.ParseIP(host) == nil {
+		return nil
+	}
+	ep, err := zipkin.NewEndpoint("", hostport)
+	if err != nil {
+		return nil
+	}
+	return ep
+}
@@ -0,0 +1,35 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/libra9z/mskit/v4/log"
+	"github.com/libra9z/mskit/v4/rest"
+	"github.com/openzipkin/zipkin-go"
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/openzipkin/zipkin-go/reporter/recorder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZipkinHTTPClientSpan(t *testing.T) {
+	rec := recorder.NewReporter()
+	zt, err := zipkin.NewTracer(rec)
+	require.NoError(t, err)
+	tracer := &zipkinTracer{zipkinTracer: zt, logger: log.Mslog, Propagate: true, flushOnFinish: true}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+	c := rest.NewClient(http.MethodGet, "/users", rest.FixedInstancer(strings.TrimPrefix(s.URL, "http://")), nil, tracer.HTTPClientTrace("get users"))
+	_, err = c.Endpoint()(context.Background(), nil)
+	require.NoError(t, err)
+
+	spans := rec.Flush()
+	require.Len(t, spans, 1, "a span per call")
+	assert.Equal(t, model.Client, spans[0].Kind)
+	assert.Equal(t, "get users", spans[0].Name)
+}
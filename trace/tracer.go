@@ -1,8 +1,11 @@
 package trace
 
 import (
+	"context"
+	"fmt"
 	"github.com/libra9z/mskit/v4/log"
 	"github.com/libra9z/mskit/v4/rest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"net/http"
 )
 
@@ -17,6 +20,45 @@ type Tracer interface {
 	GetTraceName() string
 	GetTracer() (string, interface{})
 	HTTPServerTrace(operatename string) rest.ServerOption
+	HTTPClientTrace(operatename string) rest.ClientOption
+	// StartRPCClientSpan starts the client span of a call of method of
+	// service, a child of the span of ctx, and injects its context into md,
+	// the metadata sent with the call, unless propagation is disabled.
+	// finish ends the span with the error of the call.
+	StartRPCClientSpan(ctx context.Context, service, method string, md map[string]string) (_ context.Context, finish func(err error))
+	// StartRPCServerSpan starts the server span of a call of method of
+	// service received with md, a child of the span extracted from md unless
+	// propagation is disabled. finish ends the span with the error of the
+	// call.
+	StartRPCServerSpan(ctx context.Context, service, method string, md map[string]string) (_ context.Context, finish func(err error))
+	// StartSpan starts a span of name with tags, a child of the span of ctx
+	// if any. finish ends the span with the error of the operation.
+	StartSpan(ctx context.Context, name string, tags map[string]string) (_ context.Context, finish func(err error))
+}
+
+// tracerKey is the context key of the Tracer of the spans of a context.
+type tracerKey struct{}
+
+// withTracer returns ctx carrying t, the tracer of its span, for
+// StartSpanFromContext.
+func withTracer(ctx context.Context, t Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// StartSpanFromContext starts a span of name with tags, a child of the
+// span of ctx, with the tracer which started it, e.g. in a handler from the
+// Ctx of its Mcontext:
+//
+//	ctx, finish := trace.StartSpanFromContext(c.Ctx, "load user", nil)
+//	defer func() { finish(err) }()
+//
+// If ctx carries no span of a Tracer, it returns ctx and finish does
+// nothing.
+func StartSpanFromContext(ctx context.Context, name string, tags map[string]string) (_ context.Context, finish func(err error)) {
+	if t, ok := ctx.Value(tracerKey{}).(Tracer); ok {
+		return t.StartSpan(ctx, name, tags)
+	}
+	return ctx, func(error) {}
 }
 
 type trace struct {
@@ -36,6 +78,7 @@ type trace struct {
 	exporterUrl  string
 	address      string //微服务监听的地址和端口号 例如: 192.168.0.9:7811
 
+	provider providerConfig
 }
 
 type TraceOption func(*trace)
@@ -83,6 +126,34 @@ func WithAddress(address string) TraceOption {
 	return func(t *trace) { t.address = address }
 }
 
+// WithServiceVersion sets the service.version resource attribute of an
+// opentelemetry tracer.
+func WithServiceVersion(version string) TraceOption {
+	return func(t *trace) { t.provider.version = version }
+}
+
+// WithEnvironment sets the deployment.environment resource attribute of an
+// opentelemetry tracer, DefaultEnvironment by default.
+func WithEnvironment(env string) TraceOption {
+	return func(t *trace) { t.provider.environment = env }
+}
+
+// WithSampleRatio makes an opentelemetry tracer sample ratio, from 0 to 1,
+// of the traces it starts, following the decision of the parent span for
+// the others, e.g. the remote span of a request. All are sampled by default.
+func WithSampleRatio(ratio float64) TraceOption {
+	return func(t *trace) {
+		t.provider.sampler = sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))
+	}
+}
+
+// WithSpanExporter makes an opentelemetry tracer export its spans to
+// exporter as they end, instead of the exporter of WithExporterType, e.g. to
+// a tracetest.InMemoryExporter in tests.
+func WithSpanExporter(exporter sdktrace.SpanExporter) TraceOption {
+	return func(t *trace) { t.provider.exporter = exporter }
+}
+
 func (t *trace) GetServiceName() string {
 	return t.ServiceName
 }
@@ -92,11 +163,54 @@ func (t *trace) GetTraceName() string {
 func (t *trace) HTTPServerTrace(operatename string) rest.ServerOption {
 	return t.tracer.HTTPServerTrace(operatename)
 }
+func (t *trace) HTTPClientTrace(operatename string) rest.ClientOption {
+	return t.tracer.HTTPClientTrace(operatename)
+}
+func (t *trace) StartRPCClientSpan(ctx context.Context, service, method string, md map[string]string) (context.Context, func(error)) {
+	return t.tracer.StartRPCClientSpan(ctx, service, method, md)
+}
+func (t *trace) StartRPCServerSpan(ctx context.Context, service, method string, md map[string]string) (context.Context, func(error)) {
+	return t.tracer.StartRPCServerSpan(ctx, service, method, md)
+}
+func (t *trace) StartSpan(ctx context.Context, name string, tags map[string]string) (context.Context, func(error)) {
+	return t.tracer.StartSpan(ctx, name, tags)
+}
 func (t *trace) GetTracer() (string, interface{}) {
 	return t.tracer.GetTracer()
 }
 
+// Shutdown flushes and stops the underlying tracer, if it supports it.
+func (t *trace) Shutdown(ctx context.Context) error {
+	if s, ok := t.tracer.(interface{ Shutdown(context.Context) error }); ok {
+		return s.Shutdown(ctx)
+	}
+	return nil
+}
+
+// NewTracer returns the tracer configured by options, or nil if it cannot be
+// created. The error is logged with the logger of WithTraceLog, see
+// NewTracerE to get it.
 func NewTracer(options ...TraceOption) Tracer {
+	t, err := newTracer(options...)
+	if err != nil {
+		t.Logger.Error("error=%v", err.Error())
+		return nil
+	}
+	return t
+}
+
+// NewTracerE returns the tracer configured by options, or the error
+// preventing its creation, e.g. an unknown tracer, exporter or reporter
+// type.
+func NewTracerE(options ...TraceOption) (Tracer, error) {
+	t, err := newTracer(options...)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func newTracer(options ...TraceOption) (*trace, error) {
 	t := &trace{}
 	for _, option := range options {
 		option(t)
@@ -106,13 +220,9 @@ func NewTracer(options ...TraceOption) Tracer {
 	case TRACER_TYPE_ZIPKIN:
 		t.tracer, err = NewZipkinTracer(t.Logger, t.Name, t.ServiceName, t.exporterType, t.exporterUrl, t.address, t.Tags, t.Propagate, true, t.RequestSampler)
 	case TRACER_TYPE_OPENTELEMETRY:
-		t.tracer, err = NewOpentelemetryTracer(t.Logger, t.Name, t.ServiceName, t.exporterType, t.exporterUrl, t.address, t.Tags, t.Propagate, true, t.RequestSampler)
-	}
-
-	if err != nil {
-		t.Logger.Error("error=%v", err.Error())
-		return nil
+		t.tracer, err = newOpentelemetryTracer(t.Logger, t.Name, t.ServiceName, t.exporterType, t.exporterUrl, t.address, t.Tags, t.Propagate, true, t.RequestSampler, t.provider)
+	default:
+		err = fmt.Errorf("unknown tracer type %q", t.tracerType)
 	}
-
-	return t
+	return t, err
 }
@@ -0,0 +1,27 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/libra9z/mskit/v4/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTracerE(t *testing.T) {
+	tracer, err := NewTracerE(WithTraceType(TRACER_TYPE_ZIPKIN), WithServiceNameOption("users"), WithReporterType(ZIPKIN_REPORTER_TYPE_NOOP))
+	require.NoError(t, err)
+	assert.Equal(t, "users", tracer.GetServiceName())
+
+	for _, options := range [][]TraceOption{
+		nil,
+		{WithTraceType(TRACER_TYPE_OPENTRACING)},
+		{WithTraceType(TRACER_TYPE_ZIPKIN), WithTraceLog(log.Mslog), WithReporterType("carrier-pigeon")},
+		{WithTraceType(TRACER_TYPE_OPENTELEMETRY), WithTraceLog(log.Mslog), WithExporterType("carrier-pigeon")},
+	} {
+		tracer, err := NewTracerE(options...)
+		assert.Error(t, err)
+		assert.Nil(t, tracer)
+		assert.Nil(t, NewTracer(options...))
+	}
+}
@@ -6,7 +6,8 @@ import (
 	"github.com/libra9z/mskit/v4/log"
 )
 
-// TracerOption allows for functional options to our Zipkin tracing middleware.
+// TracerOption allows for functional options to our tracing middleware,
+// see TraceEndpoint.
 type TracerOption func(o *TracerOptions)
 
 // Name sets the name for an instrumented transport endpoint. If name is omitted